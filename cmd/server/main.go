@@ -12,6 +12,7 @@ import (
 	"nodepassPanel/internal/router"
 	"nodepassPanel/internal/service"
 	"nodepassPanel/internal/task"
+	"nodepassPanel/internal/websocket"
 	"nodepassPanel/pkg/logger"
 	"os"
 	"os/signal"
@@ -83,10 +84,28 @@ func main() {
 		if err := settingSvc.InitDefaultSettings(); err != nil {
 			logger.Log.Error("Failed to init default settings", zap.Error(err))
 		}
+
+		// 支付网关配置 (首次启动从配置文件迁移)
+		if err := service.NewPaymentService().InitGatewaySettings(); err != nil {
+			logger.Log.Error("Failed to init payment gateway settings", zap.Error(err))
+		}
+
+		// 套餐计费周期 (旧套餐按原价格与有效期生成)
+		if err := service.NewPlanService().InitPlanPrices(); err != nil {
+			logger.Log.Error("Failed to init plan prices", zap.Error(err))
+		}
+
+		// 支付回调与跳转地址依赖站点地址
+		if err := settingSvc.ValidateSiteURLs(); err != nil {
+			logger.Log.Fatal("Site url validation failed", zap.Error(err))
+		}
 	}
 
 	// 初始化 Websocket Hub
-	handler.InitGlobalHub()
+	if err := handler.InitGlobalHub(); err != nil {
+		logger.Log.Fatal("Websocket hub initialization failed", zap.Error(err))
+	}
+	defer websocket.GlobalHub.Close()
 
 	// 启动后台任务
 	task.StartTasks()
@@ -25,6 +25,28 @@ type DatabaseConfig struct {
 	MaxOpenConns int    `mapstructure:"max_open_conns"`
 }
 
+// PostgresDSN 构造 Postgres 连接串
+func (c DatabaseConfig) PostgresDSN() string {
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=disable TimeZone=Asia/Shanghai",
+		c.Host,
+		c.Username,
+		c.Password,
+		c.DbName,
+		c.Port,
+	)
+}
+
+// WebSocketConfig WebSocket 配置
+type WebSocketConfig struct {
+	// Backplane 多实例间同步推送消息的方式: memory (默认，单实例), postgres (LISTEN/NOTIFY，需使用 Postgres 数据库)
+	Backplane string `mapstructure:"backplane"`
+	Channel   string `mapstructure:"channel"` // Postgres 通知频道名，默认 nodepass_ws
+
+	// SlowConsumer 连接发送队列已满时的处理: drop_oldest (默认，丢弃最旧消息), disconnect (断开连接)
+	SlowConsumer string `mapstructure:"slow_consumer"`
+	QueueSize    int    `mapstructure:"queue_size"` // 每个连接的发送队列长度，默认 256
+}
+
 // SMTPConfig SMTP 邮件配置
 type SMTPConfig struct {
 	Host     string `mapstructure:"host"`
@@ -35,6 +57,14 @@ type SMTPConfig struct {
 	FromName string `mapstructure:"from_name"`
 }
 
+// SiteConfig 站点对外访问配置 (可被系统设置 site_url / payment_return_path 覆盖)
+type SiteConfig struct {
+	// BaseURL 站点对外访问地址，如 https://panel.example.com，支付回调与跳转地址由此生成
+	BaseURL string `mapstructure:"base_url"`
+	// ReturnPath 支付完成后跳转的前端路径，支持 {order_no} 与 {status} (success/cancel) 占位符
+	ReturnPath string `mapstructure:"return_path"`
+}
+
 // InviteConfig 邀请返利配置
 type InviteConfig struct {
 	Enabled        bool    `mapstructure:"enabled"`         // 是否开启邀请
@@ -62,13 +92,47 @@ type PaymentConfig struct {
 	EPay   EPayConfig   `mapstructure:"epay"`
 }
 
+// AlertEmailConfig 告警邮件通道配置
+type AlertEmailConfig struct {
+	Enabled bool     `mapstructure:"enabled"`
+	To      []string `mapstructure:"to"` // 收件人列表
+}
+
+// AlertWebhookConfig 告警 Webhook 通道配置
+type AlertWebhookConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	URL     string `mapstructure:"url"`    // 接收 JSON POST 的地址
+	Secret  string `mapstructure:"secret"` // 可选，HMAC-SHA256 签名密钥
+}
+
+// AlertTelegramConfig 告警 Telegram 通道配置
+type AlertTelegramConfig struct {
+	Enabled  bool   `mapstructure:"enabled"`
+	BotToken string `mapstructure:"bot_token"`
+	ChatID   string `mapstructure:"chat_id"`
+}
+
+// AlertConfig 节点故障告警配置
+type AlertConfig struct {
+	FailThreshold    int                 `mapstructure:"fail_threshold"`    // 连续失败多少次后产生故障，默认 3
+	RecoverThreshold int                 `mapstructure:"recover_threshold"` // 连续成功多少次后恢复，默认 2
+	FlapWindow       int                 `mapstructure:"flap_window"`       // 抖动检测窗口 (分钟)，默认 60
+	FlapLimit        int                 `mapstructure:"flap_limit"`        // 窗口内故障次数达到该值视为抖动并抑制通知，默认 3
+	Email            AlertEmailConfig    `mapstructure:"email"`
+	Webhook          AlertWebhookConfig  `mapstructure:"webhook"`
+	Telegram         AlertTelegramConfig `mapstructure:"telegram"`
+}
+
 type AppConfig struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Database DatabaseConfig `mapstructure:"database"`
-	Log      logger.Config  `mapstructure:"log"`
-	SMTP     SMTPConfig     `mapstructure:"smtp"`
-	Invite   InviteConfig   `mapstructure:"invite"`
-	Payment  PaymentConfig  `mapstructure:"payment"`
+	Server    ServerConfig    `mapstructure:"server"`
+	Database  DatabaseConfig  `mapstructure:"database"`
+	Log       logger.Config   `mapstructure:"log"`
+	SMTP      SMTPConfig      `mapstructure:"smtp"`
+	Site      SiteConfig      `mapstructure:"site"`
+	Invite    InviteConfig    `mapstructure:"invite"`
+	Payment   PaymentConfig   `mapstructure:"payment"`
+	Alert     AlertConfig     `mapstructure:"alert"`
+	WebSocket WebSocketConfig `mapstructure:"websocket"`
 }
 
 var App AppConfig
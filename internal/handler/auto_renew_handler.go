@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"net/http"
+	"nodepassPanel/internal/middleware"
+	"nodepassPanel/internal/service"
+	"nodepassPanel/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AutoRenewHandler 自动续费处理器
+type AutoRenewHandler struct {
+	autoRenewService *service.AutoRenewService
+}
+
+// NewAutoRenewHandler 创建自动续费处理器实例
+func NewAutoRenewHandler() *AutoRenewHandler {
+	return &AutoRenewHandler{
+		autoRenewService: service.NewAutoRenewService(),
+	}
+}
+
+// Get 获取自动续费设置
+// @Summary 获取自动续费设置
+// @Tags User
+// @Success 200 {object} response.Response
+// @Router /api/v1/user/auto-renew [get]
+func (h *AutoRenewHandler) Get(c *gin.Context) {
+	status, err := h.autoRenewService.GetStatus(middleware.GetUserID(c))
+	if err != nil {
+		response.Fail(c, err.Error())
+		return
+	}
+
+	response.Success(c, status)
+}
+
+// Update 开启或关闭自动续费
+// @Summary 设置自动续费
+// @Tags User
+// @Accept json
+// @Param request body service.AutoRenewRequest true "自动续费设置"
+// @Success 200 {object} response.Response
+// @Router /api/v1/user/auto-renew [put]
+func (h *AutoRenewHandler) Update(c *gin.Context) {
+	var req service.AutoRenewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	status, err := h.autoRenewService.SetEnabled(middleware.GetUserID(c), req.Enabled)
+	if err != nil {
+		response.Fail(c, err.Error())
+		return
+	}
+
+	response.Success(c, status)
+}
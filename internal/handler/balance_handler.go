@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"net/http"
+	"nodepassPanel/internal/middleware"
+	"nodepassPanel/internal/service"
+	"nodepassPanel/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BalanceHandler 资金流水处理器
+type BalanceHandler struct {
+	ledgerService *service.LedgerService
+}
+
+// NewBalanceHandler 创建资金流水处理器实例
+func NewBalanceHandler() *BalanceHandler {
+	return &BalanceHandler{
+		ledgerService: service.NewLedgerService(),
+	}
+}
+
+// Logs 获取当前用户资金流水
+// @Summary 获取资金流水
+// @Tags User
+// @Param page query int false "页码"
+// @Param page_size query int false "每页数量"
+// @Param account query string false "账户: balance, commission"
+// @Param type query string false "变动类型"
+// @Success 200 {object} response.Response
+// @Router /api/v1/user/balance/logs [get]
+func (h *BalanceHandler) Logs(c *gin.Context) {
+	var query service.BalanceLogQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := h.ledgerService.GetUserLogs(middleware.GetUserID(c), &query)
+	if err != nil {
+		response.Fail(c, err.Error())
+		return
+	}
+
+	response.Success(c, result)
+}
+
+// AdminLogs 资金流水审计
+// @Summary 获取资金流水（管理员）
+// @Tags Admin/Balance
+// @Param page query int false "页码"
+// @Param page_size query int false "每页数量"
+// @Param user_id query int false "用户ID"
+// @Param account query string false "账户"
+// @Param type query string false "变动类型"
+// @Param order_id query int false "订单ID"
+// @Param txn_no query string false "流水号"
+// @Param system query bool false "包含系统账户分录"
+// @Success 200 {object} response.Response
+// @Router /api/v1/admin/balance/logs [get]
+func (h *BalanceHandler) AdminLogs(c *gin.Context) {
+	var query service.AdminBalanceLogQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := h.ledgerService.GetLogs(&query)
+	if err != nil {
+		response.Fail(c, err.Error())
+		return
+	}
+
+	response.Success(c, result)
+}
@@ -126,9 +126,9 @@ func (h *CouponHandler) Delete(c *gin.Context) {
 }
 
 type VerifyCouponRequest struct {
-	Code   string  `json:"code" binding:"required"`
-	PlanID uint    `json:"plan_id" binding:"required"`
-	Amount float64 `json:"amount" binding:"required,gt=0"`
+	Code   string `json:"code" binding:"required"`
+	PlanID uint   `json:"plan_id" binding:"required"`
+	Period string `json:"period" binding:"required"`
 }
 
 // Verify 验证优惠券
@@ -152,7 +152,7 @@ func (h *CouponHandler) Verify(c *gin.Context) {
 		return
 	}
 
-	coupon, discount, err := h.couponService.VerifyCoupon(req.Code, userID, req.PlanID, req.Amount)
+	coupon, discount, amount, err := h.couponService.VerifyForPlan(req.Code, userID, req.PlanID, req.Period)
 	if err != nil {
 		response.Fail(c, err.Error())
 		return
@@ -161,7 +161,7 @@ func (h *CouponHandler) Verify(c *gin.Context) {
 	response.Success(c, gin.H{
 		"valid":        true,
 		"discount":     discount,
-		"final_amount": req.Amount - discount,
+		"final_amount": amount - discount,
 		"coupon":       coupon,
 	})
 }
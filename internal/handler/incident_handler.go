@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"net/http"
+	"nodepassPanel/internal/service"
+	"nodepassPanel/pkg/response"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IncidentHandler 节点故障告警处理器
+type IncidentHandler struct {
+	alertService *service.AlertService
+}
+
+// NewIncidentHandler 创建节点故障告警处理器实例
+func NewIncidentHandler() *IncidentHandler {
+	return &IncidentHandler{
+		alertService: service.NewAlertService(),
+	}
+}
+
+// List 获取节点故障记录
+// @Summary 获取节点故障记录（管理员）
+// @Tags Admin/Incident
+// @Param page query int false "页码"
+// @Param page_size query int false "每页数量"
+// @Param node_id query int false "节点ID"
+// @Param status query string false "状态: open, resolved"
+// @Success 200 {object} response.Response
+// @Router /api/v1/admin/incidents [get]
+func (h *IncidentHandler) List(c *gin.Context) {
+	var query service.IncidentQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := h.alertService.GetIncidents(&query)
+	if err != nil {
+		response.Fail(c, err.Error())
+		return
+	}
+
+	response.Success(c, result)
+}
+
+// Get 获取节点故障详情
+// @Summary 获取节点故障详情（管理员）
+// @Tags Admin/Incident
+// @Param id path int true "故障ID"
+// @Success 200 {object} response.Response
+// @Router /api/v1/admin/incidents/{id} [get]
+func (h *IncidentHandler) Get(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid incident id")
+		return
+	}
+
+	incident, err := h.alertService.GetIncident(uint(id))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "incident not found")
+		return
+	}
+
+	response.Success(c, incident)
+}
+
+// TestChannels 测试告警通道
+// @Summary 向已启用的告警通道发送测试消息（管理员）
+// @Tags Admin/Incident
+// @Success 200 {object} response.Response
+// @Router /api/v1/admin/alerts/test [post]
+func (h *IncidentHandler) TestChannels(c *gin.Context) {
+	results, err := h.alertService.TestChannels()
+	if err != nil {
+		response.Fail(c, err.Error())
+		return
+	}
+
+	response.Success(c, results)
+}
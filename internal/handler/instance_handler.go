@@ -0,0 +1,310 @@
+package handler
+
+import (
+	"net/http"
+	"nodepassPanel/internal/middleware"
+	"nodepassPanel/internal/service"
+	"nodepassPanel/pkg/response"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InstanceHandler 转发规则处理器
+type InstanceHandler struct {
+	instanceService    *service.InstanceService
+	enforcementService *service.EnforcementService
+}
+
+// NewInstanceHandler 创建转发规则处理器实例
+func NewInstanceHandler() *InstanceHandler {
+	return &InstanceHandler{
+		instanceService:    service.NewInstanceService(),
+		enforcementService: service.NewEnforcementService(),
+	}
+}
+
+// ==================== 用户端接口 ====================
+
+// List 获取我的转发规则
+// @Summary 获取我的转发规则列表
+// @Tags Instance
+// @Success 200 {object} response.Response
+// @Router /api/v1/user/instances [get]
+func (h *InstanceHandler) List(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		response.Error(c, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	instances, err := h.instanceService.GetUserInstances(userID)
+	if err != nil {
+		response.Fail(c, err.Error())
+		return
+	}
+
+	response.Success(c, gin.H{
+		"list":  instances,
+		"total": len(instances),
+	})
+}
+
+// Get 获取转发规则详情
+// @Summary 获取转发规则详情
+// @Tags Instance
+// @Param id path int true "规则ID"
+// @Success 200 {object} response.Response
+// @Router /api/v1/user/instances/{id} [get]
+func (h *InstanceHandler) Get(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid instance id")
+		return
+	}
+
+	instance, err := h.instanceService.GetUserInstance(userID, uint(id))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	response.Success(c, instance)
+}
+
+// Create 创建转发规则
+// @Summary 创建转发规则
+// @Tags Instance
+// @Accept json
+// @Param request body service.CreateInstanceRequest true "规则信息"
+// @Success 200 {object} response.Response
+// @Router /api/v1/user/instances [post]
+func (h *InstanceHandler) Create(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		response.Error(c, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var req service.CreateInstanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	instance, err := h.instanceService.Create(userID, &req)
+	if err != nil {
+		response.Fail(c, err.Error())
+		return
+	}
+
+	response.Success(c, instance)
+}
+
+// Update 更新转发规则
+// @Summary 更新转发规则
+// @Tags Instance
+// @Accept json
+// @Param id path int true "规则ID"
+// @Param request body service.UpdateInstanceRequest true "规则信息"
+// @Success 200 {object} response.Response
+// @Router /api/v1/user/instances/{id} [put]
+func (h *InstanceHandler) Update(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid instance id")
+		return
+	}
+
+	var req service.UpdateInstanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	instance, err := h.instanceService.Update(userID, uint(id), &req)
+	if err != nil {
+		response.Fail(c, err.Error())
+		return
+	}
+
+	response.Success(c, instance)
+}
+
+// Delete 删除转发规则
+// @Summary 删除转发规则
+// @Tags Instance
+// @Param id path int true "规则ID"
+// @Success 200 {object} response.Response
+// @Router /api/v1/user/instances/{id} [delete]
+func (h *InstanceHandler) Delete(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid instance id")
+		return
+	}
+
+	if err := h.instanceService.Delete(userID, uint(id)); err != nil {
+		response.Fail(c, err.Error())
+		return
+	}
+
+	response.Success(c, nil)
+}
+
+// ==================== 管理员接口 ====================
+
+// AdminList 获取转发规则列表
+// @Summary 获取转发规则列表（管理员）
+// @Tags Admin/Instance
+// @Param page query int false "页码"
+// @Param page_size query int false "每页数量"
+// @Param user_id query int false "用户ID"
+// @Param node_id query int false "节点ID"
+// @Success 200 {object} response.Response
+// @Router /api/v1/admin/instances [get]
+func (h *InstanceHandler) AdminList(c *gin.Context) {
+	var query service.InstanceListQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := h.instanceService.GetInstanceList(&query)
+	if err != nil {
+		response.Fail(c, err.Error())
+		return
+	}
+
+	response.Success(c, result)
+}
+
+// AdminGet 获取转发规则详情
+// @Summary 获取转发规则详情（管理员）
+// @Tags Admin/Instance
+// @Param id path int true "规则ID"
+// @Success 200 {object} response.Response
+// @Router /api/v1/admin/instances/{id} [get]
+func (h *InstanceHandler) AdminGet(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid instance id")
+		return
+	}
+
+	instance, err := h.instanceService.GetByID(uint(id))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "instance not found")
+		return
+	}
+
+	response.Success(c, instance)
+}
+
+// AdminCreate 为用户创建转发规则
+// @Summary 为用户创建转发规则（管理员）
+// @Tags Admin/Instance
+// @Accept json
+// @Param request body service.AdminCreateInstanceRequest true "规则信息"
+// @Success 200 {object} response.Response
+// @Router /api/v1/admin/instances [post]
+func (h *InstanceHandler) AdminCreate(c *gin.Context) {
+	var req service.AdminCreateInstanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	instance, err := h.instanceService.AdminCreate(&req)
+	if err != nil {
+		response.Fail(c, err.Error())
+		return
+	}
+
+	response.Success(c, instance)
+}
+
+// AdminUpdate 更新转发规则
+// @Summary 更新转发规则（管理员）
+// @Tags Admin/Instance
+// @Accept json
+// @Param id path int true "规则ID"
+// @Param request body service.UpdateInstanceRequest true "规则信息"
+// @Success 200 {object} response.Response
+// @Router /api/v1/admin/instances/{id} [put]
+func (h *InstanceHandler) AdminUpdate(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid instance id")
+		return
+	}
+
+	var req service.UpdateInstanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	instance, err := h.instanceService.AdminUpdate(uint(id), &req)
+	if err != nil {
+		response.Fail(c, err.Error())
+		return
+	}
+
+	response.Success(c, instance)
+}
+
+// AdminDelete 删除转发规则
+// @Summary 删除转发规则（管理员）
+// @Tags Admin/Instance
+// @Param id path int true "规则ID"
+// @Success 200 {object} response.Response
+// @Router /api/v1/admin/instances/{id} [delete]
+func (h *InstanceHandler) AdminDelete(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid instance id")
+		return
+	}
+
+	if err := h.instanceService.AdminDelete(uint(id)); err != nil {
+		response.Fail(c, err.Error())
+		return
+	}
+
+	response.Success(c, nil)
+}
+
+// AdminEvents 获取转发规则状态变更记录
+// @Summary 获取转发规则停用/恢复记录（管理员）
+// @Tags Admin/Instance
+// @Param id path int true "规则ID"
+// @Param page query int false "页码"
+// @Param page_size query int false "每页数量"
+// @Success 200 {object} response.Response
+// @Router /api/v1/admin/instances/{id}/events [get]
+func (h *InstanceHandler) AdminEvents(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid instance id")
+		return
+	}
+
+	var query service.InstanceEventQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	query.InstanceID = uint(id)
+
+	result, err := h.enforcementService.GetEvents(&query)
+	if err != nil {
+		response.Fail(c, err.Error())
+		return
+	}
+
+	response.Success(c, result)
+}
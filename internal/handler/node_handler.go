@@ -12,13 +12,17 @@ import (
 
 // NodeHandler 节点处理器
 type NodeHandler struct {
-	nodeService *service.NodeService
+	nodeService   *service.NodeService
+	portService   *service.PortService
+	metricService *service.NodeMetricService
 }
 
 // NewNodeHandler 创建节点处理器实例
 func NewNodeHandler() *NodeHandler {
 	return &NodeHandler{
-		nodeService: service.NewNodeService(),
+		nodeService:   service.NewNodeService(),
+		portService:   service.NewPortService(),
+		metricService: service.NewNodeMetricService(),
 	}
 }
 
@@ -178,3 +182,64 @@ func (h *NodeHandler) Refresh(c *gin.Context) {
 
 	response.Success(c, node)
 }
+
+// Ports 获取节点端口使用情况
+// @Summary 获取节点端口使用情况并与节点对账（管理员）
+// @Tags Admin/Node
+// @Param id path int true "节点ID"
+// @Success 200 {object} response.Response
+// @Router /api/v1/admin/nodes/{id}/ports [get]
+func (h *NodeHandler) Ports(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid node id")
+		return
+	}
+
+	usage, err := h.portService.GetUsage(uint(id))
+	if err != nil {
+		response.Fail(c, err.Error())
+		return
+	}
+
+	response.Success(c, usage)
+}
+
+// Metrics 获取节点监控历史
+// @Summary 获取节点监控历史（管理员）
+// @Tags Admin/Node
+// @Param id path int true "节点ID"
+// @Param range query string false "时间范围，如 6h、24h、7d、30d，默认 24h"
+// @Success 200 {object} response.Response
+// @Router /api/v1/admin/nodes/{id}/metrics [get]
+func (h *NodeHandler) Metrics(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid node id")
+		return
+	}
+
+	metrics, err := h.metricService.GetNodeMetrics(uint(id), c.Query("range"))
+	if err != nil {
+		response.Fail(c, err.Error())
+		return
+	}
+
+	response.Success(c, metrics)
+}
+
+// Uptime 获取节点在线率
+// @Summary 获取节点在线率
+// @Tags Node
+// @Param range query string false "时间范围，如 24h、7d、30d，默认 24h"
+// @Success 200 {object} response.Response
+// @Router /api/v1/user/nodes/uptime [get]
+func (h *NodeHandler) Uptime(c *gin.Context) {
+	uptimes, err := h.metricService.GetUptimes(c.Query("range"), middleware.GetUserID(c), middleware.IsAdmin(c))
+	if err != nil {
+		response.Fail(c, err.Error())
+		return
+	}
+
+	response.Success(c, uptimes)
+}
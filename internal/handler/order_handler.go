@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"errors"
+	"io"
 	"net/http"
 	"nodepassPanel/internal/middleware"
 	"nodepassPanel/internal/service"
@@ -53,6 +55,52 @@ func (h *OrderHandler) Create(c *gin.Context) {
 	response.Success(c, order)
 }
 
+// UpgradeQuote 套餐变更报价
+// @Summary 预览套餐升级/降级价格
+// @Tags Order
+// @Param plan_id query int true "目标套餐ID"
+// @Param coupon_code query string false "优惠券码"
+// @Success 200 {object} response.Response
+// @Router /api/v1/user/orders/upgrade/quote [get]
+func (h *OrderHandler) UpgradeQuote(c *gin.Context) {
+	var req service.UpgradeRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	quote, err := h.orderService.QuoteUpgrade(middleware.GetUserID(c), &req)
+	if err != nil {
+		response.Fail(c, err.Error())
+		return
+	}
+
+	response.Success(c, quote)
+}
+
+// Upgrade 创建套餐变更订单
+// @Summary 套餐升级/降级
+// @Tags Order
+// @Accept json
+// @Param request body service.UpgradeRequest true "目标套餐"
+// @Success 200 {object} response.Response
+// @Router /api/v1/user/orders/upgrade [post]
+func (h *OrderHandler) Upgrade(c *gin.Context) {
+	var req service.UpgradeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	order, err := h.orderService.CreateUpgrade(middleware.GetUserID(c), &req)
+	if err != nil {
+		response.Fail(c, err.Error())
+		return
+	}
+
+	response.Success(c, order)
+}
+
 // List 获取我的订单
 // @Summary 获取我的订单列表
 // @Tags Order
@@ -177,6 +225,29 @@ func (h *OrderHandler) AdminGet(c *gin.Context) {
 	response.Success(c, order)
 }
 
+// AdminPayments 获取订单的支付网关交互记录
+// @Summary 获取订单支付记录（管理员）
+// @Description 发起支付请求、跳转地址、回调原始参数与验签结果，用于与网关对账
+// @Tags Admin/Order
+// @Param id path int true "订单ID"
+// @Success 200 {object} response.Response
+// @Router /api/v1/admin/orders/{id}/payments [get]
+func (h *OrderHandler) AdminPayments(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid order id")
+		return
+	}
+
+	txns, err := h.orderService.GetPayments(uint(id))
+	if err != nil {
+		response.Fail(c, err.Error())
+		return
+	}
+
+	response.Success(c, txns)
+}
+
 // MarkPaidRequest 标记已支付请求
 type MarkPaidRequest struct {
 	PayMethod string `json:"pay_method" binding:"required"`
@@ -213,8 +284,11 @@ func (h *OrderHandler) MarkPaid(c *gin.Context) {
 
 // Refund 退款
 // @Summary 退款（管理员）
+// @Description 不传金额时退还剩余全部金额；余额支付退回余额，Stripe 原路退款，易支付需在网关后台手动退款
 // @Tags Admin/Order
+// @Accept json
 // @Param id path int true "订单ID"
+// @Param request body service.RefundRequest false "退款金额与原因"
 // @Success 200 {object} response.Response
 // @Router /api/v1/admin/orders/{id}/refund [post]
 func (h *OrderHandler) Refund(c *gin.Context) {
@@ -224,12 +298,19 @@ func (h *OrderHandler) Refund(c *gin.Context) {
 		return
 	}
 
-	if err := h.orderService.Refund(uint(id)); err != nil {
+	var req service.RefundRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := h.orderService.Refund(uint(id), &req)
+	if err != nil {
 		response.Fail(c, err.Error())
 		return
 	}
 
-	response.Success(c, nil)
+	response.Success(c, result)
 }
 
 // Delete 删除订单
@@ -9,15 +9,62 @@ import (
 )
 
 type PaymentHandler struct {
-	orderService *service.OrderService
+	orderService   *service.OrderService
+	paymentService *service.PaymentService
 }
 
 func NewPaymentHandler() *PaymentHandler {
 	return &PaymentHandler{
-		orderService: service.NewOrderService(),
+		orderService:   service.NewOrderService(),
+		paymentService: service.NewPaymentService(),
 	}
 }
 
+// Methods 获取可用支付方式
+// @Summary 获取可用支付方式
+// @Tags Payment
+// @Param order_type query string false "订单类型 (plan, recharge)"
+// @Success 200 {object} response.Response
+// @Router /api/v1/payment/methods [get]
+func (h *PaymentHandler) Methods(c *gin.Context) {
+	response.Success(c, h.paymentService.ListMethods(c.Query("order_type")))
+}
+
+// AdminGateways 获取支付网关及配置
+// @Summary 获取支付网关及配置（管理员）
+// @Tags Admin/Payment
+// @Success 200 {object} response.Response
+// @Router /api/v1/admin/payment/gateways [get]
+func (h *PaymentHandler) AdminGateways(c *gin.Context) {
+	gateways, err := h.paymentService.ListGateways()
+	if err != nil {
+		response.Fail(c, err.Error())
+		return
+	}
+	response.Success(c, gateways)
+}
+
+// AdminUpdateGateway 更新支付网关配置
+// @Summary 更新支付网关配置（管理员），密钥传 ****** 表示不修改
+// @Tags Admin/Payment
+// @Param name path string true "网关标识"
+// @Param body body payment.GatewayConfig true "网关配置"
+// @Success 200 {object} response.Response
+// @Router /api/v1/admin/payment/gateways/{name} [put]
+func (h *PaymentHandler) AdminUpdateGateway(c *gin.Context) {
+	var req payment.GatewayConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Fail(c, "参数无效")
+		return
+	}
+
+	if err := h.paymentService.UpdateGateway(c.Param("name"), &req); err != nil {
+		response.Fail(c, err.Error())
+		return
+	}
+	response.Success(c, nil)
+}
+
 // Pay 发起支付
 func (h *PaymentHandler) Pay(c *gin.Context) {
 	var req struct {
@@ -163,7 +163,7 @@ func (h *UserHandler) AdminUpdate(c *gin.Context) {
 		return
 	}
 
-	user, err := h.userService.UpdateUser(uint(id), &req)
+	user, err := h.userService.UpdateUser(uint(id), &req, middleware.GetUserID(c))
 	if err != nil {
 		response.Fail(c, err.Error())
 		return
@@ -240,7 +240,7 @@ func (h *UserHandler) AdminCharge(c *gin.Context) {
 		return
 	}
 
-	if err := h.userService.ChargeUser(uint(id), req.Amount); err != nil {
+	if err := h.userService.ChargeUser(uint(id), req.Amount, middleware.GetUserID(c)); err != nil {
 		response.Fail(c, err.Error())
 		return
 	}
@@ -352,7 +352,7 @@ func (h *UserHandler) BatchCharge(c *gin.Context) {
 		return
 	}
 
-	count, err := h.userService.BatchCharge(req.IDs, req.Amount)
+	count, err := h.userService.BatchCharge(req.IDs, req.Amount, middleware.GetUserID(c))
 	if err != nil {
 		response.Fail(c, err.Error())
 		return
@@ -1,44 +1,147 @@
 package handler
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"nodepassPanel/internal/config"
+	"nodepassPanel/internal/service"
 	"nodepassPanel/internal/websocket"
+	"nodepassPanel/pkg/response"
+	"nodepassPanel/pkg/utils"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
+// wsTokenProtocol 通过 Sec-WebSocket-Protocol 传递 Token 时使用的协议名
+// 浏览器无法为 WebSocket 设置请求头，客户端可使用 new WebSocket(url, ["access_token", token])
+const wsTokenProtocol = "access_token"
+
 type WSHandler struct {
-	hub *websocket.Hub
+	hub             *websocket.Hub
+	nodeService     *service.NodeService
+	metricService   *service.NodeMetricService
+	instanceService *service.InstanceService
+	orderService    *service.OrderService
+	userService     *service.UserService
 }
 
-// Global Hub instance, initialized in main or router?
-// Ideally injected.
-// var GlobalHub *websocket.Hub // Moved to websocket package
+// InitGlobalHub 初始化全局 Hub，按配置选择 Backplane
+func InitGlobalHub() error {
+	hub := websocket.NewHub()
+
+	policy := websocket.SlowConsumerPolicy(config.App.WebSocket.SlowConsumer)
+	switch policy {
+	case "":
+		policy = websocket.SlowConsumerDropOldest
+	case websocket.SlowConsumerDropOldest, websocket.SlowConsumerDisconnect:
+	default:
+		return fmt.Errorf("unknown websocket slow consumer policy: %s", policy)
+	}
+	hub.SetSlowConsumerPolicy(policy, config.App.WebSocket.QueueSize)
+
+	switch config.App.WebSocket.Backplane {
+	case "", "memory":
+	case "postgres":
+		if config.App.Database.Driver == "sqlite" {
+			return errors.New("websocket postgres backplane requires a postgres database")
+		}
+		backplane, err := websocket.NewPostgresBackplane(config.App.Database.PostgresDSN(), config.App.WebSocket.Channel)
+		if err != nil {
+			return err
+		}
+		if err := hub.SetBackplane(backplane); err != nil {
+			backplane.Close()
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown websocket backplane: %s", config.App.WebSocket.Backplane)
+	}
 
-func InitGlobalHub() {
-	websocket.GlobalHub = websocket.NewHub()
-	go websocket.GlobalHub.Run()
+	websocket.GlobalHub = hub
+	go hub.Run()
+	return nil
 }
 
 func NewWSHandler() *WSHandler {
 	if websocket.GlobalHub == nil {
-		InitGlobalHub()
+		websocket.GlobalHub = websocket.NewHub()
+		go websocket.GlobalHub.Run()
+	}
+	h := &WSHandler{
+		hub:             websocket.GlobalHub,
+		nodeService:     service.NewNodeService(),
+		metricService:   service.NewNodeMetricService(),
+		instanceService: service.NewInstanceService(),
+		orderService:    service.NewOrderService(),
+		userService:     service.NewUserService(),
 	}
-	return &WSHandler{hub: websocket.GlobalHub}
+	h.registerRoutes(h.hub.Router())
+	return h
 }
 
+// Connect 建立 WebSocket 连接
+// @Summary 建立 WebSocket 连接
+// @Description Token 通过 ?token= 或 Sec-WebSocket-Protocol: access_token, <token> 传递
+// @Tags WebSocket
+// @Param token query string false "JWT Token"
+// @Param last_seq query int false "断线重连时上次收到的最大消息序号"
+// @Param epoch query string false "断线重连时上次 welcome 消息中的 epoch"
+// @Router /api/v1/ws [get]
 func (h *WSHandler) Connect(c *gin.Context) {
-	// 识别用户
-	// 暂时允许公开连接? 或者使用 Query Token?
-	// 例如 ?token=...
+	token, subprotocol := wsToken(c.Request)
+	if token == "" {
+		response.Error(c, http.StatusUnauthorized, "missing token")
+		return
+	}
 
-	// MVP 阶段: 默认加入 Public 房间
-	// 如果是管理员: ["public", "admin"]
+	claims, err := utils.ParseToken(token)
+	if err != nil {
+		response.Error(c, http.StatusUnauthorized, "invalid or expired token")
+		return
+	}
 
-	rooms := []string{"public"}
+	// Token 有效期内被禁用的用户不能建立连接
+	user, err := h.userService.GetUserByID(claims.UserID)
+	if err != nil {
+		response.Error(c, http.StatusUnauthorized, "user not found")
+		return
+	}
+	if user.Status != 1 {
+		response.Error(c, http.StatusForbidden, "account disabled")
+		return
+	}
 
-	// TODO: 验证 Token 并分配房间
+	session := &websocket.Session{
+		UserID:      claims.UserID,
+		IsAdmin:     claims.Role == "admin",
+		Subprotocol: subprotocol,
+		Epoch:       c.Query("epoch"),
+	}
+	if value := c.Query("last_seq"); value != "" {
+		lastSeq, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			response.Error(c, http.StatusBadRequest, "invalid last_seq")
+			return
+		}
+		session.Resume = true
+		session.LastSeq = lastSeq
+	}
 
-	websocket.ServeWs(h.hub, c, rooms)
+	websocket.ServeWs(h.hub, c, session)
+}
+
+// Stats 获取 WebSocket 运行统计
+// @Summary 获取 WebSocket 运行统计（管理员）
+// @Description 连接数、房间数、丢弃消息数与发送队列深度
+// @Tags Admin/WebSocket
+// @Success 200 {object} response.Response
+// @Router /api/v1/admin/ws/stats [get]
+func (h *WSHandler) Stats(c *gin.Context) {
+	response.Success(c, h.hub.Stats())
 }
 
 // PushMessage (Internal API or Debug)
@@ -47,3 +150,134 @@ func (h *WSHandler) PushMessage(c *gin.Context) {
 	h.hub.Broadcast([]byte(msg))
 	c.String(200, "ok")
 }
+
+// wsToken 从查询参数或 Sec-WebSocket-Protocol 中提取 Token
+// 返回 Token 及握手时需回显的协议名 (查询参数方式为空)
+func wsToken(r *http.Request) (string, string) {
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token, ""
+	}
+
+	var protocols []string
+	for _, value := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(value, ",") {
+			if protocol = strings.TrimSpace(protocol); protocol != "" {
+				protocols = append(protocols, protocol)
+			}
+		}
+	}
+
+	for i, protocol := range protocols {
+		if protocol == wsTokenProtocol && i+1 < len(protocols) {
+			return protocols[i+1], wsTokenProtocol
+		}
+	}
+	return "", ""
+}
+
+// ==================== WebSocket 请求与订阅 ====================
+
+// wsNodeRequest 节点相关请求参数
+type wsNodeRequest struct {
+	NodeID uint   `json:"node_id"`
+	Range  string `json:"range"`
+}
+
+// wsOrderRequest 订单相关请求参数
+type wsOrderRequest struct {
+	OrderID uint `json:"order_id"`
+}
+
+// registerRoutes 注册 WebSocket 请求类型与主题
+// 主题: node:<id> 节点探测结果, instances 自己的规则流量, order:<id> 自己的订单状态
+func (h *WSHandler) registerRoutes(router *websocket.Router) {
+	router.SetTopicResolver(h.resolveTopic)
+
+	router.Handle("nodes.list", 0, func(session *websocket.Session, _ json.RawMessage) (interface{}, error) {
+		return h.nodeService.GetNodes(session.IsAdmin)
+	})
+
+	router.Handle("nodes.uptime", 0, func(session *websocket.Session, payload json.RawMessage) (interface{}, error) {
+		var req wsNodeRequest
+		if err := decodeWSPayload(payload, &req); err != nil {
+			return nil, err
+		}
+		return h.metricService.GetUptimes(req.Range, session.UserID, session.IsAdmin)
+	})
+
+	router.Handle("node.metrics", 0, func(session *websocket.Session, payload json.RawMessage) (interface{}, error) {
+		if !session.IsAdmin {
+			return nil, websocket.NewError(websocket.ErrCodeForbidden, "admin access required")
+		}
+		var req wsNodeRequest
+		if err := decodeWSPayload(payload, &req); err != nil {
+			return nil, err
+		}
+		return h.metricService.GetNodeMetrics(req.NodeID, req.Range)
+	})
+
+	router.Handle("instances.list", 0, func(session *websocket.Session, _ json.RawMessage) (interface{}, error) {
+		return h.instanceService.GetUserInstances(session.UserID)
+	})
+
+	router.Handle("order.get", 0, func(session *websocket.Session, payload json.RawMessage) (interface{}, error) {
+		var req wsOrderRequest
+		if err := decodeWSPayload(payload, &req); err != nil {
+			return nil, err
+		}
+		order, err := h.orderService.GetByID(req.OrderID)
+		if err != nil || (order.UserID != session.UserID && !session.IsAdmin) {
+			return nil, websocket.NewError(websocket.ErrCodeBadRequest, "order not found")
+		}
+		return order, nil
+	})
+}
+
+// resolveTopic 校验订阅权限并返回主题对应的房间
+func (h *WSHandler) resolveTopic(session *websocket.Session, topic string) (string, error) {
+	if topic == "instances" {
+		return websocket.InstancesRoom(session.UserID), nil
+	}
+
+	var id uint
+	switch {
+	case scanTopic(topic, "node:%d", &id):
+		node, err := h.nodeService.GetByID(id)
+		if err != nil {
+			return "", websocket.NewError(websocket.ErrCodeInvalidTopic, "node not found")
+		}
+		// 普通用户只能订阅其用户组可用的节点
+		if !session.IsAdmin {
+			user, err := h.userService.GetUserByID(session.UserID)
+			if err != nil || !h.nodeService.AllowsGroup(node, user.GroupID) {
+				return "", websocket.NewError(websocket.ErrCodeForbidden, "node not found")
+			}
+		}
+		return websocket.NodeRoom(id), nil
+	case scanTopic(topic, "order:%d", &id):
+		order, err := h.orderService.GetByID(id)
+		if err != nil || (order.UserID != session.UserID && !session.IsAdmin) {
+			return "", websocket.NewError(websocket.ErrCodeForbidden, "order not found")
+		}
+		return websocket.OrderRoom(id), nil
+	}
+
+	return "", websocket.NewError(websocket.ErrCodeInvalidTopic, "unknown topic: "+topic)
+}
+
+// scanTopic 按格式解析主题，要求完整匹配
+func scanTopic(topic, format string, id *uint) bool {
+	n, err := fmt.Sscanf(topic, format, id)
+	return err == nil && n == 1 && fmt.Sprintf(format, *id) == topic
+}
+
+// decodeWSPayload 解析请求参数，payload 为空时保留零值
+func decodeWSPayload(payload json.RawMessage, out interface{}) error {
+	if len(payload) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(payload, out); err != nil {
+		return websocket.NewError(websocket.ErrCodeBadRequest, "invalid payload")
+	}
+	return nil
+}
@@ -26,14 +26,7 @@ func InitDB(cfg config.DatabaseConfig) (*gorm.DB, error) {
 		dialector = sqlite.Open(dbName)
 	} else {
 		// Postgres 模式
-		dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=disable TimeZone=Asia/Shanghai",
-			cfg.Host,
-			cfg.Username,
-			cfg.Password,
-			cfg.DbName,
-			cfg.Port,
-		)
-		dialector = postgres.Open(dsn)
+		dialector = postgres.Open(cfg.PostgresDSN())
 	}
 
 	// GORM 日志配置
@@ -43,7 +36,8 @@ func InitDB(cfg config.DatabaseConfig) (*gorm.DB, error) {
 	}
 
 	db, err := gorm.Open(dialector, &gorm.Config{
-		Logger: gormlogger.Default.LogMode(gormLogMode),
+		Logger:         gormlogger.Default.LogMode(gormLogMode),
+		TranslateError: true, // 将唯一约束冲突等转换为 gorm.ErrDuplicatedKey
 	})
 
 	if err != nil {
@@ -17,6 +17,7 @@ func AutoMigrate(db *gorm.DB) error {
 		&model.User{},
 		&model.Node{},
 		&model.Plan{},
+		&model.PlanPrice{},
 		&model.Instance{},
 		&model.Order{},
 		&model.Announcement{},
@@ -24,6 +25,12 @@ func AutoMigrate(db *gorm.DB) error {
 		&model.Setting{},
 		&model.VerifyCode{},
 		&model.InviteRecord{},
+		&model.InstanceEvent{},
+		&model.NodeMetric{},
+		&model.NodeIncident{},
+		&model.PaymentTransaction{},
+		&model.CryptoPayment{},
+		&model.BalanceLog{},
 	)
 
 	if err != nil {
@@ -0,0 +1,46 @@
+package model
+
+// BalanceLog 资金流水 (复式记账，只追加不修改)
+// 每笔业务生成一组共用 TxnNo 的分录：用户账户一条，对手系统账户一条，金额合计为 0
+type BalanceLog struct {
+	Base
+	TxnNo        string  `gorm:"type:varchar(64);index;not null" json:"txn_no"`     // 业务流水号
+	UserID       uint    `gorm:"index" json:"user_id"`                              // 用户ID (系统账户为 0)
+	Account      string  `gorm:"type:varchar(32);index;not null" json:"account"`    // 账户
+	Type         string  `gorm:"type:varchar(32);index;not null" json:"type"`       // 变动类型
+	Amount       float64 `gorm:"type:decimal(10,2);not null" json:"amount"`         // 变动金额 (正数入账，负数出账)
+	BalanceAfter float64 `gorm:"type:decimal(10,2);default:0" json:"balance_after"` // 变动后余额 (系统账户不记录)
+	OrderID      uint    `gorm:"index;default:0" json:"order_id"`                   // 关联订单ID
+	AdminID      uint    `gorm:"default:0" json:"admin_id"`                         // 操作管理员ID
+	Memo         string  `gorm:"type:varchar(255)" json:"memo"`                     // 备注
+}
+
+// TableName 指定表名
+func (BalanceLog) TableName() string {
+	return "balance_logs"
+}
+
+// 用户账户
+const (
+	AccountBalance    = "balance"    // 余额
+	AccountCommission = "commission" // 佣金
+)
+
+// 系统账户 (对手方)
+const (
+	AccountSystemGateway    = "system_gateway"    // 支付网关收付款
+	AccountSystemRevenue    = "system_revenue"    // 套餐销售收入
+	AccountSystemAdjustment = "system_adjustment" // 管理员调账
+	AccountSystemReferral   = "system_referral"   // 邀请返利支出
+)
+
+// 资金变动类型
+const (
+	BalanceTypeRecharge       = "recharge"        // 在线充值
+	BalanceTypeRechargeRefund = "recharge_refund" // 充值退款扣回
+	BalanceTypePurchase       = "purchase"        // 余额购买
+	BalanceTypeRefund         = "refund"          // 余额支付订单退款
+	BalanceTypeAdminCharge    = "admin_charge"    // 管理员充值
+	BalanceTypeAdminAdjust    = "admin_adjust"    // 管理员修改余额
+	BalanceTypeCommission     = "commission"      // 邀请返利
+)
@@ -25,6 +25,7 @@ type Coupon struct {
 
 	// 适用范围
 	PlanIDs string `gorm:"type:varchar(255)" json:"plan_ids"` // 适用套餐ID列表 (逗号分隔, 空表示全部)
+	Periods string `gorm:"type:varchar(100)" json:"periods"`  // 适用计费周期列表 (逗号分隔, 空表示全部)
 
 	// 有效期
 	StartAt   *time.Time `json:"start_at"`   // 开始时间
@@ -0,0 +1,36 @@
+package model
+
+import "time"
+
+// CryptoPayment USDT 订单报价，记录分配的收款地址、应付数量与链上到账情况
+type CryptoPayment struct {
+	Base
+	OrderNo  string  `gorm:"type:varchar(64);index;not null" json:"order_no"` // 订单号
+	Network  string  `gorm:"type:varchar(16);index;not null" json:"network"`  // 链网络: trc20, erc20
+	Address  string  `gorm:"type:varchar(64);not null" json:"address"`        // 收款地址
+	Amount   int64   `gorm:"not null" json:"amount"`                          // 应付数量 (最小单位 1e-6)
+	Received int64   `gorm:"default:0" json:"received"`                       // 已收到数量
+	CNY      float64 `gorm:"type:decimal(10,2);not null" json:"cny"`          // 对应人民币金额
+	Rate     float64 `gorm:"type:decimal(10,4);not null" json:"rate"`         // 汇率 (CNY/USDT)
+	TxHashes string  `gorm:"type:text" json:"tx_hashes"`                      // 已计入的交易哈希，逗号分隔
+
+	// PendingKey 待支付或已失效未过期时为 "网络:地址:数量"，唯一索引保证同一地址上仍在确认到账的报价金额不重复，结束后置空
+	PendingKey *string `gorm:"type:varchar(128);uniqueIndex" json:"-"`
+
+	// 状态: 0-待支付 1-已支付 2-已过期 (含少付) 3-已失效 (订单重新报价，过期前仍确认到账)
+	Status    int       `gorm:"default:0;index" json:"status"`
+	ExpiresAt time.Time `gorm:"index" json:"expires_at"` // 报价过期时间
+}
+
+// TableName 指定表名
+func (CryptoPayment) TableName() string {
+	return "crypto_payments"
+}
+
+// USDT 报价状态
+const (
+	CryptoPaymentPending    = 0 // 待支付
+	CryptoPaymentPaid       = 1 // 已支付
+	CryptoPaymentExpired    = 2 // 已过期
+	CryptoPaymentSuperseded = 3 // 已失效
+)
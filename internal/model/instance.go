@@ -3,18 +3,42 @@ package model
 // Instance 转发实例模型 (记录用户在节点上的具体端口分配)
 type Instance struct {
 	Base
-	UserID uint `gorm:"index;not null" json:"user_id"`
-	NodeID uint `gorm:"index;not null" json:"node_id"`
+	UserID uint   `gorm:"index;not null" json:"user_id"`
+	NodeID uint   `gorm:"index;not null;uniqueIndex:idx_instance_node_port,where:deleted_at IS NULL" json:"node_id"`
+	Name   string `gorm:"type:varchar(100)" json:"name"` // 规则备注
 
 	// 分配的端口信息
-	ServerPort int    `gorm:"not null" json:"server_port"` // 外部端口
+	ServerPort int    `gorm:"not null;uniqueIndex:idx_instance_node_port,where:deleted_at IS NULL" json:"server_port"` // 外部端口 (同一节点唯一)
 	Password   string `gorm:"type:varchar(255)" json:"password"`
 	Method     string `gorm:"type:varchar(50);default:'aes-256-gcm'" json:"method"`
 	Protocol   string `gorm:"type:varchar(20);default:'shadowsocks'" json:"protocol"` // shadowsocks, vmess, trojan
 
+	// 转发目标
+	TargetAddress string `gorm:"type:varchar(255)" json:"target_address"` // 目标 IP 地址 (早期规则可能为域名)
+	TargetPort    int    `gorm:"default:0" json:"target_port"`            // 目标端口
+
+	// NodePass Master 侧信息
+	NodePassID string `gorm:"type:varchar(64);index" json:"nodepass_id"`        // Master 返回的实例 ID
+	Status     string `gorm:"type:varchar(20);default:'pending'" json:"status"` // pending, running, stopped, error
+	LastError  string `gorm:"type:varchar(255)" json:"last_error"`              // 最近一次下发失败原因
+
+	// 流量统计 (单位: Bytes)
+	Upload   int64 `gorm:"default:0" json:"upload"`   // 累计上传 (已乘节点倍率)
+	Download int64 `gorm:"default:0" json:"download"` // 累计下载 (已乘节点倍率)
+	LastRx   int64 `gorm:"default:0" json:"-"`        // 上次采集到的节点接收计数
+	LastTx   int64 `gorm:"default:0" json:"-"`        // 上次采集到的节点发送计数
+
 	// 状态
 	Enable bool `gorm:"default:true" json:"enable"`
 
+	// 强制停用 (超额、到期、封禁)，与用户主动停用 Enable 相互独立
+	Suspended     bool   `gorm:"default:false;index" json:"suspended"`
+	SuspendReason string `gorm:"type:varchar(32)" json:"suspend_reason"`
+
+	// 故障迁移：规则被迁出原节点时记录原节点与原端口，迁回后清零
+	OriginNodeID uint `gorm:"default:0;index" json:"origin_node_id"`
+	OriginPort   int  `gorm:"default:0" json:"origin_port"`
+
 	// 关联
 	User User `gorm:"foreignKey:UserID" json:"-"`
 	Node Node `gorm:"foreignKey:NodeID" json:"-"`
@@ -24,3 +48,11 @@ type Instance struct {
 func (Instance) TableName() string {
 	return "instances"
 }
+
+// 实例状态常量
+const (
+	InstanceStatusPending = "pending" // 待下发
+	InstanceStatusRunning = "running" // 运行中
+	InstanceStatusStopped = "stopped" // 已停止
+	InstanceStatusError   = "error"   // 异常
+)
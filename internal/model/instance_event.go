@@ -0,0 +1,38 @@
+package model
+
+// InstanceEvent 转发实例状态变更记录
+type InstanceEvent struct {
+	Base
+	InstanceID uint   `gorm:"index;not null" json:"instance_id"`
+	UserID     uint   `gorm:"index;not null" json:"user_id"`
+	NodeID     uint   `gorm:"index;not null" json:"node_id"`
+	Action     string `gorm:"type:varchar(20);not null" json:"action"` // suspend, resume, failover, failback
+	Reason     string `gorm:"type:varchar(32);not null" json:"reason"` // 见 InstanceReason 常量
+	Success    bool   `gorm:"default:true" json:"success"`             // 节点侧操作是否成功
+	Error      string `gorm:"type:varchar(255)" json:"error"`          // 失败原因
+}
+
+// TableName 指定表名
+func (InstanceEvent) TableName() string {
+	return "instance_events"
+}
+
+// 实例状态变更动作
+const (
+	InstanceActionSuspend  = "suspend"  // 强制停用
+	InstanceActionResume   = "resume"   // 恢复
+	InstanceActionFailover = "failover" // 故障迁出
+	InstanceActionFailback = "failback" // 迁回原节点
+)
+
+// 实例状态变更原因
+const (
+	InstanceReasonQuotaExceeded = "quota_exceeded" // 流量超额
+	InstanceReasonExpired       = "expired"        // 套餐到期
+	InstanceReasonBanned        = "banned"         // 用户被封禁
+	InstanceReasonPlanPurchased = "plan_purchased" // 购买套餐
+	InstanceReasonUnbanned      = "unbanned"       // 管理员解封
+	InstanceReasonRestored      = "restored"       // 额度/有效期恢复
+	InstanceReasonNodeDown      = "node_down"      // 节点故障
+	InstanceReasonNodeRecovered = "node_recovered" // 节点恢复
+)
@@ -23,6 +23,15 @@ type Node struct {
 	Rate    float64 `gorm:"type:decimal(5,2);default:1.0" json:"rate"`     // 流量倍率
 	Sort    int     `gorm:"default:0" json:"sort"`                         // 排序权重 (大在前)
 
+	// 端口分配
+	PortRangeStart int    `gorm:"default:10000" json:"port_range_start"`    // 可分配端口起始
+	PortRangeEnd   int    `gorm:"default:60000" json:"port_range_end"`      // 可分配端口结束
+	ReservedPorts  string `gorm:"type:varchar(1024)" json:"reserved_ports"` // 保留端口 (逗号分隔，支持区间 "22,80,8000-8100")
+
+	// 故障迁移
+	Failover     bool `gorm:"default:false" json:"failover"`      // 节点故障时将规则迁移到同组同地区的在线节点
+	FailoverBack bool `gorm:"default:false" json:"failover_back"` // 节点恢复后将迁出的规则迁回
+
 	// 状态监控 (由定时任务更新)
 	Status     int     `gorm:"default:1" json:"status"`      // 1:在线 0:离线/故障
 	OnlineUser int     `gorm:"default:0" json:"online_user"` // 当前在线用户数
@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// NodeIncident 节点故障记录
+type NodeIncident struct {
+	Base
+	NodeID     uint       `gorm:"index;not null" json:"node_id"`
+	NodeName   string     `gorm:"type:varchar(64)" json:"node_name"`
+	Status     string     `gorm:"type:varchar(20);index;not null" json:"status"` // open, resolved
+	StartedAt  time.Time  `gorm:"not null" json:"started_at"`                    // 首次探测失败时间
+	ResolvedAt *time.Time `json:"resolved_at"`                                   // 恢复时间
+	Duration   int64      `gorm:"default:0" json:"duration"`                     // 故障持续时长 (秒)，恢复后写入
+	FailCount  int        `gorm:"default:0" json:"fail_count"`                   // 故障期间累计失败探测次数
+	LastError  string     `gorm:"type:varchar(255)" json:"last_error"`           // 最近一次探测错误
+	Flapping   bool       `gorm:"default:false" json:"flapping"`                 // 是否判定为抖动 (已抑制通知)
+	Notified   bool       `gorm:"default:false" json:"notified"`                 // 故障通知是否已发送
+}
+
+// TableName 指定表名
+func (NodeIncident) TableName() string {
+	return "node_incidents"
+}
+
+// 节点故障状态
+const (
+	NodeIncidentOpen     = "open"     // 故障中
+	NodeIncidentResolved = "resolved" // 已恢复
+)
@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+// NodeMetric 节点监控时序数据
+// 每次探测同时累加到 raw / 5m / 1h 三种粒度的桶中，按粒度分别设置保留期
+type NodeMetric struct {
+	ID         uint      `gorm:"primarykey" json:"-"`
+	NodeID     uint      `gorm:"not null;uniqueIndex:idx_node_metric_bucket,priority:1" json:"node_id"`
+	Resolution string    `gorm:"type:varchar(8);not null;uniqueIndex:idx_node_metric_bucket,priority:2" json:"resolution"` // raw, 5m, 1h
+	Time       time.Time `gorm:"not null;uniqueIndex:idx_node_metric_bucket,priority:3;index" json:"time"`                 // 桶起始时间 (raw 为采样时间)
+
+	Samples       int     `gorm:"default:0" json:"samples"`         // 采样次数
+	UpSamples     int     `gorm:"default:0" json:"up_samples"`      // 在线采样次数
+	PingSum       float64 `gorm:"default:0" json:"-"`               // 在线采样延迟之和 (ms)
+	LoadSum       float64 `gorm:"default:0" json:"-"`               // 在线采样负载之和
+	MaxOnlineUser int     `gorm:"default:0" json:"max_online_user"` // 桶内最大在线用户数
+}
+
+// TableName 指定表名
+func (NodeMetric) TableName() string {
+	return "node_metrics"
+}
+
+// 时序数据粒度
+const (
+	MetricResolutionRaw = "raw" // 原始采样，保留 24 小时
+	MetricResolution5m  = "5m"  // 5 分钟汇总，保留 30 天
+	MetricResolution1h  = "1h"  // 1 小时汇总，长期保留
+)
@@ -6,7 +6,7 @@ import "time"
 type Order struct {
 	Base
 	OrderNo   string  `gorm:"type:varchar(64);uniqueIndex;not null" json:"order_no"` // 订单号
-	Type      string  `gorm:"type:varchar(20);default:'plan'" json:"type"`           // 订单类型: plan, recharge
+	Type      string  `gorm:"type:varchar(20);default:'plan'" json:"type"`           // 订单类型: plan, recharge, upgrade
 	UserID    uint    `gorm:"index;not null" json:"user_id"`                         // 用户ID
 	PlanID    *uint   `gorm:"index" json:"plan_id"`                                  // 套餐ID (可选)
 	CouponID  *uint   `gorm:"index" json:"coupon_id"`                                // 优惠券ID (可选)
@@ -15,8 +15,26 @@ type Order struct {
 	Amount    float64 `gorm:"type:decimal(10,2);not null" json:"amount"`             // 订单金额
 	Discount  float64 `gorm:"type:decimal(10,2);default:0" json:"discount"`          // 优惠金额
 	Paid      float64 `gorm:"type:decimal(10,2);default:0" json:"paid"`              // 实付金额
+	Refunded  float64 `gorm:"type:decimal(10,2);default:0" json:"refunded"`          // 累计退款金额
+	Fee       float64 `gorm:"type:decimal(10,2);default:0" json:"fee"`               // 网关手续费 (用户承担，不计入实付与退款)
+	Credit    float64 `gorm:"type:decimal(10,2);default:0" json:"credit"`            // 套餐变更时原套餐剩余价值抵扣金额
 
-	// 状态: 0-待支付 1-已支付 2-已取消 3-已退款
+	// 计费周期与流量重置策略 (下单时的快照，价格调整不影响已下单的订单)
+	Period      string `gorm:"type:varchar(20)" json:"period"`
+	ResetPolicy string `gorm:"type:varchar(20)" json:"reset_policy"`
+
+	// 支付完成时发放的权益，退款时按比例收回
+	GrantedDays     int   `gorm:"default:0" json:"granted_days"`     // 增加的有效天数
+	GrantedTransfer int64 `gorm:"default:0" json:"granted_transfer"` // 增加的流量 (Bytes)
+	PrevGroupID     int   `gorm:"default:0" json:"prev_group_id"`    // 支付前的用户组，全额退款时恢复
+
+	// 套餐变更订单支付前的有效期与流量，全额退款时恢复
+	PrevExpiredAt      *time.Time `json:"prev_expired_at"`
+	PrevTransferEnable int64      `gorm:"default:0" json:"prev_transfer_enable"`
+
+	CouponReserved bool `gorm:"default:false" json:"-"` // 创建时已占用优惠券次数，取消时释放
+
+	// 状态: 0-待支付 1-已支付 (含部分退款) 2-已取消 3-已退款 (全额) 4-过期后支付 (待审核)
 	Status int `gorm:"default:0;index" json:"status"`
 
 	// 时间
@@ -44,6 +62,13 @@ const (
 	OrderStatusCancelled = 2 // 已取消
 	OrderStatusRefunded  = 3 // 已退款
 
+	// OrderStatusPaidAfterExpiry 订单过期或取消后才收到网关付款，或付款金额、币种与订单不符，未发放权益，由管理员确认发放或退款
+	OrderStatusPaidAfterExpiry = 4
+
+	// OrderStatusRefunding 正在调用网关原路退款；网关已退款但订单未能完成更新时保持此状态，由管理员核对
+	OrderStatusRefunding = 5
+
 	OrderTypePlan     = "plan"     // 套餐订单
 	OrderTypeRecharge = "recharge" // 充值订单
+	OrderTypeUpgrade  = "upgrade"  // 套餐变更订单 (升级或降级)，按原套餐剩余价值抵扣
 )
@@ -0,0 +1,35 @@
+package model
+
+// PaymentTransaction 支付网关交互记录，用于与网关对账
+type PaymentTransaction struct {
+	Base
+	OrderID  uint    `gorm:"index" json:"order_id"`                      // 订单ID (回调验签失败无法关联订单时为 0)
+	OrderNo  string  `gorm:"type:varchar(64);index" json:"order_no"`     // 订单号
+	Method   string  `gorm:"type:varchar(32)" json:"method"`             // 支付方式
+	Action   string  `gorm:"type:varchar(20);not null" json:"action"`    // pay, notify, manual, refund
+	Amount   float64 `gorm:"type:decimal(10,2);default:0" json:"amount"` // 发起或网关确认的金额
+	Fee      float64 `gorm:"type:decimal(10,2);default:0" json:"fee"`    // 发起支付时按网关计算的手续费
+	Currency string  `gorm:"type:varchar(10)" json:"currency"`           // 网关确认的币种
+	TradeNo  string  `gorm:"type:varchar(128)" json:"trade_no"`          // 第三方交易号
+	ClientIP string  `gorm:"type:varchar(46)" json:"client_ip"`          // 发起支付的客户端 IP
+
+	Request  string `gorm:"type:text" json:"request"`      // 发起支付请求 (JSON)
+	PayURL   string `gorm:"type:text" json:"pay_url"`      // 网关返回的跳转地址/二维码/表单
+	Payload  string `gorm:"type:text" json:"payload"`      // 回调原始参数 (JSON)
+	Verified bool   `gorm:"default:false" json:"verified"` // 回调是否通过验签
+	Success  bool   `gorm:"default:false" json:"success"`  // 本次交互是否处理成功
+	Error    string `gorm:"type:text" json:"error"`        // 失败原因
+}
+
+// TableName 指定表名
+func (PaymentTransaction) TableName() string {
+	return "payment_transactions"
+}
+
+// 支付交互类型
+const (
+	PaymentActionPay    = "pay"    // 发起支付
+	PaymentActionNotify = "notify" // 网关回调
+	PaymentActionManual = "manual" // 管理员手动标记已支付
+	PaymentActionRefund = "refund" // 退款
+)
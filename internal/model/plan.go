@@ -1,15 +1,17 @@
 package model
 
+import "time"
+
 // Plan 套餐模型
 type Plan struct {
 	Base
 	Name        string  `gorm:"type:varchar(100);not null" json:"name"`
 	Description string  `gorm:"type:text" json:"description"`
-	Price       float64 `gorm:"type:decimal(10,2);not null" json:"price"`
+	Price       float64 `gorm:"type:decimal(10,2);not null" json:"price"` // 起价 (由计费周期同步，用于展示)
 
 	// 限制
-	Duration    int   `gorm:"not null" json:"duration"`      // 有效期(天)
-	Transfer    int64 `gorm:"not null" json:"transfer"`      // 流量限制(GB)
+	Duration    int   `gorm:"not null" json:"duration"`      // 起价周期的有效期(天)
+	Transfer    int64 `gorm:"not null" json:"transfer"`      // 流量限制(GB)，按月重置的周期为每月流量
 	SpeedLimit  int   `gorm:"default:0" json:"speed_limit"`  // 速度限制(Mbps, 0不限)
 	DeviceLimit int   `gorm:"default:0" json:"device_limit"` // 设备数限制
 
@@ -17,9 +19,45 @@ type Plan struct {
 	GroupID int  `gorm:"default:1" json:"group_id"`   // 赋予的用户组/等级
 	Hidden  bool `gorm:"default:false" json:"hidden"` // 是否隐藏
 	Sort    int  `gorm:"default:0" json:"sort"`
+
+	// 计费周期
+	Prices []PlanPrice `gorm:"foreignKey:PlanID" json:"prices"`
 }
 
 // TableName 指定表名
 func (Plan) TableName() string {
 	return "plans"
 }
+
+// PlanPrice 套餐计费周期价格
+type PlanPrice struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	PlanID      uint      `gorm:"uniqueIndex:idx_plan_period;not null" json:"plan_id"`
+	Period      string    `gorm:"type:varchar(20);uniqueIndex:idx_plan_period;not null" json:"period"` // 计费周期
+	Price       float64   `gorm:"type:decimal(10,2);not null" json:"price"`                            // 价格
+	Duration    int       `gorm:"not null" json:"duration"`                                            // 有效期(天)，流量包为 0
+	ResetPolicy string    `gorm:"type:varchar(20);default:'none'" json:"reset_policy"`                 // 流量重置策略
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (PlanPrice) TableName() string {
+	return "plan_prices"
+}
+
+// 计费周期
+const (
+	PeriodMonthly    = "monthly"     // 月付
+	PeriodQuarterly  = "quarterly"   // 季付
+	PeriodHalfYearly = "half_yearly" // 半年付
+	PeriodYearly     = "yearly"      // 年付
+	PeriodOnetime    = "onetime"     // 一次性流量包 (不增加时长)
+)
+
+// 流量重置策略
+const (
+	TrafficResetNone     = "none"     // 不重置，流量累加到剩余额度
+	TrafficResetPurchase = "purchase" // 购买时清零已用流量并重置为套餐流量
+	TrafficResetMonthly  = "monthly"  // 购买时重置，有效期内每月重置
+)
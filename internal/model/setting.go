@@ -23,6 +23,11 @@ const (
 	SettingKeySiteDescription = "site_description" // 站点描述
 	SettingKeyContactTelegram = "contact_telegram" // Telegram 客服
 	SettingKeyContactEmail    = "contact_email"    // 邮箱客服
+	SettingKeySiteURL         = "site_url"         // 站点对外访问地址 (为空使用配置文件 site.base_url)
+
+	// 支付设置
+	SettingKeyPaymentReturnPath = "payment_return_path" // 支付完成后跳转的前端路径模板 (为空使用配置文件 site.return_path)
+	SettingKeyAutoRenewDays     = "auto_renew_days"     // 到期前多少天自动续费
 
 	// 功能开关
 	SettingKeyRegisterEnabled = "register_enabled" // 是否开放注册
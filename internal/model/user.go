@@ -20,12 +20,21 @@ type User struct {
 	Download       int64 `gorm:"default:0" json:"download"`
 	TransferEnable int64 `gorm:"default:0" json:"transfer_enable"`
 
+	// 下次按月重置流量的时间 (套餐按月重置流量时有效)
+	TrafficResetAt *time.Time `json:"traffic_reset_at"`
+
 	// 状态与权限
 	Status    int        `gorm:"default:1" json:"status"`
 	IsAdmin   bool       `gorm:"default:false" json:"is_admin"`
 	GroupID   int        `gorm:"default:1" json:"group_id"`
 	ExpiredAt *time.Time `json:"expired_at"`
 
+	// 自动续费：到期前从余额续费当前套餐，余额不足时按退避间隔重试
+	AutoRenew         bool       `gorm:"default:false" json:"auto_renew"`
+	AutoRenewFailures int        `gorm:"default:0" json:"auto_renew_failures"` // 连续失败次数
+	AutoRenewRetryAt  *time.Time `json:"auto_renew_retry_at"`                  // 下次重试时间
+	AutoRenewCycle    *time.Time `json:"-"`                                    // 已发起续费的到期时间，同一到期时间只续费一次
+
 	// 邀请系统
 	InviteCode string `gorm:"type:varchar(32);uniqueIndex" json:"invite_code"`
 	InvitedBy  uint   `gorm:"index" json:"invited_by"`
@@ -0,0 +1,254 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"nodepassPanel/internal/payment"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	payment.Register(&payment.Gateway{
+		Name:        "usdt",
+		DisplayName: "USDT",
+		Methods: []payment.Method{
+			{Method: payment.MethodUSDTTRC20, Label: "USDT (TRC20)"},
+			{Method: payment.MethodUSDTERC20, Label: "USDT (ERC20)"},
+		},
+		Schema: []payment.Field{
+			{Key: "rate", Label: "汇率 (CNY/USDT)", Type: payment.FieldString, Required: true, Help: "如 7.2，订单金额按此汇率换算"},
+			{Key: "trc20_addresses", Label: "TRC20 收款地址", Type: payment.FieldString, Help: "多个地址用逗号分隔，空闲地址独占分配，为空不启用 TRC20"},
+			{Key: "erc20_addresses", Label: "ERC20 收款地址", Type: payment.FieldString, Help: "多个地址用逗号分隔，空闲地址独占分配，为空不启用 ERC20"},
+			{Key: "expire_minutes", Label: "报价有效期 (分钟)", Type: payment.FieldString, Help: "默认 30"},
+			{Key: "trongrid_api_key", Label: "TronGrid API Key", Type: payment.FieldSecret},
+			{Key: "etherscan_api_key", Label: "Etherscan API Key", Type: payment.FieldSecret, Help: "使用 ERC20 时必填"},
+		},
+		New: func(cfg *payment.GatewayConfig) payment.PaymentStrategy {
+			return NewUSDT(cfg, defaultStore, NewExplorerWatcher(ExplorerConfig{
+				TronGridAPIKey:  cfg.Credential("trongrid_api_key"),
+				EtherscanAPIKey: cfg.Credential("etherscan_api_key"),
+			}))
+		},
+	})
+}
+
+// Network 链网络
+type Network string
+
+const (
+	NetworkTRC20 Network = "trc20"
+	NetworkERC20 Network = "erc20"
+)
+
+// Decimals USDT 在 TRC20 与 ERC20 上的精度均为 6 位
+const Decimals = 6
+
+const (
+	unit           = 1_000_000 // 1 USDT
+	offsetStep     = 10_000    // 共用地址时每笔报价递增 0.01 USDT 以区分订单
+	maxOffsets     = 100       // 单个地址最多同时存在的共用报价
+	defaultExpires = 30 * time.Minute
+)
+
+// ErrNoAddress 没有可分配的收款地址或金额
+var ErrNoAddress = errors.New("no usdt receiving address available")
+
+// NetworkOf 支付方式对应的链网络
+func NetworkOf(method payment.PaymentMethod) (Network, bool) {
+	switch method {
+	case payment.MethodUSDTTRC20:
+		return NetworkTRC20, true
+	case payment.MethodUSDTERC20:
+		return NetworkERC20, true
+	}
+	return "", false
+}
+
+// MethodOf 链网络对应的支付方式
+func MethodOf(network Network) payment.PaymentMethod {
+	return payment.PaymentMethod("usdt_" + string(network))
+}
+
+// FormatAmount 格式化 USDT 数量 (最小单位 -> 6 位小数)
+func FormatAmount(amount int64) string {
+	return strconv.FormatFloat(float64(amount)/unit, 'f', Decimals, 64)
+}
+
+// Quote 订单的 USDT 报价
+type Quote struct {
+	OrderNo   string
+	Network   Network
+	Address   string    // 收款地址
+	Amount    int64     // 应付数量 (最小单位 1e-6)，同一地址上的待支付报价互不相同
+	CNY       float64   // 对应的人民币金额
+	Rate      float64   // 汇率 (CNY/USDT)
+	Received  int64     // 已收到的数量
+	TxHashes  []string  // 已计入的交易
+	CreatedAt time.Time // 报价时间，之前的转账不计入
+	ExpiresAt time.Time // 过期时间，之后的转账不计入
+}
+
+// Paid 是否已收到足额付款
+func (q *Quote) Paid() bool {
+	return q.Received >= q.Amount
+}
+
+// Store 报价存储
+type Store interface {
+	// Reserve 为订单保存报价：订单已有同网络未过期的报价时直接返回；
+	// 否则以该网络所有待支付报价调用 allocate 选择地址与金额，保存新报价并使订单的旧报价失效
+	Reserve(q *Quote, allocate func(pending []*Quote) (address string, amount int64, err error)) (*Quote, error)
+	// Get 获取订单报价：优先返回已足额到账待确认的报价 (含被新报价替代的旧报价)，否则返回最近一次报价
+	Get(orderNo string) (*Quote, error)
+}
+
+var defaultStore Store
+
+// SetStore 设置网关使用的报价存储，由服务层在启动时注入
+func SetStore(store Store) {
+	defaultStore = store
+}
+
+// USDT USDT 收款网关
+type USDT struct {
+	Addresses map[Network][]string
+	Rate      float64
+	Expires   time.Duration
+	Store     Store
+	Watcher   Watcher
+}
+
+// NewUSDT 根据网关配置创建 USDT 网关
+func NewUSDT(cfg *payment.GatewayConfig, store Store, watcher Watcher) *USDT {
+	u := &USDT{
+		Addresses: map[Network][]string{
+			NetworkTRC20: splitAddresses(cfg.Credential("trc20_addresses")),
+			NetworkERC20: splitAddresses(cfg.Credential("erc20_addresses")),
+		},
+		Expires: defaultExpires,
+		Store:   store,
+		Watcher: watcher,
+	}
+	u.Rate, _ = strconv.ParseFloat(cfg.Credential("rate"), 64)
+	if minutes, err := strconv.Atoi(cfg.Credential("expire_minutes")); err == nil && minutes > 0 {
+		u.Expires = time.Duration(minutes) * time.Minute
+	}
+	return u
+}
+
+func splitAddresses(value string) []string {
+	var addresses []string
+	for _, address := range strings.Split(value, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
+
+// Pay 按汇率换算金额并分配收款地址
+func (u *USDT) Pay(req *payment.PayRequest) (*payment.PayResponse, error) {
+	network, ok := NetworkOf(req.Method)
+	if !ok {
+		return nil, fmt.Errorf("unsupported method: %s", req.Method)
+	}
+	addresses := u.Addresses[network]
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("%s 未配置收款地址", network)
+	}
+	if u.Rate <= 0 {
+		return nil, errors.New("usdt 汇率未配置")
+	}
+	if u.Store == nil {
+		return nil, errors.New("usdt store not initialized")
+	}
+
+	// 向上取整到 0.01 USDT，保证不少收
+	base := int64(math.Ceil(req.Amount/u.Rate*100-1e-9)) * offsetStep
+	// 报价不晚于订单支付期限，避免订单超时取消后报价仍在收款
+	now := time.Now()
+	expires := now.Add(u.Expires)
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(expires) {
+		expires = *req.ExpiresAt
+	}
+	quote, err := u.Store.Reserve(&Quote{
+		OrderNo:   req.OrderID,
+		Network:   network,
+		CNY:       req.Amount,
+		Rate:      u.Rate,
+		CreatedAt: now,
+		ExpiresAt: expires,
+	}, func(pending []*Quote) (string, int64, error) {
+		return Allocate(addresses, base, pending)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &payment.PayResponse{
+		PayURL:      quote.Address,
+		ContentType: "crypto",
+		Crypto: &payment.CryptoInfo{
+			Network:   string(quote.Network),
+			Address:   quote.Address,
+			Amount:    FormatAmount(quote.Amount),
+			Rate:      quote.Rate,
+			ExpiresAt: quote.ExpiresAt,
+		},
+	}, nil
+}
+
+// Allocate 选择收款地址与金额：优先独占空闲地址，全部占用时在共用地址上递增金额区分订单
+func Allocate(addresses []string, base int64, pending []*Quote) (string, int64, error) {
+	used := make(map[string]map[int64]bool)
+	for _, q := range pending {
+		if used[q.Address] == nil {
+			used[q.Address] = make(map[int64]bool)
+		}
+		used[q.Address][q.Amount] = true
+	}
+
+	for _, address := range addresses {
+		if len(used[address]) == 0 {
+			return address, base, nil
+		}
+	}
+	for i := int64(0); i < maxOffsets; i++ {
+		amount := base + i*offsetStep
+		for _, address := range addresses {
+			if !used[address][amount] {
+				return address, amount, nil
+			}
+		}
+	}
+	return "", 0, ErrNoAddress
+}
+
+// Verify 确认订单报价已收到足额付款 (由链上监听在归属转账后触发)
+// 多付时按报价金额确认，超出部分由服务层记录
+func (u *USDT) Verify(params map[string]string) (*payment.NotifyResult, error) {
+	if u.Store == nil {
+		return nil, errors.New("usdt store not initialized")
+	}
+	quote, err := u.Store.Get(params["order_no"])
+	if err != nil {
+		return nil, fmt.Errorf("quote not found: %v", err)
+	}
+	if !quote.Paid() {
+		return nil, fmt.Errorf("underpaid: received %s of %s USDT", FormatAmount(quote.Received), FormatAmount(quote.Amount))
+	}
+
+	var tradeNo string
+	if len(quote.TxHashes) > 0 {
+		tradeNo = quote.TxHashes[len(quote.TxHashes)-1]
+	}
+	return &payment.NotifyResult{
+		OrderID:  quote.OrderNo,
+		Amount:   quote.CNY,
+		Currency: payment.CurrencyCNY,
+		TradeNo:  tradeNo,
+	}, nil
+}
@@ -0,0 +1,214 @@
+package crypto
+
+import (
+	"context"
+	"errors"
+	"nodepassPanel/internal/payment"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memStore 内存报价存储
+type memStore struct {
+	mu     sync.Mutex
+	quotes map[string]*Quote
+}
+
+func newMemStore() *memStore {
+	return &memStore{quotes: make(map[string]*Quote)}
+}
+
+func (s *memStore) Reserve(q *Quote, allocate func(pending []*Quote) (string, int64, error)) (*Quote, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var pending []*Quote
+	for orderNo, existing := range s.quotes {
+		if existing.Network == q.Network && orderNo != q.OrderNo && !existing.Paid() {
+			pending = append(pending, existing)
+		}
+	}
+	address, amount, err := allocate(pending)
+	if err != nil {
+		return nil, err
+	}
+	q.Address, q.Amount = address, amount
+	s.quotes[q.OrderNo] = q
+	return q, nil
+}
+
+func (s *memStore) Get(orderNo string) (*Quote, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, ok := s.quotes[orderNo]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return q, nil
+}
+
+func newTestUSDT(store Store, watcher Watcher, addresses string) *USDT {
+	return NewUSDT(&payment.GatewayConfig{Credentials: map[string]string{
+		"rate":            "7.2",
+		"trc20_addresses": addresses,
+	}}, store, watcher)
+}
+
+func pay(t *testing.T, u *USDT, orderNo string, amount float64) *Quote {
+	t.Helper()
+	resp, err := u.Pay(&payment.PayRequest{OrderID: orderNo, Amount: amount, Method: payment.MethodUSDTTRC20})
+	if err != nil {
+		t.Fatalf("pay %s: %v", orderNo, err)
+	}
+	if resp.ContentType != "crypto" || resp.Crypto == nil {
+		t.Fatalf("content type = %s, want crypto", resp.ContentType)
+	}
+	q, _ := u.Store.Get(orderNo)
+	return q
+}
+
+// settle 模拟链上监听：归属转账并累加到账数量
+func settle(t *testing.T, u *USDT, store *memStore) {
+	t.Helper()
+	var pending []*Quote
+	for _, q := range store.quotes {
+		if !q.Paid() {
+			pending = append(pending, q)
+		}
+	}
+	var transfers []Transfer
+	for _, address := range u.Addresses[NetworkTRC20] {
+		found, err := u.Watcher.Transfers(context.Background(), NetworkTRC20, address, time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		transfers = append(transfers, found...)
+	}
+	for q, matched := range Match(pending, transfers) {
+		for _, tr := range matched {
+			q.Received += tr.Amount
+			q.TxHashes = append(q.TxHashes, tr.Hash)
+		}
+	}
+}
+
+func TestPayConvertsAndAllocatesAddresses(t *testing.T) {
+	store := newMemStore()
+	u := newTestUSDT(store, NewFakeWatcher(), "TA, TB")
+
+	// 72 CNY / 7.2 = 10 USDT；10.01 CNY 向上取整为 1.40 USDT
+	a := pay(t, u, "A", 72)
+	b := pay(t, u, "B", 72)
+	c := pay(t, u, "C", 72)
+	d := pay(t, u, "D", 10.01)
+
+	if a.Address != "TA" || a.Amount != 10*unit {
+		t.Fatalf("A = %s %s, want TA 10", a.Address, FormatAmount(a.Amount))
+	}
+	if b.Address != "TB" || b.Amount != 10*unit {
+		t.Fatalf("B = %s %s, want TB 10 (free address)", b.Address, FormatAmount(b.Amount))
+	}
+	if c.Address != "TA" || c.Amount != 10*unit+offsetStep {
+		t.Fatalf("C = %s %s, want TA 10.01 (shared address)", c.Address, FormatAmount(c.Amount))
+	}
+	if d.Amount != 1_400_000 {
+		t.Fatalf("D amount = %s, want 1.400000", FormatAmount(d.Amount))
+	}
+}
+
+func TestVerifyExactSharedAddressPayment(t *testing.T) {
+	store := newMemStore()
+	watcher := NewFakeWatcher()
+	u := newTestUSDT(store, watcher, "TA")
+
+	a := pay(t, u, "A", 72)
+	b := pay(t, u, "B", 72)
+
+	// 共用地址上只能按金额区分订单
+	hash := watcher.Send(NetworkTRC20, "TA", b.Amount, time.Now())
+	settle(t, u, store)
+
+	if _, err := u.Verify(map[string]string{"order_no": "A"}); err == nil {
+		t.Fatal("A verified without payment")
+	}
+	result, err := u.Verify(map[string]string{"order_no": "B"})
+	if err != nil {
+		t.Fatalf("verify B: %v", err)
+	}
+	if result.Amount != 72 || result.Currency != payment.CurrencyCNY || result.TradeNo != hash {
+		t.Fatalf("result = %+v", result)
+	}
+	if a.Received != 0 {
+		t.Fatalf("A received %d, want 0", a.Received)
+	}
+}
+
+func TestUnderpaymentAndTopUpOnExclusiveAddress(t *testing.T) {
+	store := newMemStore()
+	watcher := NewFakeWatcher()
+	u := newTestUSDT(store, watcher, "TA")
+
+	q := pay(t, u, "A", 72)
+
+	watcher.Send(NetworkTRC20, "TA", 4*unit, time.Now())
+	settle(t, u, store)
+	if _, err := u.Verify(map[string]string{"order_no": "A"}); err == nil {
+		t.Fatal("underpaid order verified")
+	}
+
+	// 补款后超出部分视为多付
+	watcher.Send(NetworkTRC20, "TA", 7*unit, time.Now())
+	settle(t, u, store)
+	if _, err := u.Verify(map[string]string{"order_no": "A"}); err != nil {
+		t.Fatalf("verify after top-up: %v", err)
+	}
+	if q.Received != 11*unit || len(q.TxHashes) != 2 {
+		t.Fatalf("received %s in %d txs, want 11 in 2", FormatAmount(q.Received), len(q.TxHashes))
+	}
+}
+
+func TestQuoteExpiresWithOrder(t *testing.T) {
+	store := newMemStore()
+	u := newTestUSDT(store, NewFakeWatcher(), "TA")
+
+	deadline := time.Now().Add(5 * time.Minute)
+	resp, err := u.Pay(&payment.PayRequest{OrderID: "A", Amount: 72, Method: payment.MethodUSDTTRC20, ExpiresAt: &deadline})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Crypto.ExpiresAt.Equal(deadline) {
+		t.Fatalf("expires at = %v, want order deadline %v", resp.Crypto.ExpiresAt, deadline)
+	}
+}
+
+func TestMatchIgnoresCountedAndOutOfWindowTransfers(t *testing.T) {
+	now := time.Now()
+	q := &Quote{
+		OrderNo:   "A",
+		Address:   "TA",
+		Amount:    10 * unit,
+		TxHashes:  []string{"counted"},
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Minute),
+	}
+	transfers := []Transfer{
+		{Hash: "counted", To: "TA", Amount: 10 * unit, Time: now},
+		{Hash: "early", To: "TA", Amount: 10 * unit, Time: now.Add(-time.Second)},
+		{Hash: "late", To: "TA", Amount: 10 * unit, Time: now.Add(2 * time.Minute)},
+		{Hash: "other", To: "TB", Amount: 10 * unit, Time: now},
+	}
+	if matched := Match([]*Quote{q}, transfers); len(matched) != 0 {
+		t.Fatalf("matched = %v, want none", matched)
+	}
+}
+
+func TestAllocateExhausted(t *testing.T) {
+	var pending []*Quote
+	for i := int64(0); i < maxOffsets; i++ {
+		pending = append(pending, &Quote{Address: "TA", Amount: unit + i*offsetStep})
+	}
+	if _, _, err := Allocate([]string{"TA"}, unit, pending); !errors.Is(err, ErrNoAddress) {
+		t.Fatalf("err = %v, want ErrNoAddress", err)
+	}
+}
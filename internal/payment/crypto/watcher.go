@@ -0,0 +1,56 @@
+package crypto
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+// Transfer 链上 USDT 转入记录
+type Transfer struct {
+	Hash   string    // 交易哈希
+	From   string    // 付款地址
+	To     string    // 收款地址
+	Amount int64     // 转入数量 (最小单位 1e-6)
+	Time   time.Time // 区块时间
+}
+
+// Watcher 链上转账查询接口，只需返回已达到确认数的转账
+type Watcher interface {
+	// Transfers 查询 since 之后转入 address 的 USDT 转账
+	Transfers(ctx context.Context, network Network, address string, since time.Time) ([]Transfer, error)
+}
+
+// Match 将转账归属到待支付报价，返回 报价 -> 新归属的转账
+// 优先匹配地址与金额完全一致的报价；地址上只有一笔待支付报价时，任意金额的转账都归属于它，用于识别少付、多付与补款
+// 已计入报价的交易、报价创建前或过期后的转账会被忽略
+func Match(pending []*Quote, transfers []Transfer) map[*Quote][]Transfer {
+	byAddress := make(map[string][]*Quote)
+	for _, q := range pending {
+		byAddress[q.Address] = append(byAddress[q.Address], q)
+	}
+
+	matched := make(map[*Quote][]Transfer)
+	for _, t := range transfers {
+		quotes := byAddress[t.To]
+		if slices.ContainsFunc(quotes, func(q *Quote) bool { return slices.Contains(q.TxHashes, t.Hash) }) {
+			continue
+		}
+
+		var target *Quote
+		for _, q := range quotes {
+			if q.Amount == t.Amount {
+				target = q
+				break
+			}
+		}
+		if target == nil && len(quotes) == 1 {
+			target = quotes[0]
+		}
+		if target == nil || t.Time.Before(target.CreatedAt) || t.Time.After(target.ExpiresAt) {
+			continue
+		}
+		matched[target] = append(matched[target], t)
+	}
+	return matched
+}
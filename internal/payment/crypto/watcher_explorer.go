@@ -0,0 +1,208 @@
+package crypto
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// USDT 合约地址
+const (
+	USDTContractTRC20 = "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"
+	USDTContractERC20 = "0xdAC17F958D2ee523a2206206994597C13D831ec7"
+)
+
+// ExplorerConfig 区块浏览器配置
+type ExplorerConfig struct {
+	TronGridURL     string // 默认 https://api.trongrid.io
+	TronGridAPIKey  string
+	EtherscanURL    string // 默认 https://api.etherscan.io/api
+	EtherscanAPIKey string
+	Confirmations   int // ERC20 最少确认数，默认 12 (TronGrid 只返回已固化的交易)
+}
+
+// ExplorerWatcher 通过 TronGrid / Etherscan HTTP 接口查询转账
+type ExplorerWatcher struct {
+	Config ExplorerConfig
+	Client *http.Client
+}
+
+// NewExplorerWatcher 创建区块浏览器监听器
+func NewExplorerWatcher(cfg ExplorerConfig) *ExplorerWatcher {
+	if cfg.TronGridURL == "" {
+		cfg.TronGridURL = "https://api.trongrid.io"
+	}
+	if cfg.EtherscanURL == "" {
+		cfg.EtherscanURL = "https://api.etherscan.io/api"
+	}
+	if cfg.Confirmations <= 0 {
+		cfg.Confirmations = 12
+	}
+	return &ExplorerWatcher{
+		Config: cfg,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Transfers 查询转入地址的 USDT 转账
+func (w *ExplorerWatcher) Transfers(ctx context.Context, network Network, address string, since time.Time) ([]Transfer, error) {
+	switch network {
+	case NetworkTRC20:
+		return w.tronTransfers(ctx, address, since)
+	case NetworkERC20:
+		return w.ethTransfers(ctx, address, since)
+	}
+	return nil, fmt.Errorf("unsupported network: %s", network)
+}
+
+func (w *ExplorerWatcher) getJSON(ctx context.Context, rawURL string, header http.Header, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("explorer returned status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// tronTransfers 查询 TronGrid TRC20 转入记录 (only_confirmed 只返回已固化的交易)
+func (w *ExplorerWatcher) tronTransfers(ctx context.Context, address string, since time.Time) ([]Transfer, error) {
+	query := url.Values{}
+	query.Set("only_to", "true")
+	query.Set("only_confirmed", "true")
+	query.Set("contract_address", USDTContractTRC20)
+	query.Set("min_timestamp", strconv.FormatInt(since.UnixMilli(), 10))
+	query.Set("limit", "200")
+	rawURL := fmt.Sprintf("%s/v1/accounts/%s/transactions/trc20?%s", strings.TrimRight(w.Config.TronGridURL, "/"), address, query.Encode())
+
+	header := http.Header{}
+	if w.Config.TronGridAPIKey != "" {
+		header.Set("TRON-PRO-API-KEY", w.Config.TronGridAPIKey)
+	}
+
+	var result struct {
+		Success bool `json:"success"`
+		Data    []struct {
+			TransactionID  string `json:"transaction_id"`
+			From           string `json:"from"`
+			To             string `json:"to"`
+			Value          string `json:"value"`
+			BlockTimestamp int64  `json:"block_timestamp"`
+		} `json:"data"`
+	}
+	if err := w.getJSON(ctx, rawURL, header, &result); err != nil {
+		return nil, err
+	}
+	if !result.Success {
+		return nil, fmt.Errorf("trongrid request failed")
+	}
+
+	transfers := make([]Transfer, 0, len(result.Data))
+	for _, item := range result.Data {
+		if item.To != address {
+			continue
+		}
+		amount, err := strconv.ParseInt(item.Value, 10, 64)
+		if err != nil {
+			continue
+		}
+		transfers = append(transfers, Transfer{
+			Hash:   item.TransactionID,
+			From:   item.From,
+			To:     address,
+			Amount: amount,
+			Time:   time.UnixMilli(item.BlockTimestamp),
+		})
+	}
+	return transfers, nil
+}
+
+// ethTransfers 查询 Etherscan ERC20 转账记录，过滤转出与确认数不足的交易
+func (w *ExplorerWatcher) ethTransfers(ctx context.Context, address string, since time.Time) ([]Transfer, error) {
+	if w.Config.EtherscanAPIKey == "" {
+		return nil, fmt.Errorf("etherscan api key not configured")
+	}
+
+	query := url.Values{}
+	query.Set("module", "account")
+	query.Set("action", "tokentx")
+	query.Set("contractaddress", USDTContractERC20)
+	query.Set("address", address)
+	query.Set("page", "1")
+	query.Set("offset", "200")
+	query.Set("sort", "desc")
+	query.Set("apikey", w.Config.EtherscanAPIKey)
+	rawURL := w.Config.EtherscanURL + "?" + query.Encode()
+
+	var result struct {
+		Status  string          `json:"status"`
+		Message string          `json:"message"`
+		Result  json.RawMessage `json:"result"`
+	}
+	if err := w.getJSON(ctx, rawURL, nil, &result); err != nil {
+		return nil, err
+	}
+	if result.Status != "1" {
+		// 没有任何转账记录时 status 为 0
+		if result.Message == "No transactions found" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("etherscan request failed: %s", result.Message)
+	}
+
+	var items []struct {
+		Hash          string `json:"hash"`
+		From          string `json:"from"`
+		To            string `json:"to"`
+		Value         string `json:"value"`
+		TimeStamp     string `json:"timeStamp"`
+		Confirmations string `json:"confirmations"`
+	}
+	if err := json.Unmarshal(result.Result, &items); err != nil {
+		return nil, err
+	}
+
+	transfers := make([]Transfer, 0, len(items))
+	for _, item := range items {
+		if !strings.EqualFold(item.To, address) {
+			continue
+		}
+		seconds, _ := strconv.ParseInt(item.TimeStamp, 10, 64)
+		at := time.Unix(seconds, 0)
+		if at.Before(since) {
+			break // 按时间倒序，之后的记录更早
+		}
+		confirmations, _ := strconv.Atoi(item.Confirmations)
+		if confirmations < w.Config.Confirmations {
+			continue
+		}
+		amount, err := strconv.ParseInt(item.Value, 10, 64)
+		if err != nil {
+			continue
+		}
+		transfers = append(transfers, Transfer{
+			Hash:   item.Hash,
+			From:   item.From,
+			To:     address,
+			Amount: amount,
+			Time:   at,
+		})
+	}
+	return transfers, nil
+}
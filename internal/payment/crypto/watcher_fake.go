@@ -0,0 +1,51 @@
+package crypto
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// FakeWatcher 内存中的链上监听器，用于测试与本地开发
+type FakeWatcher struct {
+	mu        sync.Mutex
+	seq       int
+	transfers map[Network][]Transfer
+}
+
+// NewFakeWatcher 创建内存监听器
+func NewFakeWatcher() *FakeWatcher {
+	return &FakeWatcher{transfers: make(map[Network][]Transfer)}
+}
+
+// Send 模拟一笔已确认的转账，返回交易哈希
+func (w *FakeWatcher) Send(network Network, to string, amount int64, at time.Time) string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.seq++
+	hash := fmt.Sprintf("fake-%s-%d", network, w.seq)
+	w.transfers[network] = append(w.transfers[network], Transfer{
+		Hash:   hash,
+		From:   "fake-sender",
+		To:     to,
+		Amount: amount,
+		Time:   at,
+	})
+	return hash
+}
+
+// Transfers 返回 since 之后转入地址的模拟转账
+func (w *FakeWatcher) Transfers(_ context.Context, network Network, address string, since time.Time) ([]Transfer, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var transfers []Transfer
+	for _, t := range w.transfers[network] {
+		if t.To == address && !t.Time.Before(since) {
+			transfers = append(transfers, t)
+		}
+	}
+	return transfers, nil
+}
@@ -6,12 +6,37 @@ import (
 	"fmt"
 	"net/url"
 	"sort"
+	"strconv"
 	"strings"
 
 	"nodepassPanel/internal/config"
 	"nodepassPanel/internal/payment"
 )
 
+func init() {
+	payment.Register(&payment.Gateway{
+		Name:        "epay",
+		DisplayName: "易支付",
+		Methods: []payment.Method{
+			{Method: payment.MethodAlipay, Label: "支付宝"},
+			{Method: payment.MethodWeChat, Label: "微信支付"},
+		},
+		Schema: []payment.Field{
+			{Key: "url", Label: "接口地址", Type: payment.FieldURL, Required: true, Help: "以 / 结尾，如 https://pay.example.com/"},
+			{Key: "pid", Label: "商户ID", Type: payment.FieldString, Required: true},
+			{Key: "key", Label: "商户密钥", Type: payment.FieldSecret, Required: true},
+		},
+		New: func(cfg *payment.GatewayConfig) payment.PaymentStrategy {
+			return NewEPay(config.EPayConfig{
+				Enabled: cfg.Enabled,
+				URL:     cfg.Credential("url"),
+				PID:     cfg.Credential("pid"),
+				Key:     cfg.Credential("key"),
+			})
+		},
+	})
+}
+
 type EPay struct {
 	Config config.EPayConfig
 }
@@ -30,8 +55,8 @@ func (e *EPay) Pay(req *payment.PayRequest) (*payment.PayResponse, error) {
 		"pid":          e.Config.PID,
 		"type":         string(req.Method), // alipay, wxpay
 		"out_trade_no": req.OrderID,
-		"notify_url":   "http://YOUR_DOMAIN/api/v1/payment/notify/epay", // TODO: Configurable Domain
-		"return_url":   "http://YOUR_DOMAIN/user/orders",                // TODO: Frontend Return URL
+		"notify_url":   req.NotifyURL,
+		"return_url":   req.ReturnURL,
 		"name":         req.Description,
 		"money":        fmt.Sprintf("%.2f", req.Amount),
 		"clientip":     req.ClientIP,
@@ -55,11 +80,11 @@ func (e *EPay) Pay(req *payment.PayRequest) (*payment.PayResponse, error) {
 	}, nil
 }
 
-func (e *EPay) Verify(params map[string]string) (string, float64, error) {
+func (e *EPay) Verify(params map[string]string) (*payment.NotifyResult, error) {
 	// 验证签名
 	sign := params["sign"]
 	if sign == "" {
-		return "", 0, fmt.Errorf("no sign")
+		return nil, fmt.Errorf("no sign")
 	}
 
 	// 移除sign和sign_type用于计算
@@ -72,19 +97,26 @@ func (e *EPay) Verify(params map[string]string) (string, float64, error) {
 
 	calculatedSign := e.Sign(verifyParams)
 	if calculatedSign != sign {
-		return "", 0, fmt.Errorf("invalid sign")
+		return nil, fmt.Errorf("invalid sign")
 	}
 
 	// 验证状态
 	if params["trade_status"] != "TRADE_SUCCESS" {
-		return "", 0, fmt.Errorf("交易失败")
+		return nil, fmt.Errorf("交易失败")
 	}
 
-	orderID := params["out_trade_no"]
-	// money := params["money"] // 解析金额...
-	// EPay 回调可能不携带精确的浮点数，但我们信任 OrderID。
-	// 为了 MVP，仅返回 OrderID。
-	return orderID, 0, nil
+	// money 参与签名，可作为实付金额；易支付仅支持人民币
+	money, err := strconv.ParseFloat(params["money"], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid money: %s", params["money"])
+	}
+
+	return &payment.NotifyResult{
+		OrderID:  params["out_trade_no"],
+		Amount:   money,
+		Currency: payment.CurrencyCNY,
+		TradeNo:  params["trade_no"],
+	}, nil
 }
 
 func (e *EPay) Sign(params map[string]string) string {
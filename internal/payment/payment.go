@@ -1,5 +1,10 @@
 package payment
 
+import (
+	"math"
+	"time"
+)
+
 type PaymentMethod string
 
 const (
@@ -7,6 +12,9 @@ const (
 	MethodAlipay  PaymentMethod = "alipay"
 	MethodWeChat  PaymentMethod = "wxpay"
 	MethodBalance PaymentMethod = "balance"
+
+	MethodUSDTTRC20 PaymentMethod = "usdt_trc20"
+	MethodUSDTERC20 PaymentMethod = "usdt_erc20"
 )
 
 // PayRequest 支付请求
@@ -16,19 +24,68 @@ type PayRequest struct {
 	Description string        `json:"description"`
 	ClientIP    string        `json:"client_ip"`
 	Method      PaymentMethod `json:"method"`
+	NotifyURL   string        `json:"notify_url"` // 异步回调地址
+	ReturnURL   string        `json:"return_url"` // 支付完成后跳转地址
+	CancelURL   string        `json:"cancel_url"` // 取消支付后跳转地址
+	ExpiresAt   *time.Time    `json:"expires_at"` // 订单支付期限，网关报价不应晚于此时间
 }
 
 // PayResponse 支付响应
 type PayResponse struct {
-	PayURL      string `json:"pay_url"`      // 支付链接 (跳转URL, 二维码内容, 或 HTML 表单)
-	ContentType string `json:"content_type"` // "url", "qrcode", "html"
-	TradeNo     string `json:"trade_no"`     // 第三方交易号 (如果立即生成)
+	PayURL      string      `json:"pay_url"`          // 支付链接 (跳转URL, 二维码内容, 或 HTML 表单)
+	ContentType string      `json:"content_type"`     // "url", "qrcode", "html", "crypto"
+	TradeNo     string      `json:"trade_no"`         // 第三方交易号 (如果立即生成)
+	Crypto      *CryptoInfo `json:"crypto,omitempty"` // 加密货币收款信息 (content_type 为 crypto 时返回)
+}
+
+// CryptoInfo 加密货币收款信息，用户需向地址转入精确的金额
+type CryptoInfo struct {
+	Network   string    `json:"network"`    // 链网络: trc20, erc20
+	Address   string    `json:"address"`    // 收款地址
+	Amount    string    `json:"amount"`     // 应付数量 (USDT)
+	Rate      float64   `json:"rate"`       // 汇率 (CNY/USDT)
+	ExpiresAt time.Time `json:"expires_at"` // 报价过期时间
+}
+
+// CurrencyCNY 订单结算币种，所有网关均以人民币下单
+const CurrencyCNY = "cny"
+
+// NotifyResult 回调验证结果
+type NotifyResult struct {
+	OrderID  string  // 订单号
+	Amount   float64 // 实际支付金额 (元)
+	Currency string  // 币种 (小写 ISO 4217)
+	TradeNo  string  // 第三方交易号
 }
 
 // PaymentStrategy 支付接口
 type PaymentStrategy interface {
 	// Pay 发起支付
 	Pay(req *PayRequest) (*PayResponse, error)
-	// Verify 验证回调/通知 (返回 orderID, amount, error)
-	Verify(params map[string]string) (string, float64, error)
+	// Verify 验证回调/通知，返回网关确认的订单号、金额与币种
+	Verify(params map[string]string) (*NotifyResult, error)
+}
+
+// RefundRequest 退款请求
+type RefundRequest struct {
+	OrderID string  `json:"order_id"`
+	TradeNo string  `json:"trade_no"` // 支付时网关返回的交易号
+	Amount  float64 `json:"amount"`   // 本次退款金额 (元)，可小于订单金额
+	Reason  string  `json:"reason"`
+}
+
+// RefundResponse 退款响应
+type RefundResponse struct {
+	RefundNo string `json:"refund_no"` // 网关退款单号
+	Status   string `json:"status"`    // 网关返回的退款状态
+}
+
+// Refunder 支持原路退款的支付方式 (可选能力，未实现时需管理员在网关后台手动退款)
+type Refunder interface {
+	Refund(req *RefundRequest) (*RefundResponse, error)
+}
+
+// ToCents 元转换为分，用于金额比较与网关下单，避免浮点误差
+func ToCents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
 }
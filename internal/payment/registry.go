@@ -0,0 +1,135 @@
+package payment
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// 配置项类型
+const (
+	FieldString = "string" // 普通文本
+	FieldSecret = "secret" // 密钥，接口返回时隐藏
+	FieldURL    = "url"    // 地址
+)
+
+// Field 网关配置项描述，前端据此渲染配置表单
+type Field struct {
+	Key      string `json:"key"`
+	Label    string `json:"label"`
+	Type     string `json:"type"`
+	Required bool   `json:"required"`
+	Help     string `json:"help,omitempty"`
+}
+
+// Method 网关提供的支付方式
+type Method struct {
+	Method PaymentMethod `json:"method"`
+	Label  string        `json:"label"`
+}
+
+// GatewayConfig 网关配置 (以 JSON 存储在系统设置中)
+type GatewayConfig struct {
+	Enabled     bool              `json:"enabled"`
+	DisplayName string            `json:"display_name"` // 为空使用网关默认名称
+	FeePercent  float64           `json:"fee_percent"`  // 手续费百分比，由用户承担
+	OrderTypes  []string          `json:"order_types"`  // 允许的订单类型 (plan, recharge)，为空不限制
+	Credentials map[string]string `json:"credentials"`  // 按 Schema 填写的凭据
+}
+
+// Credential 获取凭据
+func (c *GatewayConfig) Credential(key string) string {
+	return c.Credentials[key]
+}
+
+// AllowsOrderType 是否允许该类型的订单使用
+func (c *GatewayConfig) AllowsOrderType(orderType string) bool {
+	return len(c.OrderTypes) == 0 || slices.Contains(c.OrderTypes, orderType)
+}
+
+// Gateway 支付网关定义
+type Gateway struct {
+	Name        string   // 网关标识，用于存储配置
+	DisplayName string   // 默认显示名称
+	Methods     []Method // 提供的支付方式，回调地址中的 :method 对应这里的 Method
+	Schema      []Field  // 凭据配置项
+
+	// New 根据配置创建支付策略
+	New func(cfg *GatewayConfig) PaymentStrategy
+}
+
+// Validate 校验启用的网关已填写必填凭据
+func (g *Gateway) Validate(cfg *GatewayConfig) error {
+	if cfg.FeePercent < 0 || cfg.FeePercent >= 100 {
+		return fmt.Errorf("fee_percent must be between 0 and 100")
+	}
+	if !cfg.Enabled {
+		return nil
+	}
+	for _, field := range g.Schema {
+		if field.Required && cfg.Credential(field.Key) == "" {
+			return fmt.Errorf("%s is required", field.Key)
+		}
+	}
+	return nil
+}
+
+var (
+	registryMu sync.RWMutex
+	gateways   = make(map[string]*Gateway)
+	methods    = make(map[PaymentMethod]*Gateway)
+)
+
+// Register 注册支付网关，通常在网关包的 init 中调用
+// 网关名或支付方式重复时 panic
+func Register(gateway *Gateway) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := gateways[gateway.Name]; ok {
+		panic("payment: gateway registered twice: " + gateway.Name)
+	}
+	for _, m := range gateway.Methods {
+		if m.Method == MethodBalance {
+			panic("payment: balance method is built in")
+		}
+		if existing, ok := methods[m.Method]; ok {
+			panic(fmt.Sprintf("payment: method %s registered by both %s and %s", m.Method, existing.Name, gateway.Name))
+		}
+	}
+
+	gateways[gateway.Name] = gateway
+	for _, m := range gateway.Methods {
+		methods[m.Method] = gateway
+	}
+}
+
+// Lookup 按名称查找网关
+func Lookup(name string) (*Gateway, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	gateway, ok := gateways[name]
+	return gateway, ok
+}
+
+// LookupMethod 查找提供该支付方式的网关
+func LookupMethod(method PaymentMethod) (*Gateway, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	gateway, ok := methods[method]
+	return gateway, ok
+}
+
+// Gateways 返回所有已注册的网关 (按名称排序)
+func Gateways() []*Gateway {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	list := make([]*Gateway, 0, len(gateways))
+	for _, gateway := range gateways {
+		list = append(list, gateway)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
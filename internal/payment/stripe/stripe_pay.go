@@ -5,12 +5,35 @@ import (
 	"fmt"
 	"nodepassPanel/internal/config"
 	"nodepassPanel/internal/payment"
+	"strings"
 
 	"github.com/stripe/stripe-go/v76"
 	"github.com/stripe/stripe-go/v76/checkout/session"
+	"github.com/stripe/stripe-go/v76/refund"
 	"github.com/stripe/stripe-go/v76/webhook"
 )
 
+func init() {
+	payment.Register(&payment.Gateway{
+		Name:        "stripe",
+		DisplayName: "Stripe",
+		Methods: []payment.Method{
+			{Method: payment.MethodStripe, Label: "信用卡"},
+		},
+		Schema: []payment.Field{
+			{Key: "api_key", Label: "Secret Key", Type: payment.FieldSecret, Required: true},
+			{Key: "webhook_key", Label: "Webhook Secret", Type: payment.FieldSecret, Required: true, Help: "Webhook 地址为 {站点地址}/api/v1/payment/notify/stripe"},
+		},
+		New: func(cfg *payment.GatewayConfig) payment.PaymentStrategy {
+			return NewStripePay(config.StripeConfig{
+				Enabled:    cfg.Enabled,
+				APIKey:     cfg.Credential("api_key"),
+				WebhookKey: cfg.Credential("webhook_key"),
+			})
+		},
+	})
+}
+
 type StripePay struct {
 	Config config.StripeConfig
 }
@@ -34,18 +57,18 @@ func (s *StripePay) Pay(req *payment.PayRequest) (*payment.PayResponse, error) {
 		LineItems: []*stripe.CheckoutSessionLineItemParams{
 			{
 				PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
-					Currency: stripe.String("cny"),
+					Currency: stripe.String(payment.CurrencyCNY),
 					ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
 						Name: stripe.String(req.Description),
 					},
-					UnitAmount: stripe.Int64(int64(req.Amount * 100)), // cents
+					UnitAmount: stripe.Int64(payment.ToCents(req.Amount)), // cents
 				},
 				Quantity: stripe.Int64(1),
 			},
 		},
 		Mode:              stripe.String(string(stripe.CheckoutSessionModePayment)),
-		SuccessURL:        stripe.String("http://YOUR_DOMAIN/user/orders?status=success"),
-		CancelURL:         stripe.String("http://YOUR_DOMAIN/user/orders?status=cancel"),
+		SuccessURL:        stripe.String(req.ReturnURL),
+		CancelURL:         stripe.String(req.CancelURL),
 		ClientReferenceID: stripe.String(req.OrderID),
 	}
 
@@ -61,24 +84,84 @@ func (s *StripePay) Pay(req *payment.PayRequest) (*payment.PayResponse, error) {
 	}, nil
 }
 
-func (s *StripePay) Verify(params map[string]string) (string, float64, error) {
+func (s *StripePay) Verify(params map[string]string) (*payment.NotifyResult, error) {
 	payload := params["payload"]
 	sigHeader := params["sig_header"]
 
 	event, err := webhook.ConstructEvent([]byte(payload), sigHeader, s.Config.WebhookKey)
 	if err != nil {
-		return "", 0, err
+		return nil, err
 	}
 
 	if event.Type == "checkout.session.completed" {
 		var session stripe.CheckoutSession
 		err := json.Unmarshal(event.Data.Raw, &session)
 		if err != nil {
-			return "", 0, err
+			return nil, err
+		}
+		if session.PaymentStatus != stripe.CheckoutSessionPaymentStatusPaid {
+			return nil, fmt.Errorf("支付未完成: %s", session.PaymentStatus)
+		}
+
+		// 退款需要 PaymentIntent，会话未展开时仅有 ID
+		tradeNo := session.ID
+		if session.PaymentIntent != nil && session.PaymentIntent.ID != "" {
+			tradeNo = session.PaymentIntent.ID
 		}
+
 		// Stripe 金额单位为分 (int64)
-		return session.ClientReferenceID, float64(session.AmountTotal) / 100.0, nil
+		return &payment.NotifyResult{
+			OrderID:  session.ClientReferenceID,
+			Amount:   float64(session.AmountTotal) / 100.0,
+			Currency: string(session.Currency),
+			TradeNo:  tradeNo,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("忽略的事件类型: %s", event.Type)
+}
+
+// Refund 通过 Refund API 原路退款，支持部分退款
+func (s *StripePay) Refund(req *payment.RefundRequest) (*payment.RefundResponse, error) {
+	if !s.Config.Enabled {
+		return nil, fmt.Errorf("stripe 未启用")
 	}
 
-	return "", 0, fmt.Errorf("忽略的事件类型: %s", event.Type)
+	stripe.Key = s.Config.APIKey
+
+	// 早期订单只记录了 Checkout Session ID，需查询对应的 PaymentIntent
+	paymentIntent := req.TradeNo
+	if strings.HasPrefix(paymentIntent, "cs_") {
+		sess, err := session.Get(paymentIntent, nil)
+		if err != nil {
+			return nil, err
+		}
+		if sess.PaymentIntent == nil || sess.PaymentIntent.ID == "" {
+			return nil, fmt.Errorf("checkout session %s 没有关联的支付", paymentIntent)
+		}
+		paymentIntent = sess.PaymentIntent.ID
+	}
+	if paymentIntent == "" {
+		return nil, fmt.Errorf("订单缺少 Stripe 交易号")
+	}
+
+	params := &stripe.RefundParams{
+		PaymentIntent: stripe.String(paymentIntent),
+		Amount:        stripe.Int64(payment.ToCents(req.Amount)),
+		Reason:        stripe.String(string(stripe.RefundReasonRequestedByCustomer)),
+	}
+	params.AddMetadata("order_id", req.OrderID)
+	if req.Reason != "" {
+		params.AddMetadata("reason", req.Reason)
+	}
+
+	r, err := refund.New(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return &payment.RefundResponse{
+		RefundNo: r.ID,
+		Status:   string(r.Status),
+	}, nil
 }
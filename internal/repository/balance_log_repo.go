@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"nodepassPanel/internal/global"
+	"nodepassPanel/internal/model"
+)
+
+// BalanceLogRepository 资金流水数据访问层
+type BalanceLogRepository struct{}
+
+// NewBalanceLogRepository 创建资金流水仓库实例
+func NewBalanceLogRepository() *BalanceLogRepository {
+	return &BalanceLogRepository{}
+}
+
+// BalanceLogFilter 资金流水筛选条件 (零值表示不限)
+type BalanceLogFilter struct {
+	UserID  uint
+	Account string
+	Type    string
+	OrderID uint
+	TxnNo   string
+	System  bool // 是否包含系统账户分录
+}
+
+// GetPaginated 分页获取流水 (按时间倒序)
+func (r *BalanceLogRepository) GetPaginated(page, pageSize int, filter *BalanceLogFilter) ([]model.BalanceLog, int64, error) {
+	var logs []model.BalanceLog
+	var total int64
+
+	query := global.DB.Model(&model.BalanceLog{})
+	if filter.UserID > 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	} else if !filter.System {
+		query = query.Where("user_id > 0")
+	}
+	if filter.Account != "" {
+		query = query.Where("account = ?", filter.Account)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.OrderID > 0 {
+		query = query.Where("order_id = ?", filter.OrderID)
+	}
+	if filter.TxnNo != "" {
+		query = query.Where("txn_no = ?", filter.TxnNo)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Offset(offset).Limit(pageSize).Order("id DESC").Find(&logs).Error; err != nil {
+		return nil, 0, err
+	}
+	return logs, total, nil
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"nodepassPanel/internal/global"
+	"nodepassPanel/internal/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CryptoPaymentRepository USDT 报价数据访问层
+type CryptoPaymentRepository struct{}
+
+// NewCryptoPaymentRepository 创建 USDT 报价仓库实例
+func NewCryptoPaymentRepository() *CryptoPaymentRepository {
+	return &CryptoPaymentRepository{}
+}
+
+// openCryptoStatuses 仍占用收款金额并确认到账的报价状态
+var openCryptoStatuses = []int{model.CryptoPaymentPending, model.CryptoPaymentSuperseded}
+
+// GetLatestByOrderNo 获取订单最近一次报价
+func (r *CryptoPaymentRepository) GetLatestByOrderNo(orderNo string) (*model.CryptoPayment, error) {
+	var cp model.CryptoPayment
+	if err := global.DB.Where("order_no = ?", orderNo).Order("id DESC").First(&cp).Error; err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+// GetPaidOpen 获取订单已足额到账但未结束的报价 (含已失效报价)，优先最近一次
+func (r *CryptoPaymentRepository) GetPaidOpen(orderNo string) (*model.CryptoPayment, error) {
+	var cp model.CryptoPayment
+	err := global.DB.Where("order_no = ? AND status IN ? AND received >= amount", orderNo, openCryptoStatuses).
+		Order("id DESC").First(&cp).Error
+	if err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+// GetOpen 获取网络上所有待支付与未过期的已失效报价
+func (r *CryptoPaymentRepository) GetOpen(network string) ([]model.CryptoPayment, error) {
+	var payments []model.CryptoPayment
+	err := global.DB.Where("network = ? AND status IN ?", network, openCryptoStatuses).Find(&payments).Error
+	return payments, err
+}
+
+// Reserve 在事务中使订单的其他待支付报价失效并创建新报价
+// 失效报价保留收款金额占用直到过期，期间转入的款项仍可归属；同一地址上占用的金额重复时返回 gorm.ErrDuplicatedKey
+func (r *CryptoPaymentRepository) Reserve(cp *model.CryptoPayment) error {
+	return global.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.CryptoPayment{}).
+			Where("order_no = ? AND status = ?", cp.OrderNo, model.CryptoPaymentPending).
+			Update("status", model.CryptoPaymentSuperseded).Error; err != nil {
+			return err
+		}
+		return tx.Create(cp).Error
+	})
+}
+
+// GetExpired 获取已过期仍未结束的报价 (待支付与已失效)
+func (r *CryptoPaymentRepository) GetExpired(now time.Time) ([]model.CryptoPayment, error) {
+	var payments []model.CryptoPayment
+	err := global.DB.Where("status IN ? AND expires_at < ?", openCryptoStatuses, now).Find(&payments).Error
+	return payments, err
+}
+
+// AddReceived 累加到账数量并记录交易哈希
+// 以读取时的交易哈希为条件，报价已被并发更新或已结束时返回 false，避免同一笔转账重复计入
+func (r *CryptoPaymentRepository) AddReceived(id uint, amount int64, prevHashes, txHashes string) (bool, error) {
+	result := global.DB.Model(&model.CryptoPayment{}).
+		Where("id = ? AND status IN ? AND tx_hashes = ?", id, openCryptoStatuses, prevHashes).
+		Updates(map[string]interface{}{
+			"received":  gorm.Expr("received + ?", amount),
+			"tx_hashes": txHashes,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// Finish 结束报价并释放收款金额，报价已结束时返回 false
+func (r *CryptoPaymentRepository) Finish(id uint, status int) (bool, error) {
+	result := global.DB.Model(&model.CryptoPayment{}).
+		Where("id = ? AND status IN ?", id, openCryptoStatuses).
+		Updates(map[string]interface{}{
+			"status":      status,
+			"pending_key": nil,
+		})
+	return result.RowsAffected > 0, result.Error
+}
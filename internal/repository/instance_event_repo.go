@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"nodepassPanel/internal/global"
+	"nodepassPanel/internal/model"
+)
+
+// InstanceEventRepository 实例状态变更记录数据访问层
+type InstanceEventRepository struct{}
+
+// NewInstanceEventRepository 创建实例状态变更记录仓库实例
+func NewInstanceEventRepository() *InstanceEventRepository {
+	return &InstanceEventRepository{}
+}
+
+// Create 创建记录
+func (r *InstanceEventRepository) Create(event *model.InstanceEvent) error {
+	return global.DB.Create(event).Error
+}
+
+// GetLatest 获取实例最近一条记录
+func (r *InstanceEventRepository) GetLatest(instanceID uint) (*model.InstanceEvent, error) {
+	var event model.InstanceEvent
+	if err := global.DB.Where("instance_id = ?", instanceID).Order("id DESC").First(&event).Error; err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// GetPaginated 分页获取记录（支持按实例、用户筛选）
+func (r *InstanceEventRepository) GetPaginated(page, pageSize int, instanceID, userID uint) ([]model.InstanceEvent, int64, error) {
+	var events []model.InstanceEvent
+	var total int64
+
+	query := global.DB.Model(&model.InstanceEvent{})
+
+	if instanceID > 0 {
+		query = query.Where("instance_id = ?", instanceID)
+	}
+	if userID > 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Offset(offset).Limit(pageSize).Order("id DESC").Find(&events).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return events, total, nil
+}
@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"nodepassPanel/internal/global"
+	"nodepassPanel/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// InstanceRepository 转发实例数据访问层
+type InstanceRepository struct{}
+
+// NewInstanceRepository 创建转发实例仓库实例
+func NewInstanceRepository() *InstanceRepository {
+	return &InstanceRepository{}
+}
+
+// Create 创建实例
+func (r *InstanceRepository) Create(instance *model.Instance) error {
+	return global.DB.Create(instance).Error
+}
+
+// Update 更新实例
+// 流量计数与计数快照由采集任务并发更新 (RecordTraffic)，不随其他字段回写
+func (r *InstanceRepository) Update(instance *model.Instance) error {
+	return global.DB.Omit("upload", "download", "last_rx", "last_tx").Save(instance).Error
+}
+
+// ResetCounters 清零计数快照 (实例在新节点上重建后计数从零开始)
+func (r *InstanceRepository) ResetCounters(id uint) error {
+	return global.DB.Model(&model.Instance{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"last_rx": 0, "last_tx": 0}).Error
+}
+
+// Delete 删除实例
+func (r *InstanceRepository) Delete(id uint) error {
+	return global.DB.Delete(&model.Instance{}, id).Error
+}
+
+// GetByID 根据ID获取实例
+func (r *InstanceRepository) GetByID(id uint) (*model.Instance, error) {
+	var instance model.Instance
+	err := global.DB.First(&instance, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &instance, nil
+}
+
+// GetByUserID 获取用户的所有实例
+func (r *InstanceRepository) GetByUserID(userID uint) ([]model.Instance, error) {
+	var instances []model.Instance
+	err := global.DB.Where("user_id = ?", userID).Order("id DESC").Find(&instances).Error
+	return instances, err
+}
+
+// GetByNodeID 获取节点上的所有实例
+func (r *InstanceRepository) GetByNodeID(nodeID uint) ([]model.Instance, error) {
+	var instances []model.Instance
+	err := global.DB.Where("node_id = ?", nodeID).Find(&instances).Error
+	return instances, err
+}
+
+// GetByOriginNodeID 获取从指定节点迁出的实例
+func (r *InstanceRepository) GetByOriginNodeID(nodeID uint) ([]model.Instance, error) {
+	var instances []model.Instance
+	err := global.DB.Where("origin_node_id = ?", nodeID).Find(&instances).Error
+	return instances, err
+}
+
+// CountByUserID 统计用户的实例数量
+func (r *InstanceRepository) CountByUserID(userID uint) int64 {
+	var count int64
+	global.DB.Model(&model.Instance{}).Where("user_id = ?", userID).Count(&count)
+	return count
+}
+
+// GetPaginated 分页获取实例（支持按用户、节点筛选）
+func (r *InstanceRepository) GetPaginated(page, pageSize int, userID, nodeID uint) ([]model.Instance, int64, error) {
+	var instances []model.Instance
+	var total int64
+
+	query := global.DB.Model(&model.Instance{})
+
+	if userID > 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if nodeID > 0 {
+		query = query.Where("node_id = ?", nodeID)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Offset(offset).Limit(pageSize).Order("id DESC").Find(&instances).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return instances, total, nil
+}
+
+// PortInUse 检查节点上的端口是否已被占用 (excludeID 用于排除自身)
+func (r *InstanceRepository) PortInUse(nodeID uint, port int, excludeID uint) bool {
+	var count int64
+	query := global.DB.Model(&model.Instance{}).Where("node_id = ? AND server_port = ?", nodeID, port)
+	if excludeID > 0 {
+		query = query.Where("id <> ?", excludeID)
+	}
+	query.Count(&count)
+	return count > 0
+}
+
+// GetUsedPorts 获取节点上已分配的端口
+func (r *InstanceRepository) GetUsedPorts(nodeID uint) ([]int, error) {
+	var ports []int
+	err := global.DB.Model(&model.Instance{}).Where("node_id = ?", nodeID).Pluck("server_port", &ports).Error
+	return ports, err
+}
+
+// RecordTraffic 在事务中更新实例计数快照并累加实例与用户流量
+// 以旧快照作为条件更新，快照已被其他采集方修改时返回 false 且不计费
+func (r *InstanceRepository) RecordTraffic(instance *model.Instance, rx, tx, upload, download int64) (bool, error) {
+	applied := false
+	err := global.DB.Transaction(func(db *gorm.DB) error {
+		result := db.Model(&model.Instance{}).
+			Where("id = ? AND last_rx = ? AND last_tx = ?", instance.ID, instance.LastRx, instance.LastTx).
+			Updates(map[string]interface{}{
+				"last_rx":  rx,
+				"last_tx":  tx,
+				"upload":   gorm.Expr("upload + ?", upload),
+				"download": gorm.Expr("download + ?", download),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		if upload > 0 || download > 0 {
+			if err := db.Model(&model.User{}).Where("id = ?", instance.UserID).
+				Updates(map[string]interface{}{
+					"upload":   gorm.Expr("upload + ?", upload),
+					"download": gorm.Expr("download + ?", download),
+				}).Error; err != nil {
+				return err
+			}
+		}
+
+		applied = true
+		return nil
+	})
+	return applied, err
+}
+
+// GetUserIDsBySuspended 获取拥有指定停用状态实例的用户ID
+func (r *InstanceRepository) GetUserIDsBySuspended(suspended bool) ([]uint, error) {
+	var ids []uint
+	err := global.DB.Model(&model.Instance{}).Where("suspended = ?", suspended).
+		Distinct("user_id").Pluck("user_id", &ids).Error
+	return ids, err
+}
+
+// GetByUserIDAndSuspended 获取用户指定停用状态的实例
+func (r *InstanceRepository) GetByUserIDAndSuspended(userID uint, suspended bool) ([]model.Instance, error) {
+	var instances []model.Instance
+	err := global.DB.Where("user_id = ? AND suspended = ?", userID, suspended).Find(&instances).Error
+	return instances, err
+}
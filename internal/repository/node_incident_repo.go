@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"nodepassPanel/internal/global"
+	"nodepassPanel/internal/model"
+	"time"
+)
+
+// NodeIncidentRepository 节点故障记录数据访问层
+type NodeIncidentRepository struct{}
+
+// NewNodeIncidentRepository 创建节点故障记录仓库实例
+func NewNodeIncidentRepository() *NodeIncidentRepository {
+	return &NodeIncidentRepository{}
+}
+
+// Create 创建记录
+func (r *NodeIncidentRepository) Create(incident *model.NodeIncident) error {
+	return global.DB.Create(incident).Error
+}
+
+// Update 更新记录
+func (r *NodeIncidentRepository) Update(incident *model.NodeIncident) error {
+	return global.DB.Save(incident).Error
+}
+
+// GetByID 根据 ID 获取记录
+func (r *NodeIncidentRepository) GetByID(id uint) (*model.NodeIncident, error) {
+	var incident model.NodeIncident
+	if err := global.DB.First(&incident, id).Error; err != nil {
+		return nil, err
+	}
+	return &incident, nil
+}
+
+// GetOpen 获取所有未恢复的故障
+func (r *NodeIncidentRepository) GetOpen() ([]model.NodeIncident, error) {
+	var incidents []model.NodeIncident
+	err := global.DB.Where("status = ?", model.NodeIncidentOpen).Find(&incidents).Error
+	return incidents, err
+}
+
+// CountSince 统计节点在指定时间之后产生的故障数
+func (r *NodeIncidentRepository) CountSince(nodeID uint, since time.Time) (int64, error) {
+	var count int64
+	err := global.DB.Model(&model.NodeIncident{}).
+		Where("node_id = ? AND started_at >= ?", nodeID, since).
+		Count(&count).Error
+	return count, err
+}
+
+// GetPaginated 分页获取记录（支持按节点、状态筛选）
+func (r *NodeIncidentRepository) GetPaginated(page, pageSize int, nodeID uint, status string) ([]model.NodeIncident, int64, error) {
+	var incidents []model.NodeIncident
+	var total int64
+
+	query := global.DB.Model(&model.NodeIncident{})
+
+	if nodeID > 0 {
+		query = query.Where("node_id = ?", nodeID)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Offset(offset).Limit(pageSize).Order("id DESC").Find(&incidents).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return incidents, total, nil
+}
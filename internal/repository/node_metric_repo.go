@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"nodepassPanel/internal/global"
+	"nodepassPanel/internal/model"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// NodeMetricRepository 节点时序数据访问层
+type NodeMetricRepository struct{}
+
+// NewNodeMetricRepository 创建节点时序数据仓库实例
+func NewNodeMetricRepository() *NodeMetricRepository {
+	return &NodeMetricRepository{}
+}
+
+// Accumulate 将一次采样累加到指定粒度的桶 (不存在则创建)
+func (r *NodeMetricRepository) Accumulate(metric *model.NodeMetric) error {
+	return global.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "node_id"}, {Name: "resolution"}, {Name: "time"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"samples":    gorm.Expr("node_metrics.samples + ?", metric.Samples),
+			"up_samples": gorm.Expr("node_metrics.up_samples + ?", metric.UpSamples),
+			"ping_sum":   gorm.Expr("node_metrics.ping_sum + ?", metric.PingSum),
+			"load_sum":   gorm.Expr("node_metrics.load_sum + ?", metric.LoadSum),
+			"max_online_user": gorm.Expr(
+				"CASE WHEN node_metrics.max_online_user > ? THEN node_metrics.max_online_user ELSE ? END",
+				metric.MaxOnlineUser, metric.MaxOnlineUser),
+		}),
+	}).Create(metric).Error
+}
+
+// GetRange 获取节点指定粒度、时间范围内的数据
+func (r *NodeMetricRepository) GetRange(nodeID uint, resolution string, since time.Time) ([]model.NodeMetric, error) {
+	var metrics []model.NodeMetric
+	err := global.DB.Where("node_id = ? AND resolution = ? AND time >= ?", nodeID, resolution, since).
+		Order("time ASC").Find(&metrics).Error
+	return metrics, err
+}
+
+// SumSamples 汇总各节点在时间范围内的采样数与在线采样数
+func (r *NodeMetricRepository) SumSamples(resolution string, since time.Time) (map[uint][2]int64, error) {
+	var rows []struct {
+		NodeID    uint
+		Samples   int64
+		UpSamples int64
+	}
+	err := global.DB.Model(&model.NodeMetric{}).
+		Select("node_id, SUM(samples) AS samples, SUM(up_samples) AS up_samples").
+		Where("resolution = ? AND time >= ?", resolution, since).
+		Group("node_id").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[uint][2]int64, len(rows))
+	for _, row := range rows {
+		result[row.NodeID] = [2]int64{row.Samples, row.UpSamples}
+	}
+	return result, nil
+}
+
+// DeleteBefore 删除指定粒度早于截止时间的数据
+func (r *NodeMetricRepository) DeleteBefore(resolution string, before time.Time) (int64, error) {
+	result := global.DB.Where("resolution = ? AND time < ?", resolution, before).Delete(&model.NodeMetric{})
+	return result.RowsAffected, result.Error
+}
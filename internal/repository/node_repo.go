@@ -49,3 +49,13 @@ func (r *NodeRepository) GetActiveNodes() ([]model.Node, error) {
 	err := global.DB.Where("status = ?", 1).Find(&nodes).Error
 	return nodes, err
 }
+
+// UpdateStatus 更新节点监控字段 (不覆盖管理员编辑的其他字段)
+func (r *NodeRepository) UpdateStatus(id uint, status, ping, onlineUser int, load float64) error {
+	return global.DB.Model(&model.Node{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":      status,
+		"ping":        ping,
+		"online_user": onlineUser,
+		"load":        load,
+	}).Error
+}
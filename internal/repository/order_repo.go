@@ -3,6 +3,7 @@ package repository
 import (
 	"nodepassPanel/internal/global"
 	"nodepassPanel/internal/model"
+	"time"
 )
 
 // OrderRepository 订单数据访问层
@@ -80,16 +81,64 @@ func (r *OrderRepository) Update(order *model.Order) error {
 	return global.DB.Save(order).Error
 }
 
+// UpdatePayAttempt 记录发起支付时的网关信息，仅更新待支付订单，避免覆盖并发回调写入的状态
+func (r *OrderRepository) UpdatePayAttempt(order *model.Order) error {
+	return global.DB.Model(&model.Order{}).
+		Where("id = ? AND status = ?", order.ID, model.OrderStatusPending).
+		Updates(map[string]interface{}{
+			"trade_no":   order.TradeNo,
+			"pay_method": order.PayMethod,
+			"fee":        order.Fee,
+		}).Error
+}
+
+// GetExpiredPending 获取已过期仍待支付的订单
+func (r *OrderRepository) GetExpiredPending(now time.Time, limit int) ([]model.Order, error) {
+	var orders []model.Order
+	err := global.DB.Where("status = ? AND expired_at < ?", model.OrderStatusPending, now).
+		Order("id ASC").Limit(limit).Find(&orders).Error
+	return orders, err
+}
+
+// GetCurrentPlanOrder 获取用户最近一笔已支付的套餐或套餐变更订单 (不含流量包)
+func (r *OrderRepository) GetCurrentPlanOrder(userID uint) (*model.Order, error) {
+	var order model.Order
+	err := global.DB.Where("user_id = ? AND status = ? AND type IN ? AND plan_id IS NOT NULL",
+		userID, model.OrderStatusPaid, []string{model.OrderTypePlan, model.OrderTypeUpgrade}).
+		Where("COALESCE(period, '') <> ?", model.PeriodOnetime).
+		Order("paid_at DESC, id DESC").First(&order).Error
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// HasPending 用户是否有指定类型且未过期的待支付订单
+func (r *OrderRepository) HasPending(userID uint, types ...string) (bool, error) {
+	var count int64
+	err := global.DB.Model(&model.Order{}).
+		Where("user_id = ? AND status = ? AND type IN ?", userID, model.OrderStatusPending, types).
+		Where("expired_at IS NULL OR expired_at > ?", time.Now()).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// UpdateRemark 更新订单备注
+func (r *OrderRepository) UpdateRemark(id uint, remark string) error {
+	return global.DB.Model(&model.Order{}).Where("id = ?", id).Update("remark", remark).Error
+}
+
 // Delete 删除订单
 func (r *OrderRepository) Delete(id uint) error {
 	return global.DB.Delete(&model.Order{}, id).Error
 }
 
-// CountUsageByUser 统计用户使用特定优惠券的次数（仅限已支付订单）
+// CountUsageByUser 统计用户使用特定优惠券的次数（待支付订单已占用次数，一并统计）
 func (r *OrderRepository) CountUsageByUser(userID uint, couponID int) (int64, error) {
 	var count int64
 	err := global.DB.Model(&model.Order{}).
-		Where("user_id = ? AND coupon_id = ? AND status = ?", userID, couponID, model.OrderStatusPaid).
+		Where("user_id = ? AND coupon_id = ? AND status IN ?", userID, couponID,
+			[]int{model.OrderStatusPending, model.OrderStatusPaid, model.OrderStatusPaidAfterExpiry}).
 		Count(&count).Error
 	return count, err
 }
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"errors"
+	"nodepassPanel/internal/global"
+	"nodepassPanel/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// PaymentTransactionRepository 支付网关交互记录数据访问层
+type PaymentTransactionRepository struct{}
+
+// NewPaymentTransactionRepository 创建支付网关交互记录仓库实例
+func NewPaymentTransactionRepository() *PaymentTransactionRepository {
+	return &PaymentTransactionRepository{}
+}
+
+// Create 创建记录
+func (r *PaymentTransactionRepository) Create(txn *model.PaymentTransaction) error {
+	return global.DB.Create(txn).Error
+}
+
+// GetPayAttempt 获取订单发起成功的支付记录，优先按交易号匹配，其次取该支付方式最近一次发起
+func (r *PaymentTransactionRepository) GetPayAttempt(orderID uint, method, tradeNo string) (*model.PaymentTransaction, error) {
+	query := global.DB.Where("order_id = ? AND action = ? AND success = ?", orderID, model.PaymentActionPay, true).
+		Session(&gorm.Session{})
+	var txn model.PaymentTransaction
+	if tradeNo != "" {
+		err := query.Where("trade_no = ?", tradeNo).Order("id DESC").First(&txn).Error
+		if err == nil {
+			return &txn, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+	err := query.Where("method = ?", method).Order("id DESC").First(&txn).Error
+	if err != nil {
+		return nil, err
+	}
+	return &txn, nil
+}
+
+// GetByOrderID 获取订单的所有记录 (按时间顺序)
+func (r *PaymentTransactionRepository) GetByOrderID(orderID uint) ([]model.PaymentTransaction, error) {
+	var txns []model.PaymentTransaction
+	err := global.DB.Where("order_id = ?", orderID).Order("id ASC").Find(&txns).Error
+	return txns, err
+}
@@ -3,6 +3,8 @@ package repository
 import (
 	"nodepassPanel/internal/global"
 	"nodepassPanel/internal/model"
+
+	"gorm.io/gorm"
 )
 
 // PlanRepository 套餐数据访问层
@@ -13,7 +15,14 @@ func NewPlanRepository() *PlanRepository {
 	return &PlanRepository{}
 }
 
-// Create 创建套餐
+// withPrices 预加载计费周期，按有效期排序 (流量包在前)
+func withPrices(db *gorm.DB) *gorm.DB {
+	return db.Preload("Prices", func(db *gorm.DB) *gorm.DB {
+		return db.Order("duration ASC, id ASC")
+	})
+}
+
+// Create 创建套餐 (同时创建计费周期)
 func (r *PlanRepository) Create(plan *model.Plan) error {
 	return global.DB.Create(plan).Error
 }
@@ -21,27 +30,65 @@ func (r *PlanRepository) Create(plan *model.Plan) error {
 // GetByID 根据ID获取套餐
 func (r *PlanRepository) GetByID(id uint) (*model.Plan, error) {
 	var plan model.Plan
-	err := global.DB.First(&plan, id).Error
+	err := withPrices(global.DB).First(&plan, id).Error
 	return &plan, err
 }
 
 // GetAll 获取所有套餐
 func (r *PlanRepository) GetAll() ([]model.Plan, error) {
 	var plans []model.Plan
-	err := global.DB.Order("sort DESC, id ASC").Find(&plans).Error
+	err := withPrices(global.DB).Order("sort DESC, id ASC").Find(&plans).Error
 	return plans, err
 }
 
 // GetVisible 获取可见套餐（用户端）
 func (r *PlanRepository) GetVisible() ([]model.Plan, error) {
 	var plans []model.Plan
-	err := global.DB.Where("hidden = ?", false).Order("sort DESC, id ASC").Find(&plans).Error
+	err := withPrices(global.DB).Where("hidden = ?", false).Order("sort DESC, id ASC").Find(&plans).Error
 	return plans, err
 }
 
-// Update 更新套餐
-func (r *PlanRepository) Update(plan *model.Plan) error {
-	return global.DB.Save(plan).Error
+// GetPrice 获取套餐指定计费周期的价格
+func (r *PlanRepository) GetPrice(planID uint, period string) (*model.PlanPrice, error) {
+	var price model.PlanPrice
+	err := global.DB.Where("plan_id = ? AND period = ?", planID, period).First(&price).Error
+	return &price, err
+}
+
+// GetWithoutPrices 获取没有计费周期的套餐 (升级前创建的套餐)
+func (r *PlanRepository) GetWithoutPrices() ([]model.Plan, error) {
+	var plans []model.Plan
+	err := global.DB.Where("NOT EXISTS (SELECT 1 FROM plan_prices WHERE plan_prices.plan_id = plans.id)").
+		Find(&plans).Error
+	return plans, err
+}
+
+// CreatePrices 创建计费周期
+func (r *PlanRepository) CreatePrices(prices []model.PlanPrice) error {
+	return global.DB.Create(&prices).Error
+}
+
+// Update 更新套餐，prices 不为 nil 时替换全部计费周期
+func (r *PlanRepository) Update(plan *model.Plan, prices []model.PlanPrice) error {
+	return global.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Prices").Save(plan).Error; err != nil {
+			return err
+		}
+		if prices == nil {
+			return nil
+		}
+		if err := tx.Where("plan_id = ?", plan.ID).Delete(&model.PlanPrice{}).Error; err != nil {
+			return err
+		}
+		for i := range prices {
+			prices[i].PlanID = plan.ID
+		}
+		if err := tx.Create(&prices).Error; err != nil {
+			return err
+		}
+		plan.Prices = prices
+		return nil
+	})
 }
 
 // Delete 删除套餐
@@ -3,6 +3,7 @@ package repository
 import (
 	"nodepassPanel/internal/global"
 	"nodepassPanel/internal/model"
+	"time"
 )
 
 type UserRepository struct{}
@@ -44,8 +45,15 @@ func (r *UserRepository) EmailExists(email string) bool {
 }
 
 // Update 更新用户
+// 余额与佣金只能通过资金流水变动；流量计数由采集任务并发累加，续费周期由自动续费任务维护，不随其他字段回写
 func (r *UserRepository) Update(user *model.User) error {
-	return global.DB.Save(user).Error
+	return global.DB.Omit("balance", "commission", "upload", "download", "auto_renew_cycle").Save(user).Error
+}
+
+// ResetTraffic 清零已用流量
+func (r *UserRepository) ResetTraffic(id uint) error {
+	return global.DB.Model(&model.User{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"upload": 0, "download": 0}).Error
 }
 
 // Delete 删除用户
@@ -113,6 +121,61 @@ func (r *UserRepository) CountByInviter(inviterID uint) int64 {
 	return count
 }
 
+// GetTrafficResetDue 获取到达按月重置流量时间且套餐未到期的用户
+func (r *UserRepository) GetTrafficResetDue(now time.Time) ([]model.User, error) {
+	var users []model.User
+	err := global.DB.Where("traffic_reset_at <= ? AND expired_at > ?", now, now).Find(&users).Error
+	return users, err
+}
+
+// ResetMonthlyTraffic 清零已用流量并重置额度，以原重置时间为条件避免重复重置
+func (r *UserRepository) ResetMonthlyTraffic(id uint, resetAt time.Time, transfer int64, next *time.Time) (bool, error) {
+	result := global.DB.Model(&model.User{}).
+		Where("id = ? AND traffic_reset_at = ?", id, resetAt).
+		Updates(map[string]interface{}{
+			"upload":           0,
+			"download":         0,
+			"transfer_enable":  transfer,
+			"traffic_reset_at": next,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetAutoRenewDue 获取正常状态、开启自动续费、在 before 之前到期、本周期未续费且已到重试时间的用户
+func (r *UserRepository) GetAutoRenewDue(before, now time.Time) ([]model.User, error) {
+	var users []model.User
+	err := global.DB.Where("status = ? AND auto_renew = ? AND expired_at IS NOT NULL AND expired_at <= ?", 1, true, before).
+		Where("auto_renew_cycle IS NULL OR auto_renew_cycle <> expired_at").
+		Where("auto_renew_retry_at IS NULL OR auto_renew_retry_at <= ?", now).
+		Find(&users).Error
+	return users, err
+}
+
+// ClaimAutoRenew 以到期时间为条件占用本周期的续费，已被占用或用户状态、到期时间已变化时返回 false
+func (r *UserRepository) ClaimAutoRenew(id uint, expiredAt time.Time) (bool, error) {
+	result := global.DB.Model(&model.User{}).
+		Where("id = ? AND status = ? AND auto_renew = ? AND expired_at = ?", id, 1, true, expiredAt).
+		Where("auto_renew_cycle IS NULL OR auto_renew_cycle <> ?", expiredAt).
+		Update("auto_renew_cycle", expiredAt)
+	return result.RowsAffected > 0, result.Error
+}
+
+// ReleaseAutoRenew 续费失败时释放本周期的占用，以便按重试时间再次续费
+func (r *UserRepository) ReleaseAutoRenew(id uint, expiredAt time.Time) error {
+	return global.DB.Model(&model.User{}).
+		Where("id = ? AND auto_renew_cycle = ?", id, expiredAt).
+		Update("auto_renew_cycle", nil).Error
+}
+
+// UpdateAutoRenew 更新自动续费状态
+func (r *UserRepository) UpdateAutoRenew(id uint, enabled bool, failures int, retryAt *time.Time) error {
+	return global.DB.Model(&model.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"auto_renew":          enabled,
+		"auto_renew_failures": failures,
+		"auto_renew_retry_at": retryAt,
+	}).Error
+}
+
 // ==================== 批量操作 ====================
 
 // BatchUpdateStatus 批量更新用户状态
@@ -121,13 +184,6 @@ func (r *UserRepository) BatchUpdateStatus(ids []uint, status int) (int64, error
 	return result.RowsAffected, result.Error
 }
 
-// BatchAddBalance 批量充值
-func (r *UserRepository) BatchAddBalance(ids []uint, amount float64) (int64, error) {
-	result := global.DB.Model(&model.User{}).Where("id IN ?", ids).
-		Update("balance", global.DB.Raw("balance + ?", amount))
-	return result.RowsAffected, result.Error
-}
-
 // BatchDelete 批量删除用户
 func (r *UserRepository) BatchDelete(ids []uint) (int64, error) {
 	result := global.DB.Where("id IN ?", ids).Delete(&model.User{})
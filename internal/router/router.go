@@ -70,6 +70,7 @@ func InitRouter() *gin.Engine {
 		// 支付回调
 		paymentHandler := handler.NewPaymentHandler()
 		api.Any("/payment/notify/:method", paymentHandler.Notify)
+		api.GET("/payment/methods", paymentHandler.Methods)
 
 		// WebSocket
 		wsHandler := handler.NewWSHandler()
@@ -88,6 +89,15 @@ func InitRouter() *gin.Engine {
 			// 节点列表 (用户可见节点)
 			nodeHandler := handler.NewNodeHandler()
 			user.GET("/nodes", nodeHandler.ListNodes)
+			user.GET("/nodes/uptime", nodeHandler.Uptime)
+
+			// 转发规则
+			instanceHandler := handler.NewInstanceHandler()
+			user.GET("/instances", instanceHandler.List)
+			user.GET("/instances/:id", instanceHandler.Get)
+			user.POST("/instances", instanceHandler.Create)
+			user.PUT("/instances/:id", instanceHandler.Update)
+			user.DELETE("/instances/:id", instanceHandler.Delete)
 
 			// 订单
 			orderHandler := handler.NewOrderHandler()
@@ -95,6 +105,13 @@ func InitRouter() *gin.Engine {
 			user.GET("/orders/:id", orderHandler.Get)
 			user.POST("/orders", orderHandler.Create)
 			user.POST("/orders/:id/cancel", orderHandler.Cancel)
+			user.GET("/orders/upgrade/quote", orderHandler.UpgradeQuote)
+			user.POST("/orders/upgrade", orderHandler.Upgrade)
+
+			// 自动续费
+			autoRenewHandler := handler.NewAutoRenewHandler()
+			user.GET("/auto-renew", autoRenewHandler.Get)
+			user.PUT("/auto-renew", autoRenewHandler.Update)
 
 			// 邀请系统
 			inviteHandler := handler.NewInviteHandler()
@@ -105,6 +122,10 @@ func InitRouter() *gin.Engine {
 			rechargeHandler := handler.NewRechargeHandler()
 			user.POST("/recharge/online", rechargeHandler.CreateOnlineRecharge)
 
+			// 资金流水
+			balanceHandler := handler.NewBalanceHandler()
+			user.GET("/balance/logs", balanceHandler.Logs)
+
 			// 优惠券
 			couponHandler := handler.NewCouponHandler()
 			user.POST("/coupons/verify", couponHandler.Verify)
@@ -144,6 +165,26 @@ func InitRouter() *gin.Engine {
 			admin.DELETE("/nodes/:id", nodeHandler.Delete)
 			admin.POST("/nodes/:id/ping", nodeHandler.TestNode)
 			admin.POST("/nodes/:id/refresh", nodeHandler.Refresh)
+			admin.GET("/nodes/:id/ports", nodeHandler.Ports)
+			admin.GET("/nodes/:id/metrics", nodeHandler.Metrics)
+
+			// 节点故障告警
+			incidentHandler := handler.NewIncidentHandler()
+			admin.GET("/incidents", incidentHandler.List)
+			admin.GET("/incidents/:id", incidentHandler.Get)
+			admin.POST("/alerts/test", incidentHandler.TestChannels)
+
+			// WebSocket 运行统计
+			admin.GET("/ws/stats", wsHandler.Stats)
+
+			// 转发规则管理
+			instanceHandler := handler.NewInstanceHandler()
+			admin.GET("/instances", instanceHandler.AdminList)
+			admin.GET("/instances/:id", instanceHandler.AdminGet)
+			admin.POST("/instances", instanceHandler.AdminCreate)
+			admin.PUT("/instances/:id", instanceHandler.AdminUpdate)
+			admin.DELETE("/instances/:id", instanceHandler.AdminDelete)
+			admin.GET("/instances/:id/events", instanceHandler.AdminEvents)
 
 			// 套餐管理
 			admin.GET("/plans", planHandler.AdminList)
@@ -170,14 +211,24 @@ func InitRouter() *gin.Engine {
 			admin.PUT("/settings/batch", settingHandler.BatchUpdate)
 			admin.DELETE("/settings/:key", settingHandler.Delete)
 
+			// 支付网关
+			gatewayHandler := handler.NewPaymentHandler()
+			admin.GET("/payment/gateways", gatewayHandler.AdminGateways)
+			admin.PUT("/payment/gateways/:name", gatewayHandler.AdminUpdateGateway)
+
 			// 订单管理
 			orderHandler := handler.NewOrderHandler()
 			admin.GET("/orders", orderHandler.AdminList)
 			admin.GET("/orders/:id", orderHandler.AdminGet)
+			admin.GET("/orders/:id/payments", orderHandler.AdminPayments)
 			admin.POST("/orders/:id/paid", orderHandler.MarkPaid)
 			admin.POST("/orders/:id/refund", orderHandler.Refund)
 			admin.DELETE("/orders/:id", orderHandler.Delete)
 
+			// 资金流水审计
+			balanceHandler := handler.NewBalanceHandler()
+			admin.GET("/balance/logs", balanceHandler.AdminLogs)
+
 			// 优惠券管理
 			couponHandler := handler.NewCouponHandler()
 			admin.GET("/coupons", couponHandler.GetList)
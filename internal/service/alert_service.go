@@ -0,0 +1,376 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"nodepassPanel/internal/config"
+	"nodepassPanel/internal/model"
+	"nodepassPanel/internal/repository"
+	"nodepassPanel/pkg/logger"
+	"nodepassPanel/pkg/notify"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// 告警默认参数
+const (
+	defaultFailThreshold    = 3
+	defaultRecoverThreshold = 2
+	defaultFlapWindow       = 60 // 分钟
+	defaultFlapLimit        = 3
+)
+
+// 告警事件类型
+const (
+	AlertEventNodeDown      = "node_down"
+	AlertEventNodeRecovered = "node_recovered"
+	AlertEventTest          = "test"
+)
+
+// AlertService 节点故障告警服务
+// 连续失败 FailThreshold 次产生故障，连续成功 RecoverThreshold 次恢复；
+// FlapWindow 内故障次数达到 FlapLimit 时判定为抖动，抑制通知直到故障持续超过一个窗口
+type AlertService struct {
+	incidentRepo    *repository.NodeIncidentRepository
+	failoverService *FailoverService
+	channels        []notify.Notifier
+
+	mu     sync.Mutex
+	loaded bool
+	states map[uint]*nodeAlertState
+}
+
+// nodeAlertState 节点告警状态 (仅保存在内存，重启后由未恢复的故障记录重建)
+type nodeAlertState struct {
+	fails       int
+	successes   int
+	firstFailAt time.Time
+	incident    *model.NodeIncident
+}
+
+// NewAlertService 创建告警服务实例
+func NewAlertService() *AlertService {
+	return &AlertService{
+		incidentRepo:    repository.NewNodeIncidentRepository(),
+		failoverService: NewFailoverService(),
+		channels:        alertChannels(),
+		states:          make(map[uint]*nodeAlertState),
+	}
+}
+
+// IncidentQuery 故障记录查询
+type IncidentQuery struct {
+	Page     int    `form:"page" binding:"omitempty,min=1"`
+	PageSize int    `form:"page_size" binding:"omitempty,min=1,max=100"`
+	NodeID   uint   `form:"node_id"`
+	Status   string `form:"status" binding:"omitempty,oneof=open resolved"`
+}
+
+// IncidentListResponse 故障记录列表响应
+type IncidentListResponse struct {
+	List     []model.NodeIncident `json:"list"`
+	Total    int64                `json:"total"`
+	Page     int                  `json:"page"`
+	PageSize int                  `json:"page_size"`
+}
+
+// ChannelTestResult 通知通道测试结果
+type ChannelTestResult struct {
+	Channel string `json:"channel"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Evaluate 根据一轮探测结果更新各节点告警状态
+func (s *AlertService) Evaluate(results []ProbeResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.loadOpenIncidents()
+
+	seen := make(map[uint]bool, len(results))
+	for i := range results {
+		result := &results[i]
+		seen[result.NodeID] = true
+
+		state, ok := s.states[result.NodeID]
+		if !ok {
+			state = &nodeAlertState{}
+			s.states[result.NodeID] = state
+		}
+
+		if result.Status == 1 {
+			s.handleSuccess(state, result)
+		} else {
+			s.handleFailure(state, result)
+		}
+	}
+
+	// 节点已被删除：直接关闭其未恢复的故障，不再通知
+	for nodeID, state := range s.states {
+		if seen[nodeID] {
+			continue
+		}
+		if state.incident != nil {
+			s.resolve(state.incident, time.Now(), false)
+		}
+		delete(s.states, nodeID)
+	}
+}
+
+// handleFailure 处理一次失败探测
+func (s *AlertService) handleFailure(state *nodeAlertState, result *ProbeResult) {
+	state.successes = 0
+	state.fails++
+	if state.fails == 1 {
+		state.firstFailAt = result.CheckedAt
+	}
+
+	cfg := alertConfig()
+
+	if incident := state.incident; incident != nil {
+		incident.FailCount++
+		incident.LastError = truncateError(result.Error)
+
+		// 抖动被抑制的故障若持续超过一个窗口，说明节点已稳定离线，补发通知
+		if !incident.Notified && result.CheckedAt.Sub(incident.StartedAt) >= time.Duration(cfg.FlapWindow)*time.Minute {
+			incident.Notified = true
+			s.notify(nodeDownMessage(*incident))
+		}
+
+		if err := s.incidentRepo.Update(incident); err != nil {
+			logger.Log.Error("Alert: 更新故障记录失败", zap.Uint("incident_id", incident.ID), zap.Error(err))
+		}
+		return
+	}
+
+	if state.fails < cfg.FailThreshold {
+		return
+	}
+
+	incident := &model.NodeIncident{
+		NodeID:    result.NodeID,
+		NodeName:  result.Name,
+		Status:    model.NodeIncidentOpen,
+		StartedAt: state.firstFailAt,
+		FailCount: state.fails,
+		LastError: truncateError(result.Error),
+	}
+
+	recent, err := s.incidentRepo.CountSince(result.NodeID, result.CheckedAt.Add(-time.Duration(cfg.FlapWindow)*time.Minute))
+	if err != nil {
+		logger.Log.Error("Alert: 统计故障次数失败", zap.Uint("node_id", result.NodeID), zap.Error(err))
+	}
+	incident.Flapping = int(recent)+1 >= cfg.FlapLimit
+	incident.Notified = !incident.Flapping
+
+	if err := s.incidentRepo.Create(incident); err != nil {
+		logger.Log.Error("Alert: 创建故障记录失败", zap.Uint("node_id", result.NodeID), zap.Error(err))
+		return
+	}
+	state.incident = incident
+
+	logger.Log.Warn("Alert: 节点故障",
+		zap.Uint("node_id", result.NodeID), zap.Int("fails", state.fails), zap.Bool("flapping", incident.Flapping))
+
+	if incident.Notified {
+		s.notify(nodeDownMessage(*incident))
+	}
+
+	go s.failoverService.FailoverNode(result.NodeID)
+}
+
+// handleSuccess 处理一次成功探测
+func (s *AlertService) handleSuccess(state *nodeAlertState, result *ProbeResult) {
+	state.fails = 0
+	if state.incident == nil {
+		state.successes = 0
+		return
+	}
+
+	state.successes++
+	if state.successes < alertConfig().RecoverThreshold {
+		return
+	}
+
+	s.resolve(state.incident, result.CheckedAt, true)
+	go s.failoverService.RecoverNode(result.NodeID, state.incident.Flapping)
+	state.incident = nil
+	state.successes = 0
+}
+
+// resolve 关闭故障，仅当故障通知已发出时才发送恢复通知
+func (s *AlertService) resolve(incident *model.NodeIncident, at time.Time, notifyRecovery bool) {
+	incident.Status = model.NodeIncidentResolved
+	incident.ResolvedAt = &at
+	incident.Duration = int64(at.Sub(incident.StartedAt).Seconds())
+
+	if err := s.incidentRepo.Update(incident); err != nil {
+		logger.Log.Error("Alert: 更新故障记录失败", zap.Uint("incident_id", incident.ID), zap.Error(err))
+	}
+
+	logger.Log.Info("Alert: 节点恢复", zap.Uint("node_id", incident.NodeID), zap.Int64("duration", incident.Duration))
+
+	if notifyRecovery && incident.Notified {
+		s.notify(nodeRecoveredMessage(*incident))
+	}
+}
+
+// loadOpenIncidents 首次运行时从数据库恢复未关闭的故障
+func (s *AlertService) loadOpenIncidents() {
+	if s.loaded {
+		return
+	}
+
+	incidents, err := s.incidentRepo.GetOpen()
+	if err != nil {
+		logger.Log.Error("Alert: 加载未恢复故障失败", zap.Error(err))
+		return
+	}
+	for i := range incidents {
+		s.states[incidents[i].NodeID] = &nodeAlertState{incident: &incidents[i]}
+	}
+	s.loaded = true
+}
+
+// notify 异步发送到所有已启用的通道
+func (s *AlertService) notify(msg *notify.Message) {
+	for _, channel := range s.channels {
+		go func(channel notify.Notifier) {
+			if err := channel.Send(msg); err != nil {
+				logger.Log.Error("Alert: 发送通知失败",
+					zap.String("channel", channel.Name()), zap.String("event", msg.Event), zap.Error(err))
+			}
+		}(channel)
+	}
+}
+
+// GetIncidents 获取故障记录列表
+func (s *AlertService) GetIncidents(query *IncidentQuery) (*IncidentListResponse, error) {
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	if query.PageSize < 1 {
+		query.PageSize = 20
+	}
+
+	incidents, total, err := s.incidentRepo.GetPaginated(query.Page, query.PageSize, query.NodeID, query.Status)
+	if err != nil {
+		return nil, err
+	}
+
+	return &IncidentListResponse{
+		List:     incidents,
+		Total:    total,
+		Page:     query.Page,
+		PageSize: query.PageSize,
+	}, nil
+}
+
+// GetIncident 获取故障详情
+func (s *AlertService) GetIncident(id uint) (*model.NodeIncident, error) {
+	return s.incidentRepo.GetByID(id)
+}
+
+// TestChannels 向所有已启用通道发送测试消息并同步返回结果
+func (s *AlertService) TestChannels() ([]ChannelTestResult, error) {
+	if len(s.channels) == 0 {
+		return nil, errors.New("no alert channel enabled")
+	}
+
+	msg := &notify.Message{
+		Event:   AlertEventTest,
+		Title:   "告警通道测试",
+		Content: "这是一条测试消息，收到说明告警通道配置正确。",
+		Time:    time.Now(),
+	}
+
+	results := make([]ChannelTestResult, 0, len(s.channels))
+	for _, channel := range s.channels {
+		result := ChannelTestResult{Channel: channel.Name(), Success: true}
+		if err := channel.Send(msg); err != nil {
+			result.Success = false
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// alertConfig 返回填充默认值后的告警配置
+func alertConfig() config.AlertConfig {
+	cfg := config.App.Alert
+	if cfg.FailThreshold <= 0 {
+		cfg.FailThreshold = defaultFailThreshold
+	}
+	if cfg.RecoverThreshold <= 0 {
+		cfg.RecoverThreshold = defaultRecoverThreshold
+	}
+	if cfg.FlapWindow <= 0 {
+		cfg.FlapWindow = defaultFlapWindow
+	}
+	if cfg.FlapLimit <= 0 {
+		cfg.FlapLimit = defaultFlapLimit
+	}
+	return cfg
+}
+
+// alertChannels 根据配置构建已启用的通知通道
+func alertChannels() []notify.Notifier {
+	cfg := config.App.Alert
+	var channels []notify.Notifier
+
+	if cfg.Email.Enabled && len(cfg.Email.To) > 0 {
+		channels = append(channels, notify.NewEmailNotifier(cfg.Email.To))
+	}
+	if cfg.Webhook.Enabled && cfg.Webhook.URL != "" {
+		channels = append(channels, notify.NewWebhookNotifier(cfg.Webhook.URL, cfg.Webhook.Secret))
+	}
+	if cfg.Telegram.Enabled && cfg.Telegram.BotToken != "" && cfg.Telegram.ChatID != "" {
+		channels = append(channels, notify.NewTelegramNotifier(cfg.Telegram.BotToken, cfg.Telegram.ChatID))
+	}
+
+	return channels
+}
+
+// nodeDownMessage 构建节点故障通知 (传值以免异步发送时与后续更新竞争)
+func nodeDownMessage(incident model.NodeIncident) *notify.Message {
+	content := fmt.Sprintf("节点: %s (ID %d)\n开始时间: %s\n连续失败: %d 次",
+		incident.NodeName, incident.NodeID, incident.StartedAt.Format("2006-01-02 15:04:05"), incident.FailCount)
+	if incident.LastError != "" {
+		content += "\n错误: " + incident.LastError
+	}
+	if incident.Flapping {
+		content += "\n注意: 该节点近期频繁抖动"
+	}
+
+	return &notify.Message{
+		Event:   AlertEventNodeDown,
+		Title:   fmt.Sprintf("节点离线: %s", incident.NodeName),
+		Content: content,
+		Data:    &incident,
+		Time:    time.Now(),
+	}
+}
+
+// nodeRecoveredMessage 构建节点恢复通知
+func nodeRecoveredMessage(incident model.NodeIncident) *notify.Message {
+	return &notify.Message{
+		Event: AlertEventNodeRecovered,
+		Title: fmt.Sprintf("节点恢复: %s", incident.NodeName),
+		Content: fmt.Sprintf("节点: %s (ID %d)\n故障时长: %s",
+			incident.NodeName, incident.NodeID, time.Duration(incident.Duration)*time.Second),
+		Data: &incident,
+		Time: time.Now(),
+	}
+}
+
+// truncateError 截断错误信息以适配字段长度
+func truncateError(msg string) string {
+	if len(msg) > 255 {
+		return msg[:255]
+	}
+	return msg
+}
@@ -0,0 +1,310 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"nodepassPanel/internal/model"
+	"nodepassPanel/internal/payment"
+	"nodepassPanel/internal/repository"
+	"nodepassPanel/internal/websocket"
+	"nodepassPanel/pkg/email"
+	"nodepassPanel/pkg/logger"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultAutoRenewDays = 3 // 默认到期前 3 天续费
+	maxAutoRenewFailures = 5 // 连续失败达到次数后关闭自动续费
+)
+
+// 自动续费结果
+const (
+	AutoRenewSuccess             = "success"
+	AutoRenewInsufficientBalance = "insufficient_balance"
+	AutoRenewDisabled            = "disabled"
+)
+
+// AutoRenewNotice 自动续费结果推送内容
+type AutoRenewNotice struct {
+	Status    string     `json:"status"`
+	OrderNo   string     `json:"order_no,omitempty"`
+	Amount    float64    `json:"amount"`             // 续费金额
+	Balance   float64    `json:"balance"`            // 当前余额
+	ExpiredAt *time.Time `json:"expired_at"`         // 套餐到期时间
+	RetryAt   *time.Time `json:"retry_at,omitempty"` // 下次重试时间
+	Message   string     `json:"message"`
+}
+
+// AutoRenewStatus 自动续费设置
+type AutoRenewStatus struct {
+	Enabled  bool        `json:"enabled"`
+	Plan     *model.Plan `json:"plan"`     // 续费的套餐，没有可续费套餐时为空
+	Period   string      `json:"period"`   // 续费的计费周期
+	Amount   float64     `json:"amount"`   // 续费金额
+	RenewAt  *time.Time  `json:"renew_at"` // 计划续费时间
+	RetryAt  *time.Time  `json:"retry_at"` // 余额不足后的下次重试时间
+	Failures int         `json:"failures"`
+}
+
+// AutoRenewRequest 自动续费设置请求
+type AutoRenewRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+// AutoRenewService 自动续费服务
+// 每日检查开启自动续费且即将到期的用户，通过余额支付续费当前套餐
+type AutoRenewService struct {
+	userRepo       *repository.UserRepository
+	orderRepo      *repository.OrderRepository
+	planRepo       *repository.PlanRepository
+	orderService   *OrderService
+	settingService *SettingService
+	mailer         email.Mailer
+}
+
+// NewAutoRenewService 创建自动续费服务实例
+func NewAutoRenewService() *AutoRenewService {
+	return &AutoRenewService{
+		userRepo:       repository.NewUserRepository(),
+		orderRepo:      repository.NewOrderRepository(),
+		planRepo:       repository.NewPlanRepository(),
+		orderService:   NewOrderService(),
+		settingService: NewSettingService(),
+		mailer:         email.NewSMTPMailer(),
+	}
+}
+
+// GetStatus 获取用户的自动续费设置
+func (s *AutoRenewService) GetStatus(userID uint) (*AutoRenewStatus, error) {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	status := &AutoRenewStatus{
+		Enabled:  user.AutoRenew,
+		RetryAt:  user.AutoRenewRetryAt,
+		Failures: user.AutoRenewFailures,
+	}
+	if plan, price, err := s.renewPlan(userID); err == nil {
+		status.Plan = plan
+		status.Period = price.Period
+		status.Amount = price.Price
+	}
+	if user.ExpiredAt != nil {
+		renewAt := user.ExpiredAt.AddDate(0, 0, -s.renewDays())
+		status.RenewAt = &renewAt
+	}
+	return status, nil
+}
+
+// SetEnabled 开启或关闭自动续费，开启时需要有可续费的套餐
+func (s *AutoRenewService) SetEnabled(userID uint, enabled bool) (*AutoRenewStatus, error) {
+	if enabled {
+		if _, _, err := s.renewPlan(userID); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.userRepo.UpdateAutoRenew(userID, enabled, 0, nil); err != nil {
+		return nil, err
+	}
+	return s.GetStatus(userID)
+}
+
+// RenewDue 为即将到期的用户续费，余额不足时提醒并按退避间隔重试
+func (s *AutoRenewService) RenewDue() {
+	now := time.Now()
+	before := now.AddDate(0, 0, s.renewDays())
+	users, err := s.userRepo.GetAutoRenewDue(before, now)
+	if err != nil {
+		logger.Log.Error("自动续费: 获取用户失败", zap.Error(err))
+		return
+	}
+
+	for i := range users {
+		s.renew(&users[i], now, before)
+	}
+}
+
+// renew 占用本周期续费后创建续费订单并通过余额支付，失败时释放占用
+// before 为提前续费窗口的截止时间
+func (s *AutoRenewService) renew(user *model.User, now, before time.Time) {
+	plan, price, err := s.renewPlan(user.ID)
+	if err != nil {
+		s.disable(user, err.Error())
+		return
+	}
+
+	// 续费后仍在提前续费窗口内时每日任务会反复续费
+	base := now
+	if user.ExpiredAt.After(now) {
+		base = *user.ExpiredAt
+	}
+	if !base.AddDate(0, 0, price.Duration).After(before) {
+		s.disable(user, fmt.Sprintf("计费周期 %d 天不长于提前续费天数", price.Duration))
+		return
+	}
+
+	// 余额明显不足时不创建订单，直接提醒
+	if user.Balance < price.Price {
+		s.fail(user, price.Price, now, true)
+		return
+	}
+
+	// 以当前到期时间占用本周期，并发或重复执行的任务不会重复续费
+	cycle := *user.ExpiredAt
+	claimed, err := s.userRepo.ClaimAutoRenew(user.ID, cycle)
+	if err != nil {
+		logger.Log.Error("自动续费: 占用续费周期失败", zap.Uint("user_id", user.ID), zap.Error(err))
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	order, err := s.orderService.Create(user.ID, &CreateOrderRequest{
+		PlanID: plan.ID,
+		Period: price.Period,
+		Remark: "自动续费",
+	})
+	if err != nil {
+		logger.Log.Warn("自动续费: 创建订单失败", zap.Uint("user_id", user.ID), zap.Error(err))
+		s.release(user.ID, cycle)
+		s.fail(user, price.Price, now, false)
+		return
+	}
+
+	if _, err := s.orderService.PayOrder(order.OrderNo, payment.MethodBalance, ""); err != nil {
+		if _, cancelErr := s.orderService.cancelPending(order, "自动续费支付失败"); cancelErr != nil {
+			logger.Log.Error("自动续费: 取消订单失败", zap.String("order_no", order.OrderNo), zap.Error(cancelErr))
+		}
+		if !errors.Is(err, errInsufficientBalance) {
+			logger.Log.Warn("自动续费: 支付失败", zap.String("order_no", order.OrderNo), zap.Error(err))
+		}
+		s.release(user.ID, cycle)
+		s.fail(user, price.Price, now, errors.Is(err, errInsufficientBalance))
+		return
+	}
+
+	if err := s.userRepo.UpdateAutoRenew(user.ID, true, 0, nil); err != nil {
+		logger.Log.Error("自动续费: 更新状态失败", zap.Uint("user_id", user.ID), zap.Error(err))
+	}
+
+	renewed, err := s.userRepo.GetByID(user.ID)
+	if err != nil {
+		renewed = user
+	}
+	s.notify(renewed, &AutoRenewNotice{
+		Status:    AutoRenewSuccess,
+		OrderNo:   order.OrderNo,
+		Amount:    order.Paid,
+		Balance:   renewed.Balance,
+		ExpiredAt: renewed.ExpiredAt,
+		Message:   fmt.Sprintf("已从余额扣除 ¥%.2f 续费套餐「%s」", order.Paid, plan.Name),
+	})
+}
+
+// release 释放本周期的续费占用
+func (s *AutoRenewService) release(userID uint, cycle time.Time) {
+	if err := s.userRepo.ReleaseAutoRenew(userID, cycle); err != nil {
+		logger.Log.Error("自动续费: 释放续费周期失败", zap.Uint("user_id", userID), zap.Error(err))
+	}
+}
+
+// fail 记录一次续费失败，下次重试间隔按 1、2、4、8 天递增，达到上限后关闭自动续费
+func (s *AutoRenewService) fail(user *model.User, amount float64, now time.Time, remind bool) {
+	failures := user.AutoRenewFailures + 1
+	if failures >= maxAutoRenewFailures {
+		s.disable(user, fmt.Sprintf("连续 %d 次续费失败", failures))
+		return
+	}
+
+	// 按自然日计算，保证每日任务在重试当天能再次处理
+	year, month, day := now.Date()
+	retryAt := time.Date(year, month, day, 0, 0, 0, 0, now.Location()).AddDate(0, 0, 1<<(failures-1))
+	if err := s.userRepo.UpdateAutoRenew(user.ID, true, failures, &retryAt); err != nil {
+		logger.Log.Error("自动续费: 更新状态失败", zap.Uint("user_id", user.ID), zap.Error(err))
+		return
+	}
+
+	if remind {
+		s.notify(user, &AutoRenewNotice{
+			Status:    AutoRenewInsufficientBalance,
+			Amount:    amount,
+			Balance:   user.Balance,
+			ExpiredAt: user.ExpiredAt,
+			RetryAt:   &retryAt,
+			Message:   fmt.Sprintf("余额 ¥%.2f 不足以自动续费 ¥%.2f，请及时充值", user.Balance, amount),
+		})
+	}
+}
+
+// disable 关闭自动续费并通知用户
+func (s *AutoRenewService) disable(user *model.User, reason string) {
+	if err := s.userRepo.UpdateAutoRenew(user.ID, false, 0, nil); err != nil {
+		logger.Log.Error("自动续费: 更新状态失败", zap.Uint("user_id", user.ID), zap.Error(err))
+		return
+	}
+	s.notify(user, &AutoRenewNotice{
+		Status:    AutoRenewDisabled,
+		Balance:   user.Balance,
+		ExpiredAt: user.ExpiredAt,
+		Message:   fmt.Sprintf("自动续费已关闭: %s", reason),
+	})
+}
+
+// notify 推送续费结果并发送邮件
+func (s *AutoRenewService) notify(user *model.User, notice *AutoRenewNotice) {
+	websocket.PushToUser(user.ID, websocket.NewEvent(websocket.EventAutoRenew, notice))
+
+	content := notice.Message
+	if notice.ExpiredAt != nil {
+		content += fmt.Sprintf("\n套餐到期时间: %s", notice.ExpiredAt.Format("2006-01-02 15:04"))
+	}
+	if notice.RetryAt != nil {
+		content += fmt.Sprintf("\n下次尝试续费: %s", notice.RetryAt.Format("2006-01-02"))
+	}
+	go func(to string) {
+		if err := s.mailer.SendNotice(to, "套餐自动续费通知", content); err != nil {
+			logger.Log.Warn("自动续费: 发送通知失败", zap.String("to", to), zap.Error(err))
+		}
+	}(user.Email)
+}
+
+// renewPlan 获取续费的套餐与计费周期：用户当前套餐，未记录计费周期的旧订单按套餐有效期推断
+func (s *AutoRenewService) renewPlan(userID uint) (*model.Plan, *model.PlanPrice, error) {
+	current, err := s.orderRepo.GetCurrentPlanOrder(userID)
+	if err != nil {
+		return nil, nil, errors.New("没有可续费的套餐")
+	}
+	plan, err := s.planRepo.GetByID(*current.PlanID)
+	if err != nil {
+		return nil, nil, errors.New("当前套餐已下架")
+	}
+
+	period := current.Period
+	if period == "" {
+		period = periodForDuration(plan.Duration)
+	}
+	price, err := s.planRepo.GetPrice(plan.ID, period)
+	if err != nil {
+		return nil, nil, errors.New("当前套餐已不支持此计费周期")
+	}
+	return plan, price, nil
+}
+
+// renewDays 到期前多少天续费
+func (s *AutoRenewService) renewDays() int {
+	value, err := s.settingService.Get(model.SettingKeyAutoRenewDays)
+	if err != nil {
+		return defaultAutoRenewDays
+	}
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 1 {
+		return defaultAutoRenewDays
+	}
+	return days
+}
@@ -19,6 +19,7 @@ type CreateCouponRequest struct {
 	LimitPerUser int     `json:"limit_per_user"`
 	TotalLimit   int     `json:"total_limit"`
 	PlanIDs      string  `json:"plan_ids"`
+	Periods      string  `json:"periods"`    // 适用计费周期，逗号分隔，为空表示全部
 	StartAt      int64   `json:"start_at"`   // Unix timestamp
 	ExpiredAt    int64   `json:"expired_at"` // Unix timestamp
 	Status       int     `json:"status" binding:"oneof=0 1"`
@@ -33,6 +34,7 @@ type UpdateCouponRequest struct {
 	LimitPerUser int     `json:"limit_per_user"`
 	TotalLimit   int     `json:"total_limit"`
 	PlanIDs      string  `json:"plan_ids"`
+	Periods      string  `json:"periods"`
 	StartAt      int64   `json:"start_at"`
 	ExpiredAt    int64   `json:"expired_at"`
 	Status       int     `json:"status" binding:"oneof=0 1"`
@@ -41,12 +43,14 @@ type UpdateCouponRequest struct {
 type CouponService struct {
 	couponRepo repository.CouponRepo
 	orderRepo  *repository.OrderRepository
+	planRepo   *repository.PlanRepository
 }
 
 func NewCouponService() *CouponService {
 	return &CouponService{
 		couponRepo: repository.NewCouponRepo(),
 		orderRepo:  repository.NewOrderRepository(),
+		planRepo:   repository.NewPlanRepository(),
 	}
 }
 
@@ -69,6 +73,7 @@ func (s *CouponService) Create(req *CreateCouponRequest) error {
 		LimitPerUser: req.LimitPerUser,
 		TotalLimit:   req.TotalLimit,
 		PlanIDs:      req.PlanIDs,
+		Periods:      req.Periods,
 		Status:       req.Status,
 	}
 
@@ -110,6 +115,7 @@ func (s *CouponService) Update(id int, req *UpdateCouponRequest) error {
 	coupon.LimitPerUser = req.LimitPerUser
 	coupon.TotalLimit = req.TotalLimit
 	coupon.PlanIDs = req.PlanIDs
+	coupon.Periods = req.Periods
 	coupon.Status = req.Status
 
 	if req.StartAt > 0 {
@@ -146,8 +152,21 @@ func (s *CouponService) GenerateCode() string {
 	return string(b)
 }
 
+// VerifyForPlan 按套餐计费周期的价格验证优惠券
+func (s *CouponService) VerifyForPlan(code string, userID uint, planID uint, period string) (*model.Coupon, float64, float64, error) {
+	price, err := s.planRepo.GetPrice(planID, period)
+	if err != nil {
+		return nil, 0, 0, errors.New("该套餐不支持此计费周期")
+	}
+	coupon, discount, err := s.VerifyCoupon(code, userID, planID, period, price.Price)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return coupon, discount, price.Price, nil
+}
+
 // VerifyCoupon 验证优惠券并计算折扣
-func (s *CouponService) VerifyCoupon(code string, userID uint, planID uint, amount float64) (*model.Coupon, float64, error) {
+func (s *CouponService) VerifyCoupon(code string, userID uint, planID uint, period string, amount float64) (*model.Coupon, float64, error) {
 	// 1. 查找优惠券
 	coupon, err := s.couponRepo.FindByCode(code)
 	if err != nil {
@@ -207,12 +226,26 @@ func (s *CouponService) VerifyCoupon(code string, userID uint, planID uint, amou
 		}
 	}
 
-	// 7. 检查最低消费
+	// 7. 检查计费周期适用性
+	if coupon.Periods != "" {
+		found := false
+		for _, p := range strings.Split(coupon.Periods, ",") {
+			if strings.TrimSpace(p) == period {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, 0, errors.New("该计费周期不可使用此优惠券")
+		}
+	}
+
+	// 8. 检查最低消费
 	if amount < coupon.MinAmount {
 		return nil, 0, errors.New("未达到最低消费金额")
 	}
 
-	// 8. 计算折扣
+	// 9. 计算折扣
 	discount := 0.0
 	if coupon.Type == model.CouponTypeFixedAmount {
 		discount = coupon.Value
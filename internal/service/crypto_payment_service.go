@@ -0,0 +1,311 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"nodepassPanel/internal/model"
+	"nodepassPanel/internal/payment"
+	"nodepassPanel/internal/payment/crypto"
+	"nodepassPanel/internal/repository"
+	"nodepassPanel/pkg/logger"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+func init() {
+	// USDT 网关通过数据库保存报价
+	crypto.SetStore(&cryptoStore{repo: repository.NewCryptoPaymentRepository()})
+}
+
+// cryptoScanTimeout 单次链上查询的超时时间
+const cryptoScanTimeout = 20 * time.Second
+
+// cryptoStore 基于 crypto_payments 表的 USDT 报价存储
+type cryptoStore struct {
+	repo *repository.CryptoPaymentRepository
+}
+
+// Reserve 保存报价，订单已有金额一致且未过期的同网络报价时复用
+func (s *cryptoStore) Reserve(q *crypto.Quote, allocate func(pending []*crypto.Quote) (string, int64, error)) (*crypto.Quote, error) {
+	if current, err := s.repo.GetLatestByOrderNo(q.OrderNo); err == nil &&
+		current.Status == model.CryptoPaymentPending &&
+		current.Network == string(q.Network) &&
+		payment.ToCents(current.CNY) == payment.ToCents(q.CNY) &&
+		time.Now().Before(current.ExpiresAt) {
+		return toQuote(current), nil
+	}
+
+	for attempt := 0; attempt < 3; attempt++ {
+		records, err := s.repo.GetOpen(string(q.Network))
+		if err != nil {
+			return nil, err
+		}
+		address, amount, err := allocate(toQuotes(records))
+		if err != nil {
+			return nil, err
+		}
+
+		key := fmt.Sprintf("%s:%s:%d", q.Network, address, amount)
+		record := &model.CryptoPayment{
+			OrderNo:    q.OrderNo,
+			Network:    string(q.Network),
+			Address:    address,
+			Amount:     amount,
+			CNY:        q.CNY,
+			Rate:       q.Rate,
+			PendingKey: &key,
+			ExpiresAt:  q.ExpiresAt,
+		}
+		err = s.repo.Reserve(record)
+		if err == nil {
+			return toQuote(record), nil
+		}
+		if !errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, err
+		}
+		// 金额被并发报价占用，重新分配
+	}
+	return nil, errors.New("USDT 收款金额分配冲突，请稍后重试")
+}
+
+// Get 获取订单已足额到账待确认的报价，没有时返回最近一次报价
+func (s *cryptoStore) Get(orderNo string) (*crypto.Quote, error) {
+	if record, err := s.repo.GetPaidOpen(orderNo); err == nil {
+		return toQuote(record), nil
+	}
+	record, err := s.repo.GetLatestByOrderNo(orderNo)
+	if err != nil {
+		return nil, err
+	}
+	return toQuote(record), nil
+}
+
+func toQuote(record *model.CryptoPayment) *crypto.Quote {
+	var hashes []string
+	if record.TxHashes != "" {
+		hashes = strings.Split(record.TxHashes, ",")
+	}
+	return &crypto.Quote{
+		OrderNo:   record.OrderNo,
+		Network:   crypto.Network(record.Network),
+		Address:   record.Address,
+		Amount:    record.Amount,
+		CNY:       record.CNY,
+		Rate:      record.Rate,
+		Received:  record.Received,
+		TxHashes:  hashes,
+		CreatedAt: record.CreatedAt,
+		ExpiresAt: record.ExpiresAt,
+	}
+}
+
+func toQuotes(records []model.CryptoPayment) []*crypto.Quote {
+	quotes := make([]*crypto.Quote, len(records))
+	for i := range records {
+		quotes[i] = toQuote(&records[i])
+	}
+	return quotes
+}
+
+// CryptoPaymentService USDT 链上到账确认服务
+type CryptoPaymentService struct {
+	repo           *repository.CryptoPaymentRepository
+	orderRepo      *repository.OrderRepository
+	orderService   *OrderService
+	paymentService *PaymentService
+	mu             sync.Mutex
+}
+
+// NewCryptoPaymentService 创建 USDT 到账确认服务实例
+func NewCryptoPaymentService() *CryptoPaymentService {
+	return &CryptoPaymentService{
+		repo:           repository.NewCryptoPaymentRepository(),
+		orderRepo:      repository.NewOrderRepository(),
+		orderService:   NewOrderService(),
+		paymentService: NewPaymentService(),
+	}
+}
+
+// Scan 查询链上转账确认待支付的 USDT 订单，并处理过期报价
+// 上一次扫描未结束时跳过
+func (s *CryptoPaymentService) Scan() {
+	if !s.mu.TryLock() {
+		return
+	}
+	defer s.mu.Unlock()
+
+	for _, network := range []crypto.Network{crypto.NetworkTRC20, crypto.NetworkERC20} {
+		if err := s.scanNetwork(network); err != nil {
+			logger.Log.Warn("USDT scan failed", zap.String("network", string(network)), zap.Error(err))
+		}
+	}
+	s.expire(time.Now())
+}
+
+// scanNetwork 将网络上的新转账归属到待支付与未过期的已失效报价，足额后完成订单
+func (s *CryptoPaymentService) scanNetwork(network crypto.Network) error {
+	records, err := s.repo.GetOpen(string(network))
+	if err != nil || len(records) == 0 {
+		return err
+	}
+
+	// 网关停用后仍需确认已报价的订单
+	method := crypto.MethodOf(network)
+	strategy, _, err := s.paymentService.Strategy(method)
+	if err != nil {
+		return err
+	}
+	usdt, ok := strategy.(*crypto.USDT)
+	if !ok {
+		return fmt.Errorf("unexpected strategy for %s", method)
+	}
+
+	return s.apply(network, usdt.Watcher, records)
+}
+
+// apply 查询报价地址的转账并累加到账数量
+func (s *CryptoPaymentService) apply(network crypto.Network, watcher crypto.Watcher, records []model.CryptoPayment) error {
+	quotes := toQuotes(records)
+	byQuote := make(map[*crypto.Quote]int, len(records))
+	since := make(map[string]time.Time)
+	for i, q := range quotes {
+		byQuote[q] = i
+		if t, ok := since[q.Address]; !ok || q.CreatedAt.Before(t) {
+			since[q.Address] = q.CreatedAt
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cryptoScanTimeout)
+	defer cancel()
+
+	var transfers []crypto.Transfer
+	for address, from := range since {
+		found, err := watcher.Transfers(ctx, network, address, from)
+		if err != nil {
+			logger.Log.Warn("USDT transfer query failed", zap.String("address", address), zap.Error(err))
+			continue
+		}
+		transfers = append(transfers, found...)
+	}
+
+	for q, matched := range crypto.Match(quotes, transfers) {
+		record := &records[byQuote[q]]
+		var received int64
+		hashes := q.TxHashes
+		for _, t := range matched {
+			received += t.Amount
+			hashes = append(hashes, t.Hash)
+		}
+		updated, err := s.repo.AddReceived(record.ID, received, record.TxHashes, strings.Join(hashes, ","))
+		if err != nil {
+			logger.Log.Error("Failed to record USDT transfer", zap.String("order_no", q.OrderNo), zap.Error(err))
+			continue
+		}
+		if !updated {
+			// 报价已被并发扫描更新或已结束，下次扫描按最新记录重新归属
+			continue
+		}
+		q.TxHashes = hashes
+		q.Received += received
+
+		if record.Status == model.CryptoPaymentSuperseded {
+			s.flagSuperseded(record, q, received)
+		}
+	}
+
+	// 包括之前确认失败的足额报价
+	for i, q := range quotes {
+		if q.Paid() {
+			s.confirm(&records[i], q)
+		}
+	}
+	return nil
+}
+
+// flagSuperseded 订单重新报价后旧报价仍收到转账，记录在订单备注中待人工核对
+// 旧报价足额时仍会尝试完成订单，订单已通过其他报价支付时需人工退款
+func (s *CryptoPaymentService) flagSuperseded(record *model.CryptoPayment, q *crypto.Quote, received int64) {
+	logger.Log.Warn("USDT received on superseded quote",
+		zap.String("order_no", q.OrderNo), zap.String("address", q.Address), zap.String("amount", crypto.FormatAmount(received)))
+
+	order, err := s.orderRepo.GetByOrderNo(record.OrderNo)
+	if err != nil {
+		return
+	}
+	note := fmt.Sprintf("USDT 已失效报价收到 %s (地址 %s，已收 %s / 应付 %s)，需人工核对",
+		crypto.FormatAmount(received), q.Address, crypto.FormatAmount(q.Received), crypto.FormatAmount(q.Amount))
+	if err := s.orderService.addRemark(order, note); err != nil {
+		logger.Log.Error("Failed to update order remark", zap.String("order_no", order.OrderNo), zap.Error(err))
+	}
+}
+
+// confirm 通过支付回调流程完成订单，多付部分记录在订单备注中
+func (s *CryptoPaymentService) confirm(record *model.CryptoPayment, q *crypto.Quote) {
+	method := crypto.MethodOf(q.Network)
+	if err := s.orderService.HandlePaymentNotify(method, map[string]string{"order_no": q.OrderNo}); err != nil {
+		logger.Log.Warn("USDT order confirmation failed", zap.String("order_no", q.OrderNo), zap.Error(err))
+		return
+	}
+	if _, err := s.repo.Finish(record.ID, model.CryptoPaymentPaid); err != nil {
+		logger.Log.Error("Failed to finish USDT quote", zap.String("order_no", q.OrderNo), zap.Error(err))
+	}
+
+	if q.Received > q.Amount {
+		order, err := s.orderRepo.GetByOrderNo(q.OrderNo)
+		if err != nil {
+			return
+		}
+		note := fmt.Sprintf("USDT 多付 %s (实收 %s / 应付 %s)", crypto.FormatAmount(q.Received-q.Amount),
+			crypto.FormatAmount(q.Received), crypto.FormatAmount(q.Amount))
+		if err := s.orderService.addRemark(order, note); err != nil {
+			logger.Log.Error("Failed to update order remark", zap.String("order_no", q.OrderNo), zap.Error(err))
+		}
+	}
+}
+
+// expire 结束过期报价：待支付报价对应的订单仍以该方式待支付时取消订单，
+// 少付、到账时订单已取消或已失效报价收到的款项记录在备注中待人工退款
+func (s *CryptoPaymentService) expire(now time.Time) {
+	records, err := s.repo.GetExpired(now)
+	if err != nil {
+		logger.Log.Error("Failed to load expired USDT quotes", zap.Error(err))
+		return
+	}
+
+	for i := range records {
+		record := &records[i]
+		finished, err := s.repo.Finish(record.ID, model.CryptoPaymentExpired)
+		if err != nil || !finished {
+			continue
+		}
+		order, err := s.orderRepo.GetByOrderNo(record.OrderNo)
+		if err != nil {
+			continue
+		}
+
+		note := "USDT 支付超时"
+		if record.Received > 0 {
+			note = fmt.Sprintf("USDT 报价过期，已收到 %s / 应付 %s，需人工退款",
+				crypto.FormatAmount(record.Received), crypto.FormatAmount(record.Amount))
+		}
+
+		// 已失效报价过期时订单可能仍有新的待支付报价，不取消订单
+		method := string(crypto.MethodOf(crypto.Network(record.Network)))
+		if record.Status == model.CryptoPaymentPending && order.Status == model.OrderStatusPending && order.PayMethod == method {
+			if _, err := s.orderService.cancelPending(order, note); err != nil {
+				logger.Log.Error("Failed to cancel expired USDT order", zap.String("order_no", order.OrderNo), zap.Error(err))
+			}
+			continue
+		}
+		if record.Received > 0 {
+			if err := s.orderService.addRemark(order, note); err != nil {
+				logger.Log.Error("Failed to update order remark", zap.String("order_no", order.OrderNo), zap.Error(err))
+			}
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package service
+
+import (
+	"errors"
+	"nodepassPanel/internal/model"
+	"nodepassPanel/internal/repository"
+	"nodepassPanel/internal/websocket"
+	"nodepassPanel/pkg/logger"
+	"nodepassPanel/pkg/nodepass"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// EnforcementService 配额与有效期执行服务
+// 用户超额、到期或被封禁时停用其在各节点上的实例，恢复后重新启用
+type EnforcementService struct {
+	userRepo     *repository.UserRepository
+	nodeRepo     *repository.NodeRepository
+	instanceRepo *repository.InstanceRepository
+	eventRepo    *repository.InstanceEventRepository
+}
+
+// NewEnforcementService 创建执行服务实例
+func NewEnforcementService() *EnforcementService {
+	return &EnforcementService{
+		userRepo:     repository.NewUserRepository(),
+		nodeRepo:     repository.NewNodeRepository(),
+		instanceRepo: repository.NewInstanceRepository(),
+		eventRepo:    repository.NewInstanceEventRepository(),
+	}
+}
+
+// InstanceEventQuery 状态变更记录查询
+type InstanceEventQuery struct {
+	Page       int  `form:"page" binding:"omitempty,min=1"`
+	PageSize   int  `form:"page_size" binding:"omitempty,min=1,max=100"`
+	InstanceID uint `form:"instance_id"`
+	UserID     uint `form:"user_id"`
+}
+
+// InstanceEventListResponse 状态变更记录列表响应
+type InstanceEventListResponse struct {
+	List     []model.InstanceEvent `json:"list"`
+	Total    int64                 `json:"total"`
+	Page     int                   `json:"page"`
+	PageSize int                   `json:"page_size"`
+}
+
+// EnforceAll 巡检所有拥有实例的用户，停用违规用户并恢复已合规用户
+func (s *EnforcementService) EnforceAll() {
+	activeUserIDs, err := s.instanceRepo.GetUserIDsBySuspended(false)
+	if err != nil {
+		logger.Log.Error("配额执行: 获取用户失败", zap.Error(err))
+		return
+	}
+	for _, userID := range activeUserIDs {
+		user, err := s.userRepo.GetByID(userID)
+		if err != nil {
+			continue
+		}
+		if reason := userViolation(user); reason != "" {
+			s.SuspendUser(userID, reason)
+		}
+	}
+
+	suspendedUserIDs, err := s.instanceRepo.GetUserIDsBySuspended(true)
+	if err != nil {
+		logger.Log.Error("配额执行: 获取用户失败", zap.Error(err))
+		return
+	}
+	for _, userID := range suspendedUserIDs {
+		user, err := s.userRepo.GetByID(userID)
+		if err != nil {
+			continue
+		}
+		if userViolation(user) == "" {
+			s.ResumeUser(userID, model.InstanceReasonRestored)
+		}
+	}
+}
+
+// SuspendUser 停用用户在所有节点上的实例
+func (s *EnforcementService) SuspendUser(userID uint, reason string) {
+	instances, err := s.instanceRepo.GetByUserIDAndSuspended(userID, false)
+	if err != nil {
+		logger.Log.Error("配额执行: 获取实例失败", zap.Uint("user_id", userID), zap.Error(err))
+		return
+	}
+
+	changed := make([]InstanceStatusChange, 0, len(instances))
+	for i := range instances {
+		instance := &instances[i]
+
+		// 用户主动停用的实例在节点上已处于停止状态，无需再操作节点
+		var nodeErr error
+		if instance.Enable && instance.NodePassID != "" {
+			nodeErr = s.control(instance, false)
+		}
+
+		if nodeErr != nil {
+			// 保持未停用状态，下一轮巡检重试
+			s.record(instance, model.InstanceActionSuspend, reason, nodeErr)
+			continue
+		}
+
+		instance.Suspended = true
+		instance.SuspendReason = reason
+		if instance.Enable {
+			instance.Status = model.InstanceStatusStopped
+		}
+		if err := s.instanceRepo.Update(instance); err != nil {
+			logger.Log.Error("配额执行: 更新实例失败", zap.Uint("instance_id", instance.ID), zap.Error(err))
+			continue
+		}
+		s.record(instance, model.InstanceActionSuspend, reason, nil)
+		changed = append(changed, instanceStatusChange(instance, model.InstanceActionSuspend, reason))
+	}
+
+	pushInstanceStatus(userID, changed)
+}
+
+// ResumeUser 恢复用户被停用的实例
+func (s *EnforcementService) ResumeUser(userID uint, reason string) {
+	instances, err := s.instanceRepo.GetByUserIDAndSuspended(userID, true)
+	if err != nil {
+		logger.Log.Error("配额执行: 获取实例失败", zap.Uint("user_id", userID), zap.Error(err))
+		return
+	}
+
+	changed := make([]InstanceStatusChange, 0, len(instances))
+	for i := range instances {
+		instance := &instances[i]
+
+		var nodeErr error
+		if instance.Enable && instance.NodePassID != "" {
+			nodeErr = s.control(instance, true)
+		}
+
+		if nodeErr != nil {
+			s.record(instance, model.InstanceActionResume, reason, nodeErr)
+			continue
+		}
+
+		instance.Suspended = false
+		instance.SuspendReason = ""
+		if instance.Enable {
+			instance.Status = model.InstanceStatusRunning
+		}
+		if err := s.instanceRepo.Update(instance); err != nil {
+			logger.Log.Error("配额执行: 更新实例失败", zap.Uint("instance_id", instance.ID), zap.Error(err))
+			continue
+		}
+		s.record(instance, model.InstanceActionResume, reason, nil)
+		changed = append(changed, instanceStatusChange(instance, model.InstanceActionResume, reason))
+	}
+
+	pushInstanceStatus(userID, changed)
+}
+
+// ResumeIfCompliant 用户合规时恢复其实例 (购买套餐、解封后调用)
+func (s *EnforcementService) ResumeIfCompliant(userID uint, reason string) {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return
+	}
+	if userViolation(user) == "" {
+		s.ResumeUser(userID, reason)
+	}
+}
+
+// SuspendIfViolating 用户违规时停用其实例 (退款收回权益后调用)
+func (s *EnforcementService) SuspendIfViolating(userID uint) {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return
+	}
+	if reason := userViolation(user); reason != "" {
+		s.SuspendUser(userID, reason)
+	}
+}
+
+// GetEvents 获取状态变更记录
+func (s *EnforcementService) GetEvents(query *InstanceEventQuery) (*InstanceEventListResponse, error) {
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	if query.PageSize < 1 {
+		query.PageSize = 20
+	}
+
+	events, total, err := s.eventRepo.GetPaginated(query.Page, query.PageSize, query.InstanceID, query.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &InstanceEventListResponse{
+		List:     events,
+		Total:    total,
+		Page:     query.Page,
+		PageSize: query.PageSize,
+	}, nil
+}
+
+// control 在节点上启动或停止实例
+// 启动时同时下发本地保存的 URL，停用期间修改的目标在恢复时生效
+func (s *EnforcementService) control(instance *model.Instance, start bool) error {
+	node, err := s.nodeRepo.GetByID(instance.NodeID)
+	if err != nil {
+		return errors.New("node not found")
+	}
+
+	client := newNodeClient(node)
+	if start {
+		_, err = client.UpdateInstance(instance.NodePassID, &nodepass.UpdateInstanceRequest{URL: instanceURL(instance)})
+	} else {
+		_, err = client.StopInstance(instance.NodePassID)
+	}
+	return err
+}
+
+// record 记录实例状态变更：成功记录在状态实际变化后写入，连续相同的失败只记录一次
+func (s *EnforcementService) record(instance *model.Instance, action, reason string, nodeErr error) {
+	event := &model.InstanceEvent{
+		InstanceID: instance.ID,
+		UserID:     instance.UserID,
+		NodeID:     instance.NodeID,
+		Action:     action,
+		Reason:     reason,
+		Success:    nodeErr == nil,
+	}
+	if nodeErr != nil {
+		event.Error = nodeErr.Error()
+		if len(event.Error) > 255 {
+			event.Error = event.Error[:255]
+		}
+
+		// 节点不可用时每轮巡检都会重试，与上一条失败记录相同时不重复写入
+		if last, err := s.eventRepo.GetLatest(instance.ID); err == nil && !last.Success &&
+			last.Action == event.Action && last.Reason == event.Reason && last.Error == event.Error {
+			return
+		}
+	}
+
+	if err := s.eventRepo.Create(event); err != nil {
+		logger.Log.Error("配额执行: 写入状态记录失败", zap.Uint("instance_id", instance.ID), zap.Error(err))
+	}
+}
+
+// InstanceStatusChange 推送给用户的规则状态变化
+type InstanceStatusChange struct {
+	InstanceID uint   `json:"instance_id"`
+	NodeID     uint   `json:"node_id"`
+	ServerPort int    `json:"server_port"`
+	Status     string `json:"status"`
+	Action     string `json:"action"` // 见 InstanceAction 常量
+	Reason     string `json:"reason"` // 见 InstanceReason 常量
+}
+
+// instanceStatusChange 构造规则状态变化
+func instanceStatusChange(instance *model.Instance, action, reason string) InstanceStatusChange {
+	return InstanceStatusChange{
+		InstanceID: instance.ID,
+		NodeID:     instance.NodeID,
+		ServerPort: instance.ServerPort,
+		Status:     instance.Status,
+		Action:     action,
+		Reason:     reason,
+	}
+}
+
+// pushInstanceStatus 通过 WebSocket 通知用户规则状态变化
+func pushInstanceStatus(userID uint, changes []InstanceStatusChange) {
+	if len(changes) == 0 {
+		return
+	}
+	websocket.PushToUser(userID, websocket.NewEvent(websocket.EventInstanceStatus, changes))
+}
+
+// userViolation 返回用户当前违规原因，合规时返回空字符串
+func userViolation(user *model.User) string {
+	if user.Status != 1 {
+		return model.InstanceReasonBanned
+	}
+	if user.ExpiredAt == nil || user.ExpiredAt.Before(time.Now()) {
+		return model.InstanceReasonExpired
+	}
+	if user.TransferEnable > 0 && user.Upload+user.Download >= user.TransferEnable {
+		return model.InstanceReasonQuotaExceeded
+	}
+	return ""
+}
@@ -0,0 +1,393 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"nodepassPanel/internal/model"
+	"nodepassPanel/internal/repository"
+	"nodepassPanel/pkg/email"
+	"nodepassPanel/pkg/logger"
+	"nodepassPanel/pkg/nodepass"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// failoverMu 串行化迁移操作，避免同一规则被并发迁移
+var failoverMu sync.Mutex
+
+// FailoverService 节点故障迁移服务
+// 节点被判定故障后，将其规则重建到同地区、允许用户组访问的在线节点；节点恢复后可选迁回
+type FailoverService struct {
+	nodeRepo       *repository.NodeRepository
+	instanceRepo   *repository.InstanceRepository
+	userRepo       *repository.UserRepository
+	eventRepo      *repository.InstanceEventRepository
+	portService    *PortService
+	trafficService *TrafficService
+	mailer         email.Mailer
+}
+
+// NewFailoverService 创建故障迁移服务实例
+func NewFailoverService() *FailoverService {
+	return &FailoverService{
+		nodeRepo:       repository.NewNodeRepository(),
+		instanceRepo:   repository.NewInstanceRepository(),
+		userRepo:       repository.NewUserRepository(),
+		eventRepo:      repository.NewInstanceEventRepository(),
+		portService:    NewPortService(),
+		trafficService: NewTrafficService(),
+		mailer:         email.NewSMTPMailer(),
+	}
+}
+
+// movedRule 迁移成功的规则，用于通知用户
+type movedRule struct {
+	instance model.Instance
+	from     string
+	to       string
+}
+
+// FailoverNode 将故障节点上的规则迁移到健康节点 (节点未开启故障迁移时忽略)
+func (s *FailoverService) FailoverNode(nodeID uint) {
+	failoverMu.Lock()
+	defer failoverMu.Unlock()
+
+	node, err := s.nodeRepo.GetByID(nodeID)
+	if err != nil || !node.Failover {
+		return
+	}
+
+	instances, err := s.instanceRepo.GetByNodeID(node.ID)
+	if err != nil {
+		logger.Log.Error("Failover: 获取实例失败", zap.Uint("node_id", node.ID), zap.Error(err))
+		return
+	}
+	if len(instances) == 0 {
+		return
+	}
+
+	candidates, err := s.candidates(node)
+	if err != nil {
+		logger.Log.Error("Failover: 获取候选节点失败", zap.Uint("node_id", node.ID), zap.Error(err))
+		return
+	}
+
+	assigned := make(map[uint]int, len(candidates))
+	moved := make(map[uint][]movedRule)
+
+	for i := range instances {
+		instance := &instances[i]
+
+		user, err := s.userRepo.GetByID(instance.UserID)
+		if err != nil {
+			continue
+		}
+
+		target := pickFailoverTarget(candidates, assigned, user.GroupID)
+		if target == nil {
+			s.record(instance, model.InstanceActionFailover, errors.New("no healthy node available"))
+			continue
+		}
+
+		// 多次迁移时保留最初的原节点，便于最终迁回
+		originNodeID, originPort := instance.OriginNodeID, instance.OriginPort
+		if originNodeID == 0 {
+			originNodeID, originPort = instance.NodeID, instance.ServerPort
+		}
+
+		from := endpoint(node, instance.ServerPort)
+		err = s.move(instance, target, 0, originNodeID, originPort)
+		s.record(instance, model.InstanceActionFailover, err)
+		if err != nil {
+			logger.Log.Warn("Failover: 迁移规则失败",
+				zap.Uint("instance_id", instance.ID), zap.Uint("target_node_id", target.ID), zap.Error(err))
+			continue
+		}
+
+		assigned[target.ID]++
+		moved[instance.UserID] = append(moved[instance.UserID], movedRule{
+			instance: *instance,
+			from:     from,
+			to:       endpoint(target, instance.ServerPort),
+		})
+	}
+
+	logger.Log.Info("Failover: 节点规则迁移完成",
+		zap.Uint("node_id", node.ID), zap.Int("total", len(instances)), zap.Int("users", len(moved)))
+
+	s.notifyUsers(moved, model.InstanceActionFailover, "节点故障，转发规则已迁移",
+		fmt.Sprintf("节点 %s 发生故障，您的以下转发规则已自动迁移到其他节点，请更新客户端连接地址：", node.Name))
+}
+
+// RecoverNode 节点恢复后清理残留实例，并在开启迁回时将规则迁回
+// flapping 为 true 时不迁回，避免规则随节点抖动反复迁移
+func (s *FailoverService) RecoverNode(nodeID uint, flapping bool) {
+	failoverMu.Lock()
+	defer failoverMu.Unlock()
+
+	node, err := s.nodeRepo.GetByID(nodeID)
+	if err != nil {
+		return
+	}
+
+	s.cleanupStale(node)
+
+	if !node.FailoverBack || flapping {
+		return
+	}
+
+	instances, err := s.instanceRepo.GetByOriginNodeID(node.ID)
+	if err != nil {
+		logger.Log.Error("Failover: 获取迁出实例失败", zap.Uint("node_id", node.ID), zap.Error(err))
+		return
+	}
+	if len(instances) == 0 {
+		return
+	}
+
+	// 迁回前先采集临时节点上的流量，避免计数随实例删除丢失
+	temps := make(map[uint]*model.Node)
+	for _, instance := range instances {
+		if _, ok := temps[instance.NodeID]; ok {
+			continue
+		}
+		temp, err := s.nodeRepo.GetByID(instance.NodeID)
+		if err != nil {
+			temps[instance.NodeID] = nil
+			continue
+		}
+		temps[instance.NodeID] = temp
+		if err := s.trafficService.CollectNode(temp); err != nil {
+			logger.Log.Warn("Failover: 迁回前采集流量失败", zap.Uint("node_id", temp.ID), zap.Error(err))
+		}
+	}
+
+	moved := make(map[uint][]movedRule)
+	for i := range instances {
+		// 采集流量后计数快照已变化，重新读取
+		instance, err := s.instanceRepo.GetByID(instances[i].ID)
+		if err != nil {
+			continue
+		}
+
+		temp := temps[instance.NodeID]
+		oldRemoteID := instance.NodePassID
+		from := ""
+		if temp != nil {
+			from = endpoint(temp, instance.ServerPort)
+		}
+
+		err = s.move(instance, node, instance.OriginPort, 0, 0)
+		s.record(instance, model.InstanceActionFailback, err)
+		if err != nil {
+			logger.Log.Warn("Failover: 迁回规则失败", zap.Uint("instance_id", instance.ID), zap.Error(err))
+			continue
+		}
+
+		if temp != nil && oldRemoteID != "" {
+			if err := newNodeClient(temp).DeleteInstance(oldRemoteID); err != nil {
+				logger.Log.Warn("Failover: 删除临时节点实例失败",
+					zap.Uint("instance_id", instance.ID), zap.Uint("node_id", temp.ID), zap.Error(err))
+			}
+		}
+
+		moved[instance.UserID] = append(moved[instance.UserID], movedRule{
+			instance: *instance,
+			from:     from,
+			to:       endpoint(node, instance.ServerPort),
+		})
+	}
+
+	s.notifyUsers(moved, model.InstanceActionFailback, "节点恢复，转发规则已迁回",
+		fmt.Sprintf("节点 %s 已恢复，您的以下转发规则已迁回原节点，请更新客户端连接地址：", node.Name))
+}
+
+// move 将实例重建到目标节点
+// preferredPort 为优先使用的端口；originNodeID/originPort 为迁移后记录的原节点信息 (迁回时传 0)
+// 失败时恢复实例原有记录；转发目标不允许在目标节点上使用时 (如指向该节点的管理端口) 不迁移
+func (s *FailoverService) move(instance *model.Instance, target *model.Node, preferredPort int, originNodeID uint, originPort int) error {
+	if err := validateTarget(target, instance.TargetAddress, instance.TargetPort); err != nil {
+		return fmt.Errorf("转发目标不允许在节点 %s 上使用: %v", target.Name, err)
+	}
+
+	backup := *instance
+
+	instance.OriginNodeID = originNodeID
+	instance.OriginPort = originPort
+	instance.NodePassID = ""
+	instance.Status = model.InstanceStatusPending
+	instance.LastError = ""
+	// 新节点上的计数从零开始，重建成功后再写入，失败恢复时保留原节点的快照
+	instance.LastRx = 0
+	instance.LastTx = 0
+
+	if err := s.portService.AllocateAndMove(target, instance, preferredPort); err != nil {
+		*instance = backup
+		return err
+	}
+
+	client := newNodeClient(target)
+	remote, err := client.CreateInstance(&nodepass.CreateInstanceRequest{
+		URL:   instanceURL(instance),
+		Alias: instanceAlias(instance),
+	})
+	if err != nil {
+		*instance = backup
+		if restoreErr := s.instanceRepo.Update(instance); restoreErr != nil {
+			logger.Log.Error("Failover: 恢复实例记录失败", zap.Uint("instance_id", instance.ID), zap.Error(restoreErr))
+		}
+		return fmt.Errorf("下发到节点失败: %v", err)
+	}
+	applyRemote(instance, remote)
+
+	// 用户停用或被强制停用的规则在新节点上同样保持停止
+	if !instance.Enable || instance.Suspended {
+		if stopped, err := client.StopInstance(instance.NodePassID); err == nil {
+			applyRemote(instance, stopped)
+		}
+		instance.Status = model.InstanceStatusStopped
+	}
+
+	if err := s.instanceRepo.ResetCounters(instance.ID); err != nil {
+		return err
+	}
+	return s.instanceRepo.Update(instance)
+}
+
+// cleanupStale 删除节点上已迁出或已删除规则的残留实例
+// 仅处理面板创建的实例 (别名 np-<id>-u<uid>)，不影响管理员手动创建的实例
+func (s *FailoverService) cleanupStale(node *model.Node) {
+	client := newNodeClient(node)
+	remotes, err := client.ListInstances()
+	if err != nil {
+		logger.Log.Warn("Failover: 获取节点实例失败", zap.Uint("node_id", node.ID), zap.Error(err))
+		return
+	}
+
+	for _, remote := range remotes {
+		var instanceID, userID uint
+		if _, err := fmt.Sscanf(remote.Alias, "np-%d-u%d", &instanceID, &userID); err != nil {
+			continue
+		}
+
+		instance, err := s.instanceRepo.GetByID(instanceID)
+		if err == nil && instance.NodeID == node.ID && instance.NodePassID == remote.ID {
+			continue
+		}
+
+		if err := client.DeleteInstance(remote.ID); err != nil {
+			logger.Log.Warn("Failover: 清理残留实例失败",
+				zap.Uint("node_id", node.ID), zap.String("nodepass_id", remote.ID), zap.Error(err))
+			continue
+		}
+		logger.Log.Info("Failover: 已清理残留实例",
+			zap.Uint("node_id", node.ID), zap.String("nodepass_id", remote.ID), zap.Uint("instance_id", instanceID))
+	}
+}
+
+// candidates 获取可接管规则的在线节点 (同地区，按排序权重、负载排序)
+func (s *FailoverService) candidates(node *model.Node) ([]model.Node, error) {
+	nodes, err := s.nodeRepo.GetActiveNodes()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]model.Node, 0, len(nodes))
+	for _, candidate := range nodes {
+		if candidate.ID == node.ID || candidate.Region != node.Region {
+			continue
+		}
+		result = append(result, candidate)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Sort != result[j].Sort {
+			return result[i].Sort > result[j].Sort
+		}
+		return result[i].Load < result[j].Load
+	})
+	return result, nil
+}
+
+// record 记录迁移事件
+func (s *FailoverService) record(instance *model.Instance, action string, err error) {
+	reason := model.InstanceReasonNodeDown
+	if action == model.InstanceActionFailback {
+		reason = model.InstanceReasonNodeRecovered
+	}
+
+	event := &model.InstanceEvent{
+		InstanceID: instance.ID,
+		UserID:     instance.UserID,
+		NodeID:     instance.NodeID,
+		Action:     action,
+		Reason:     reason,
+		Success:    err == nil,
+	}
+	if err != nil {
+		event.Error = truncateError(err.Error())
+	}
+
+	if err := s.eventRepo.Create(event); err != nil {
+		logger.Log.Error("Failover: 写入迁移记录失败", zap.Uint("instance_id", instance.ID), zap.Error(err))
+	}
+}
+
+// notifyUsers 通过 WebSocket 与邮件通知用户规则的新连接地址
+func (s *FailoverService) notifyUsers(moved map[uint][]movedRule, action, subject, intro string) {
+	reason := model.InstanceReasonNodeDown
+	if action == model.InstanceActionFailback {
+		reason = model.InstanceReasonNodeRecovered
+	}
+
+	for userID, rules := range moved {
+		changes := make([]InstanceStatusChange, 0, len(rules))
+		for i := range rules {
+			changes = append(changes, instanceStatusChange(&rules[i].instance, action, reason))
+		}
+		pushInstanceStatus(userID, changes)
+
+		user, err := s.userRepo.GetByID(userID)
+		if err != nil || user.Email == "" {
+			continue
+		}
+
+		lines := []string{intro, ""}
+		for _, rule := range rules {
+			name := rule.instance.Name
+			if name == "" {
+				name = fmt.Sprintf("#%d", rule.instance.ID)
+			}
+			lines = append(lines, fmt.Sprintf("%s: %s -> %s", name, rule.from, rule.to))
+		}
+
+		go func(to, content string) {
+			if err := s.mailer.SendNotice(to, subject, content); err != nil {
+				logger.Log.Warn("Failover: 发送迁移通知失败", zap.String("to", to), zap.Error(err))
+			}
+		}(user.Email, strings.Join(lines, "\n"))
+	}
+}
+
+// pickFailoverTarget 挑选允许用户组访问、本轮分配最少的候选节点
+func pickFailoverTarget(candidates []model.Node, assigned map[uint]int, groupID int) *model.Node {
+	var target *model.Node
+	for i := range candidates {
+		candidate := &candidates[i]
+		if !nodeAllowsGroup(candidate, groupID) {
+			continue
+		}
+		if target == nil || assigned[candidate.ID] < assigned[target.ID] {
+			target = candidate
+		}
+	}
+	return target
+}
+
+// endpoint 规则对外连接地址
+func endpoint(node *model.Node, port int) string {
+	return fmt.Sprintf("%s:%d", node.Address, port)
+}
@@ -0,0 +1,431 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"nodepassPanel/internal/model"
+	"nodepassPanel/internal/repository"
+	"nodepassPanel/pkg/logger"
+	"nodepassPanel/pkg/nodepass"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// InstanceService 转发实例服务层
+type InstanceService struct {
+	instanceRepo *repository.InstanceRepository
+	nodeRepo     *repository.NodeRepository
+	userRepo     *repository.UserRepository
+	portService  *PortService
+}
+
+// NewInstanceService 创建转发实例服务实例
+func NewInstanceService() *InstanceService {
+	return &InstanceService{
+		instanceRepo: repository.NewInstanceRepository(),
+		nodeRepo:     repository.NewNodeRepository(),
+		userRepo:     repository.NewUserRepository(),
+		portService:  NewPortService(),
+	}
+}
+
+// ==================== 请求/响应结构 ====================
+
+// CreateInstanceRequest 创建转发规则请求
+type CreateInstanceRequest struct {
+	NodeID        uint   `json:"node_id" binding:"required"`
+	Name          string `json:"name"`
+	ServerPort    int    `json:"server_port" binding:"omitempty,min=1,max=65535"` // 为空则自动分配
+	TargetAddress string `json:"target_address" binding:"required"`
+	TargetPort    int    `json:"target_port" binding:"required,min=1,max=65535"`
+}
+
+// AdminCreateInstanceRequest 管理员创建转发规则请求
+type AdminCreateInstanceRequest struct {
+	UserID uint `json:"user_id" binding:"required"`
+	CreateInstanceRequest
+}
+
+// UpdateInstanceRequest 更新转发规则请求
+type UpdateInstanceRequest struct {
+	Name          *string `json:"name"`
+	TargetAddress *string `json:"target_address"`
+	TargetPort    *int    `json:"target_port" binding:"omitempty,min=1,max=65535"`
+	Enable        *bool   `json:"enable"`
+}
+
+// InstanceListQuery 转发规则列表查询
+type InstanceListQuery struct {
+	Page     int  `form:"page" binding:"omitempty,min=1"`
+	PageSize int  `form:"page_size" binding:"omitempty,min=1,max=100"`
+	UserID   uint `form:"user_id"`
+	NodeID   uint `form:"node_id"`
+}
+
+// InstanceListResponse 转发规则列表响应
+type InstanceListResponse struct {
+	List     []model.Instance `json:"list"`
+	Total    int64            `json:"total"`
+	Page     int              `json:"page"`
+	PageSize int              `json:"page_size"`
+}
+
+// ==================== 用户端方法 ====================
+
+// GetUserInstances 获取用户的转发规则
+func (s *InstanceService) GetUserInstances(userID uint) ([]model.Instance, error) {
+	return s.instanceRepo.GetByUserID(userID)
+}
+
+// GetUserInstance 获取用户的单个转发规则
+func (s *InstanceService) GetUserInstance(userID, id uint) (*model.Instance, error) {
+	return s.getOwned(id, userID)
+}
+
+// Create 创建转发规则（用户端）
+func (s *InstanceService) Create(userID uint, req *CreateInstanceRequest) (*model.Instance, error) {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	switch userViolation(user) {
+	case model.InstanceReasonBanned:
+		return nil, errors.New("账户已被禁用")
+	case model.InstanceReasonExpired:
+		return nil, errors.New("套餐已过期，请先续费")
+	case model.InstanceReasonQuotaExceeded:
+		return nil, errors.New("流量已用尽，请先续费")
+	}
+
+	node, err := s.nodeRepo.GetByID(req.NodeID)
+	if err != nil {
+		return nil, errors.New("node not found")
+	}
+
+	if !nodeAllowsGroup(node, user.GroupID) {
+		return nil, errors.New("当前用户组无权使用该节点")
+	}
+
+	return s.create(user.ID, node, req)
+}
+
+// Update 更新转发规则（用户端）
+func (s *InstanceService) Update(userID, id uint, req *UpdateInstanceRequest) (*model.Instance, error) {
+	instance, err := s.getOwned(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.update(instance, req)
+}
+
+// Delete 删除转发规则（用户端）
+func (s *InstanceService) Delete(userID, id uint) error {
+	instance, err := s.getOwned(id, userID)
+	if err != nil {
+		return err
+	}
+	return s.delete(instance, false)
+}
+
+// ==================== 管理员方法 ====================
+
+// GetInstanceList 获取转发规则列表（管理员）
+func (s *InstanceService) GetInstanceList(query *InstanceListQuery) (*InstanceListResponse, error) {
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	if query.PageSize < 1 {
+		query.PageSize = 20
+	}
+
+	instances, total, err := s.instanceRepo.GetPaginated(query.Page, query.PageSize, query.UserID, query.NodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &InstanceListResponse{
+		List:     instances,
+		Total:    total,
+		Page:     query.Page,
+		PageSize: query.PageSize,
+	}, nil
+}
+
+// GetByID 根据ID获取转发规则（管理员）
+func (s *InstanceService) GetByID(id uint) (*model.Instance, error) {
+	return s.instanceRepo.GetByID(id)
+}
+
+// AdminCreate 为指定用户创建转发规则（管理员，不校验用户组）
+func (s *InstanceService) AdminCreate(req *AdminCreateInstanceRequest) (*model.Instance, error) {
+	if _, err := s.userRepo.GetByID(req.UserID); err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	node, err := s.nodeRepo.GetByID(req.NodeID)
+	if err != nil {
+		return nil, errors.New("node not found")
+	}
+
+	return s.create(req.UserID, node, &req.CreateInstanceRequest)
+}
+
+// AdminUpdate 更新转发规则（管理员）
+func (s *InstanceService) AdminUpdate(id uint, req *UpdateInstanceRequest) (*model.Instance, error) {
+	instance, err := s.instanceRepo.GetByID(id)
+	if err != nil {
+		return nil, errors.New("instance not found")
+	}
+	return s.update(instance, req)
+}
+
+// AdminDelete 删除转发规则（管理员，节点不可达时仍删除本地记录）
+func (s *InstanceService) AdminDelete(id uint) error {
+	instance, err := s.instanceRepo.GetByID(id)
+	if err != nil {
+		return errors.New("instance not found")
+	}
+	return s.delete(instance, true)
+}
+
+// ==================== 内部方法 ====================
+
+// getOwned 获取实例并校验归属
+func (s *InstanceService) getOwned(id, userID uint) (*model.Instance, error) {
+	instance, err := s.instanceRepo.GetByID(id)
+	if err != nil {
+		return nil, errors.New("instance not found")
+	}
+	if instance.UserID != userID {
+		return nil, errors.New("permission denied")
+	}
+	return instance, nil
+}
+
+// create 保存实例并下发到节点
+func (s *InstanceService) create(userID uint, node *model.Node, req *CreateInstanceRequest) (*model.Instance, error) {
+	if err := validateTarget(node, req.TargetAddress, req.TargetPort); err != nil {
+		return nil, err
+	}
+
+	instance := &model.Instance{
+		UserID:        userID,
+		NodeID:        node.ID,
+		Name:          req.Name,
+		TargetAddress: req.TargetAddress,
+		TargetPort:    req.TargetPort,
+		Status:        model.InstanceStatusPending,
+		Enable:        true,
+	}
+
+	// 先分配端口并落库拿到 ID，作为 Master 侧实例别名
+	if err := s.portService.AllocateAndCreate(node, instance, req.ServerPort); err != nil {
+		return nil, err
+	}
+
+	client := newNodeClient(node)
+	remote, err := client.CreateInstance(&nodepass.CreateInstanceRequest{
+		URL:   instanceURL(instance),
+		Alias: instanceAlias(instance),
+	})
+	if err != nil {
+		// 下发失败则回滚本地记录
+		s.instanceRepo.Delete(instance.ID)
+		return nil, fmt.Errorf("下发到节点失败: %v", err)
+	}
+
+	applyRemote(instance, remote)
+	if err := s.instanceRepo.Update(instance); err != nil {
+		return nil, err
+	}
+
+	return instance, nil
+}
+
+// update 更新实例并同步到节点
+func (s *InstanceService) update(instance *model.Instance, req *UpdateInstanceRequest) (*model.Instance, error) {
+	node, err := s.nodeRepo.GetByID(instance.NodeID)
+	if err != nil {
+		return nil, errors.New("node not found")
+	}
+	client := newNodeClient(node)
+
+	if req.Name != nil {
+		instance.Name = *req.Name
+	}
+
+	// 目标变更需要替换隧道 URL
+	targetChanged := false
+	if req.TargetAddress != nil && *req.TargetAddress != instance.TargetAddress {
+		instance.TargetAddress = *req.TargetAddress
+		targetChanged = true
+	}
+	if req.TargetPort != nil && *req.TargetPort != instance.TargetPort {
+		instance.TargetPort = *req.TargetPort
+		targetChanged = true
+	}
+
+	if targetChanged {
+		if err := validateTarget(node, instance.TargetAddress, instance.TargetPort); err != nil {
+			return nil, err
+		}
+	}
+
+	// 被强制停用或已关闭的实例只保存到本地，恢复或开启时再将 URL 同步到节点
+	// (节点替换 URL 时会重启实例，不能在停用状态下调用)
+	synced := instance.NodePassID != "" && !instance.Suspended
+	if req.Enable != nil && *req.Enable != instance.Enable {
+		if synced {
+			var remote *nodepass.Instance
+			if *req.Enable {
+				remote, err = client.UpdateInstance(instance.NodePassID, &nodepass.UpdateInstanceRequest{URL: instanceURL(instance)})
+			} else {
+				remote, err = client.StopInstance(instance.NodePassID)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("同步到节点失败: %v", err)
+			}
+			applyRemote(instance, remote)
+		}
+		instance.Enable = *req.Enable
+	} else if targetChanged && synced && instance.Enable {
+		remote, err := client.UpdateInstance(instance.NodePassID, &nodepass.UpdateInstanceRequest{URL: instanceURL(instance)})
+		if err != nil {
+			return nil, fmt.Errorf("同步到节点失败: %v", err)
+		}
+		applyRemote(instance, remote)
+	}
+
+	if err := s.instanceRepo.Update(instance); err != nil {
+		return nil, err
+	}
+
+	return instance, nil
+}
+
+// delete 从节点删除实例并删除本地记录
+// force 为 true 时忽略节点侧错误
+func (s *InstanceService) delete(instance *model.Instance, force bool) error {
+	if instance.NodePassID != "" {
+		node, err := s.nodeRepo.GetByID(instance.NodeID)
+		if err == nil {
+			err = newNodeClient(node).DeleteInstance(instance.NodePassID)
+		}
+		if err != nil {
+			if !force {
+				return fmt.Errorf("从节点删除失败: %v", err)
+			}
+			logger.Log.Warn("从节点删除实例失败，仅删除本地记录",
+				zap.Uint("instance_id", instance.ID), zap.Error(err))
+		}
+	}
+
+	return s.instanceRepo.Delete(instance.ID)
+}
+
+// blockedTargetNets IsPrivate 等方法未覆盖的保留网段
+var blockedTargetNets = []*net.IPNet{
+	mustParseCIDR("0.0.0.0/8"),     // 本网络
+	mustParseCIDR("100.64.0.0/10"), // 运营商级 NAT (CGNAT)
+}
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return ipNet
+}
+
+// validateTarget 校验转发目标，禁止转发到节点本机、内网及节点的 Master API 端口
+// 目标只接受 IP 地址：域名由节点在转发时再次解析，校验时的解析结果无法约束实际连接的地址
+func validateTarget(node *model.Node, address string, port int) error {
+	ip := net.ParseIP(strings.Trim(strings.TrimSpace(address), "[]"))
+	if ip == nil {
+		return errors.New("目标地址必须为 IP 地址")
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return errors.New("不允许转发到本机或内网地址")
+	}
+	for _, ipNet := range blockedTargetNets {
+		if ipNet.Contains(ip) {
+			return errors.New("不允许转发到本机或内网地址")
+		}
+	}
+
+	if port != node.APIPort {
+		return nil
+	}
+	nodeIPs, err := resolveHost(node.Address)
+	if err != nil {
+		return nil
+	}
+	for _, nodeIP := range nodeIPs {
+		if ip.Equal(nodeIP) {
+			return errors.New("不允许转发到节点的管理端口")
+		}
+	}
+	return nil
+}
+
+// resolveHost 解析 IP 或域名
+func resolveHost(host string) ([]net.IP, error) {
+	host = strings.Trim(strings.TrimSpace(host), "[]")
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, errors.New("no address")
+	}
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		ips = append(ips, addr.IP)
+	}
+	return ips, nil
+}
+
+// instanceURL 构造实例的隧道 URL
+func instanceURL(instance *model.Instance) string {
+	return nodepass.BuildForwardURL(instance.ServerPort, instance.TargetAddress, instance.TargetPort)
+}
+
+// instanceAlias 构造实例在 Master 上的别名
+func instanceAlias(instance *model.Instance) string {
+	return fmt.Sprintf("np-%d-u%d", instance.ID, instance.UserID)
+}
+
+// applyRemote 将 Master 返回的实例信息写回本地模型
+func applyRemote(instance *model.Instance, remote *nodepass.Instance) {
+	if remote.ID != "" {
+		instance.NodePassID = remote.ID
+	}
+	if remote.Status != "" {
+		instance.Status = remote.Status
+	}
+	instance.LastError = ""
+}
+
+// nodeAllowsGroup 检查节点是否允许指定用户组访问
+func nodeAllowsGroup(node *model.Node, groupID int) bool {
+	group := strconv.Itoa(groupID)
+	for _, id := range strings.Split(node.GroupID, ",") {
+		if strings.TrimSpace(id) == group {
+			return true
+		}
+	}
+	return false
+}
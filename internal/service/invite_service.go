@@ -117,10 +117,14 @@ func (s *InviteService) ProcessInviteCommission(inviteeID uint, orderAmount floa
 			existingRecord.OrderID = orderID
 			existingRecord.Commission = orderAmount * config.App.Invite.CommissionRate
 			existingRecord.Status = model.InviteRecordStatusSettled
-			global.DB.Save(&existingRecord)
 
-			// 给邀请者增加佣金
-			s.addCommission(user.InvitedBy, existingRecord.Commission)
+			// 结算记录与给邀请者增加佣金在同一事务中完成
+			return global.DB.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Save(&existingRecord).Error; err != nil {
+					return err
+				}
+				return s.addCommission(tx, user.InvitedBy, existingRecord.Commission, orderID)
+			})
 		}
 		return nil
 	}
@@ -135,14 +139,13 @@ func (s *InviteService) ProcessInviteCommission(inviteeID uint, orderAmount floa
 		Status:     model.InviteRecordStatusSettled,
 	}
 
-	if err := global.DB.Create(record).Error; err != nil {
-		return err
-	}
-
-	// 给邀请者增加佣金
-	s.addCommission(user.InvitedBy, commission)
-
-	return nil
+	return global.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(record).Error; err != nil {
+			return err
+		}
+		// 给邀请者增加佣金
+		return s.addCommission(tx, user.InvitedBy, commission, orderID)
+	})
 }
 
 // RegisterWithInviteCode 处理使用邀请码注册
@@ -183,10 +186,18 @@ func (s *InviteService) RegisterWithInviteCode(inviteeID uint, inviteCode string
 	return nil
 }
 
-// addCommission 给用户增加佣金
-func (s *InviteService) addCommission(userID uint, amount float64) {
-	global.DB.Model(&model.User{}).Where("id = ?", userID).
-		Update("commission", gorm.Expr("commission + ?", amount))
+// addCommission 在事务中给用户增加佣金并记录流水
+func (s *InviteService) addCommission(tx *gorm.DB, userID uint, amount float64, orderID uint) error {
+	_, err := postLedger(tx, &LedgerEntry{
+		UserID:  userID,
+		Account: model.AccountCommission,
+		Counter: model.AccountSystemReferral,
+		Type:    model.BalanceTypeCommission,
+		Amount:  amount,
+		OrderID: orderID,
+		Memo:    "邀请返利",
+	})
+	return err
 }
 
 // maskEmail 隐藏邮箱中间部分
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"nodepassPanel/internal/model"
+	"nodepassPanel/internal/repository"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	errInsufficientBalance = errors.New("余额不足")
+	errLedgerUserNotFound  = errors.New("user not found")
+)
+
+// LedgerEntry 一笔用户资金变动
+type LedgerEntry struct {
+	UserID  uint
+	Account string  // 用户账户: balance, commission
+	Counter string  // 对手系统账户
+	Type    string  // 变动类型
+	Amount  float64 // 正数入账，负数出账
+	OrderID uint
+	AdminID uint
+	Memo    string
+}
+
+// postLedger 在事务中变动用户账户并写入用户与对手系统账户两条分录
+// 出账后余额不能为负，否则返回 errInsufficientBalance
+func postLedger(tx *gorm.DB, entry *LedgerEntry) (*model.BalanceLog, error) {
+	if entry.Account != model.AccountBalance && entry.Account != model.AccountCommission {
+		return nil, fmt.Errorf("unknown ledger account: %s", entry.Account)
+	}
+	column := entry.Account
+
+	query := tx.Model(&model.User{}).Where("id = ?", entry.UserID)
+	if entry.Amount < 0 {
+		query = query.Where(column+" + ? >= 0", entry.Amount)
+	}
+	result := query.UpdateColumn(column, gorm.Expr(column+" + ?", entry.Amount))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		var count int64
+		if err := tx.Model(&model.User{}).Where("id = ?", entry.UserID).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, errLedgerUserNotFound
+		}
+		return nil, errInsufficientBalance
+	}
+
+	var after float64
+	if err := tx.Model(&model.User{}).Select(column).Where("id = ?", entry.UserID).Row().Scan(&after); err != nil {
+		return nil, err
+	}
+
+	txnNo := uuid.NewString()
+	logs := []model.BalanceLog{
+		{
+			TxnNo:        txnNo,
+			UserID:       entry.UserID,
+			Account:      entry.Account,
+			Type:         entry.Type,
+			Amount:       entry.Amount,
+			BalanceAfter: after,
+			OrderID:      entry.OrderID,
+			AdminID:      entry.AdminID,
+			Memo:         entry.Memo,
+		},
+		{
+			TxnNo:   txnNo,
+			Account: entry.Counter,
+			Type:    entry.Type,
+			Amount:  -entry.Amount,
+			OrderID: entry.OrderID,
+			AdminID: entry.AdminID,
+			Memo:    entry.Memo,
+		},
+	}
+	if err := tx.Create(&logs).Error; err != nil {
+		return nil, err
+	}
+	return &logs[0], nil
+}
+
+// LedgerService 资金流水服务
+type LedgerService struct {
+	logRepo *repository.BalanceLogRepository
+}
+
+// NewLedgerService 创建资金流水服务实例
+func NewLedgerService() *LedgerService {
+	return &LedgerService{
+		logRepo: repository.NewBalanceLogRepository(),
+	}
+}
+
+// BalanceLogQuery 资金流水查询
+type BalanceLogQuery struct {
+	Page     int    `form:"page" binding:"omitempty,min=1"`
+	PageSize int    `form:"page_size" binding:"omitempty,min=1,max=100"`
+	Account  string `form:"account" binding:"omitempty,oneof=balance commission"`
+	Type     string `form:"type"`
+}
+
+// AdminBalanceLogQuery 资金流水审计查询（管理员）
+type AdminBalanceLogQuery struct {
+	Page     int    `form:"page" binding:"omitempty,min=1"`
+	PageSize int    `form:"page_size" binding:"omitempty,min=1,max=100"`
+	UserID   uint   `form:"user_id"`
+	Account  string `form:"account"` // 用户或系统账户
+	Type     string `form:"type"`
+	OrderID  uint   `form:"order_id"`
+	TxnNo    string `form:"txn_no"`
+	System   bool   `form:"system"` // 是否包含系统账户分录
+}
+
+// BalanceLogListResponse 资金流水列表响应
+type BalanceLogListResponse struct {
+	List     []model.BalanceLog `json:"list"`
+	Total    int64              `json:"total"`
+	Page     int                `json:"page"`
+	PageSize int                `json:"page_size"`
+}
+
+// GetUserLogs 获取用户自己的资金流水
+func (s *LedgerService) GetUserLogs(userID uint, query *BalanceLogQuery) (*BalanceLogListResponse, error) {
+	return s.list(&query.Page, &query.PageSize, &repository.BalanceLogFilter{
+		UserID:  userID,
+		Account: query.Account,
+		Type:    query.Type,
+	})
+}
+
+// GetLogs 获取资金流水（管理员）
+func (s *LedgerService) GetLogs(query *AdminBalanceLogQuery) (*BalanceLogListResponse, error) {
+	return s.list(&query.Page, &query.PageSize, &repository.BalanceLogFilter{
+		UserID:  query.UserID,
+		Account: query.Account,
+		Type:    query.Type,
+		OrderID: query.OrderID,
+		TxnNo:   query.TxnNo,
+		System:  query.System,
+	})
+}
+
+// list 分页查询，修正页码参数
+func (s *LedgerService) list(page, pageSize *int, filter *repository.BalanceLogFilter) (*BalanceLogListResponse, error) {
+	if *page < 1 {
+		*page = 1
+	}
+	if *pageSize < 1 {
+		*pageSize = 20
+	}
+
+	logs, total, err := s.logRepo.GetPaginated(*page, *pageSize, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BalanceLogListResponse{
+		List:     logs,
+		Total:    total,
+		Page:     *page,
+		PageSize: *pageSize,
+	}, nil
+}
@@ -1,63 +1,200 @@
 package service
 
 import (
-	"encoding/json"
-	"fmt"
 	"nodepassPanel/internal/model"
 	"nodepassPanel/internal/repository"
 	"nodepassPanel/internal/websocket"
+	"nodepassPanel/pkg/logger"
+	"nodepassPanel/pkg/nodepass"
+	"sync"
 	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// probeWorkers 并发探测的最大节点数
+	probeWorkers = 10
+	// probeTimeout 单次探测请求超时
+	probeTimeout = 3 * time.Second
+
+	// 延迟/负载的变化阈值，低于阈值的抖动不触发广播
+	pingChangeThreshold = 20  // ms
+	loadChangeThreshold = 5.0 // %
 )
 
 type MonitorService struct {
-	nodeRepo *repository.NodeRepository
+	nodeRepo      *repository.NodeRepository
+	instanceRepo  *repository.InstanceRepository
+	metricService *NodeMetricService
+	alertService  *AlertService
 }
 
 func NewMonitorService() *MonitorService {
 	return &MonitorService{
-		nodeRepo: repository.NewNodeRepository(),
+		nodeRepo:      repository.NewNodeRepository(),
+		instanceRepo:  repository.NewInstanceRepository(),
+		metricService: NewNodeMetricService(),
+		alertService:  NewAlertService(),
 	}
 }
 
-// CheckNodes 检查所有节点状态 (仅检查服务器节点，不包含通用节点)
-func (s *MonitorService) CheckNodes() {
+// ProbeResult 单个节点的探测结果
+type ProbeResult struct {
+	NodeID     uint      `json:"id"`
+	Name       string    `json:"name"`
+	Status     int       `json:"status"`      // 1:在线 0:离线
+	Ping       int       `json:"ping"`        // API 往返延迟 (ms)
+	Load       float64   `json:"load"`        // CPU 使用率 (%)
+	OnlineUser int       `json:"online_user"` // 有运行中实例的用户数
+	Error      string    `json:"error,omitempty"`
+	CheckedAt  time.Time `json:"checked_at"`
+
+	changed bool // 与上次持久化的状态相比是否有明显变化
+}
+
+// CheckNodes 并发探测所有节点状态，持久化结果并在有变化时广播
+func (s *MonitorService) CheckNodes() []ProbeResult {
 	nodes, err := s.nodeRepo.GetAll()
 	if err != nil {
-		fmt.Println("Monitor: 获取节点失败:", err)
-		return
+		logger.Log.Error("Monitor: 获取节点失败", zap.Error(err))
+		return nil
+	}
+
+	results := make([]ProbeResult, len(nodes))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	workers := probeWorkers
+	if len(nodes) < workers {
+		workers = len(nodes)
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = s.CheckNode(&nodes[i])
+			}
+		}()
+	}
+	for i := range nodes {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	s.alertService.Evaluate(results)
+
+	changed := make([]ProbeResult, 0)
+	for i, result := range results {
+		s.metricService.Record(&results[i])
+		websocket.Publish(websocket.NodeRoom(result.NodeID), websocket.NewEvent(websocket.EventNodeMetrics, result))
+		if result.changed {
+			changed = append(changed, result)
+		}
+	}
+
+	// 通过 WebSocket 广播状态 (仅在有变化时)
+	if len(changed) > 0 && websocket.GlobalHub != nil {
+		websocket.GlobalHub.Publish("", websocket.NewEvent(websocket.EventNodeStatus, changed))
+	}
+
+	return results
+}
+
+// CheckNode 探测单个节点并持久化结果
+func (s *MonitorService) CheckNode(node *model.Node) ProbeResult {
+	result := s.probeNode(node)
+	result.changed = nodeChanged(node, &result)
+
+	if err := s.nodeRepo.UpdateStatus(node.ID, result.Status, result.Ping, result.OnlineUser, result.Load); err != nil {
+		logger.Log.Error("Monitor: 更新节点状态失败", zap.Uint("node_id", node.ID), zap.Error(err))
 	}
 
-	updates := make([]map[string]interface{}, 0)
+	node.Status = result.Status
+	node.Ping = result.Ping
+	node.Load = result.Load
+	node.OnlineUser = result.OnlineUser
+	return result
+}
+
+// probeNode 探测节点：测量 API 往返延迟，并尽可能获取系统信息和在线用户数
+func (s *MonitorService) probeNode(node *model.Node) ProbeResult {
+	result := ProbeResult{
+		NodeID:    node.ID,
+		Name:      node.Name,
+		CheckedAt: time.Now(),
+	}
 
-	for _, node := range nodes {
-		alive := s.pingNode(&node)
-		status := 0
-		if alive {
-			status = 1
+	client := newNodeClient(node)
+	client.Client.Timeout = probeTimeout
+
+	start := time.Now()
+	alive, err := client.Ping()
+	if !alive {
+		if err != nil {
+			result.Error = err.Error()
 		}
+		return result
+	}
+
+	result.Status = 1
+	result.Ping = int(time.Since(start).Milliseconds())
 
-		updates = append(updates, map[string]interface{}{
-			"id":     node.ID,
-			"name":   node.Name,
-			"status": status,
-			"load":   "0.1",
-		})
+	// 系统信息为可选能力，失败不影响在线判定
+	if info, err := client.GetInfo(); err == nil {
+		result.Load = info.CPU
 	}
 
-	// 通过 WebSocket 广播状态
-	if websocket.GlobalHub != nil {
-		data, _ := json.Marshal(map[string]interface{}{
-			"type": "node_status", // 消息类型
-			"data": updates,       // 节点状态数据
-			"time": time.Now(),    // 时间戳
-		})
-		websocket.GlobalHub.Broadcast(data)
+	if remotes, err := client.ListInstances(); err == nil {
+		result.OnlineUser = s.countOnlineUsers(node.ID, remotes)
 	}
+
+	return result
 }
 
-// pingNode 对节点进行 Ping 检测 (模拟)
-func (s *MonitorService) pingNode(node *model.Node) bool {
-	// TODO: 实现真实的 TCP/HTTP Ping 逻辑
-	// MVP 阶段暂时返回 True
-	return true
+// countOnlineUsers 统计节点上有运行中实例的用户数
+func (s *MonitorService) countOnlineUsers(nodeID uint, remotes []nodepass.Instance) int {
+	running := make(map[string]bool, len(remotes))
+	for _, remote := range remotes {
+		if remote.Status == nodepass.InstanceStatusRunning {
+			running[remote.ID] = true
+		}
+	}
+	if len(running) == 0 {
+		return 0
+	}
+
+	instances, err := s.instanceRepo.GetByNodeID(nodeID)
+	if err != nil {
+		return 0
+	}
+
+	users := make(map[uint]bool)
+	for _, instance := range instances {
+		if running[instance.NodePassID] {
+			users[instance.UserID] = true
+		}
+	}
+	return len(users)
+}
+
+// nodeChanged 判断探测结果与节点当前记录相比是否有明显变化
+func nodeChanged(node *model.Node, result *ProbeResult) bool {
+	if node.Status != result.Status || node.OnlineUser != result.OnlineUser {
+		return true
+	}
+	if absInt(node.Ping-result.Ping) >= pingChangeThreshold {
+		return true
+	}
+	diff := node.Load - result.Load
+	return diff >= loadChangeThreshold || diff <= -loadChangeThreshold
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
 }
@@ -0,0 +1,248 @@
+package service
+
+import (
+	"errors"
+	"nodepassPanel/internal/model"
+	"nodepassPanel/internal/repository"
+	"nodepassPanel/pkg/logger"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// 各粒度的保留期
+const (
+	metricRetentionRaw = 24 * time.Hour
+	metricRetention5m  = 30 * 24 * time.Hour
+	metricMaxRange     = 365 * 24 * time.Hour
+)
+
+// NodeMetricService 节点监控历史服务
+type NodeMetricService struct {
+	metricRepo *repository.NodeMetricRepository
+	nodeRepo   *repository.NodeRepository
+	userRepo   *repository.UserRepository
+}
+
+// NewNodeMetricService 创建节点监控历史服务实例
+func NewNodeMetricService() *NodeMetricService {
+	return &NodeMetricService{
+		metricRepo: repository.NewNodeMetricRepository(),
+		nodeRepo:   repository.NewNodeRepository(),
+		userRepo:   repository.NewUserRepository(),
+	}
+}
+
+// MetricPoint 时序数据点
+type MetricPoint struct {
+	Time       time.Time `json:"time"`
+	Uptime     float64   `json:"uptime"` // 桶内在线率 (%)，raw 粒度为 0 或 100
+	Ping       float64   `json:"ping"`   // 在线采样平均延迟 (ms)
+	Load       float64   `json:"load"`   // 在线采样平均负载
+	OnlineUser int       `json:"online_user"`
+}
+
+// NodeMetricsResponse 节点监控历史响应
+type NodeMetricsResponse struct {
+	NodeID     uint          `json:"node_id"`
+	Range      string        `json:"range"`
+	Resolution string        `json:"resolution"`
+	Uptime     *float64      `json:"uptime"` // 区间整体在线率 (%)，无数据时为 null
+	Points     []MetricPoint `json:"points"`
+}
+
+// NodeUptime 节点在线率
+type NodeUptime struct {
+	NodeID uint     `json:"node_id"`
+	Name   string   `json:"name"`
+	Region string   `json:"region"`
+	Uptime *float64 `json:"uptime"` // 在线率 (%)，无数据时为 null
+}
+
+// Record 记录一次探测结果到各粒度桶
+func (s *NodeMetricService) Record(result *ProbeResult) {
+	up := 0
+	ping, load := 0.0, 0.0
+	if result.Status == 1 {
+		up = 1
+		ping = float64(result.Ping)
+		load = result.Load
+	}
+
+	buckets := map[string]time.Time{
+		model.MetricResolutionRaw: result.CheckedAt,
+		model.MetricResolution5m:  result.CheckedAt.Truncate(5 * time.Minute),
+		model.MetricResolution1h:  result.CheckedAt.Truncate(time.Hour),
+	}
+	for resolution, bucket := range buckets {
+		metric := &model.NodeMetric{
+			NodeID:        result.NodeID,
+			Resolution:    resolution,
+			Time:          bucket,
+			Samples:       1,
+			UpSamples:     up,
+			PingSum:       ping,
+			LoadSum:       load,
+			MaxOnlineUser: result.OnlineUser,
+		}
+		if err := s.metricRepo.Accumulate(metric); err != nil {
+			logger.Log.Error("Monitor: 写入监控历史失败",
+				zap.Uint("node_id", result.NodeID), zap.String("resolution", resolution), zap.Error(err))
+		}
+	}
+}
+
+// Prune 按保留期清理过期的明细数据
+func (s *NodeMetricService) Prune() {
+	now := time.Now()
+	if _, err := s.metricRepo.DeleteBefore(model.MetricResolutionRaw, now.Add(-metricRetentionRaw)); err != nil {
+		logger.Log.Error("Monitor: 清理原始监控数据失败", zap.Error(err))
+	}
+	if _, err := s.metricRepo.DeleteBefore(model.MetricResolution5m, now.Add(-metricRetention5m)); err != nil {
+		logger.Log.Error("Monitor: 清理 5 分钟监控数据失败", zap.Error(err))
+	}
+}
+
+// GetNodeMetrics 获取节点监控历史
+func (s *NodeMetricService) GetNodeMetrics(nodeID uint, rangeStr string) (*NodeMetricsResponse, error) {
+	if _, err := s.nodeRepo.GetByID(nodeID); err != nil {
+		return nil, errors.New("node not found")
+	}
+
+	span, err := parseMetricRange(rangeStr)
+	if err != nil {
+		return nil, err
+	}
+	if rangeStr == "" {
+		rangeStr = "24h"
+	}
+
+	resolution := resolutionFor(span)
+	metrics, err := s.metricRepo.GetRange(nodeID, resolution, time.Now().Add(-span))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &NodeMetricsResponse{
+		NodeID:     nodeID,
+		Range:      rangeStr,
+		Resolution: resolution,
+		Points:     make([]MetricPoint, 0, len(metrics)),
+	}
+
+	var samples, upSamples int
+	for _, m := range metrics {
+		samples += m.Samples
+		upSamples += m.UpSamples
+
+		point := MetricPoint{Time: m.Time, OnlineUser: m.MaxOnlineUser}
+		if m.Samples > 0 {
+			point.Uptime = float64(m.UpSamples) / float64(m.Samples) * 100
+		}
+		if m.UpSamples > 0 {
+			point.Ping = m.PingSum / float64(m.UpSamples)
+			point.Load = m.LoadSum / float64(m.UpSamples)
+		}
+		resp.Points = append(resp.Points, point)
+	}
+	if samples > 0 {
+		uptime := float64(upSamples) / float64(samples) * 100
+		resp.Uptime = &uptime
+	}
+
+	return resp, nil
+}
+
+// GetUptimes 获取各节点在时间范围内的在线率
+// 非管理员返回其用户组可用的全部节点 (包括当前离线的节点)
+func (s *NodeMetricService) GetUptimes(rangeStr string, userID uint, isAdmin bool) ([]NodeUptime, error) {
+	span, err := parseMetricRange(rangeStr)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err := s.nodeRepo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	if !isAdmin {
+		user, err := s.userRepo.GetByID(userID)
+		if err != nil {
+			return nil, errors.New("user not found")
+		}
+		allowed := nodes[:0]
+		for i := range nodes {
+			if nodeAllowsGroup(&nodes[i], user.GroupID) {
+				allowed = append(allowed, nodes[i])
+			}
+		}
+		nodes = allowed
+	}
+
+	// 在线率只需计数，使用 5 分钟/1 小时汇总即可，无需扫描原始数据
+	resolution := model.MetricResolution5m
+	if span > metricRetention5m {
+		resolution = model.MetricResolution1h
+	}
+	sums, err := s.metricRepo.SumSamples(resolution, time.Now().Add(-span))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]NodeUptime, 0, len(nodes))
+	for _, node := range nodes {
+		var uptime *float64
+		if sum, ok := sums[node.ID]; ok && sum[0] > 0 {
+			value := float64(sum[1]) / float64(sum[0]) * 100
+			uptime = &value
+		}
+		result = append(result, NodeUptime{
+			NodeID: node.ID,
+			Name:   node.Name,
+			Region: node.Region,
+			Uptime: uptime,
+		})
+	}
+	return result, nil
+}
+
+// resolutionFor 根据查询跨度选择数据粒度
+func resolutionFor(span time.Duration) string {
+	switch {
+	case span <= metricRetentionRaw:
+		return model.MetricResolutionRaw
+	case span <= metricRetention5m:
+		return model.MetricResolution5m
+	default:
+		return model.MetricResolution1h
+	}
+}
+
+// parseMetricRange 解析查询范围，支持 "6h"、"24h"、"7d"、"30d" 等格式，默认 24h
+func parseMetricRange(value string) (time.Duration, error) {
+	if value == "" {
+		return 24 * time.Hour, nil
+	}
+
+	var span time.Duration
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, errors.New("invalid range")
+		}
+		span = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, errors.New("invalid range")
+		}
+		span = d
+	}
+
+	if span <= 0 || span > metricMaxRange {
+		return 0, errors.New("range must be between 1m and 365d")
+	}
+	return span, nil
+}
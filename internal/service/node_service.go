@@ -1,6 +1,7 @@
 package service
 
 import (
+	"errors"
 	"nodepassPanel/internal/model"
 	"nodepassPanel/internal/repository"
 	"nodepassPanel/pkg/nodepass"
@@ -25,6 +26,15 @@ type AddNodeRequest struct {
 	Rate     float64 `json:"rate" binding:"gte=0"`
 	Region   string  `json:"region"`
 	Country  string  `json:"country"`
+
+	// 端口分配 (为空使用默认范围)
+	PortRangeStart int    `json:"port_range_start" binding:"omitempty,min=1,max=65535"`
+	PortRangeEnd   int    `json:"port_range_end" binding:"omitempty,min=1,max=65535"`
+	ReservedPorts  string `json:"reserved_ports"`
+
+	// 故障迁移 (默认关闭)
+	Failover     bool `json:"failover"`
+	FailoverBack bool `json:"failover_back"`
 }
 
 // AddNode 添加新节点并测试连接
@@ -39,10 +49,26 @@ func (s *NodeService) AddNode(req *AddNodeRequest) error {
 		Region:   req.Region,
 		Country:  req.Country,
 		Status:   1,
+
+		PortRangeStart: req.PortRangeStart,
+		PortRangeEnd:   req.PortRangeEnd,
+		ReservedPorts:  req.ReservedPorts,
+		Failover:       req.Failover,
+		FailoverBack:   req.FailoverBack,
+	}
+
+	if node.PortRangeStart == 0 {
+		node.PortRangeStart = 10000
+	}
+	if node.PortRangeEnd == 0 {
+		node.PortRangeEnd = 60000
+	}
+	if err := validateNodePorts(node); err != nil {
+		return err
 	}
 
 	// 1. 验证连接 (调用 NodePass Client)
-	client := nodepass.NewClient(node.Address, node.APIPort, node.APIToken, node.Insecure)
+	client := newNodeClient(node)
 	if _, err := client.Ping(); err != nil {
 		// 这里暂不阻断创建，只是标记状态或记录日志，或者并在描述中备注
 		// return fmt.Errorf("failed to connect to node: %w", err)
@@ -69,7 +95,7 @@ func (s *NodeService) TestNodeConnectivity(nodeID uint) (bool, error) {
 		return false, err
 	}
 
-	client := nodepass.NewClient(node.Address, node.APIPort, node.APIToken, node.Insecure)
+	client := newNodeClient(node)
 	return client.Ping()
 }
 
@@ -89,6 +115,13 @@ type UpdateNodeRequest struct {
 	Rate        *float64 `json:"rate"`
 	Sort        *int     `json:"sort"`
 	Status      *int     `json:"status"`
+
+	PortRangeStart *int    `json:"port_range_start" binding:"omitempty,min=1,max=65535"`
+	PortRangeEnd   *int    `json:"port_range_end" binding:"omitempty,min=1,max=65535"`
+	ReservedPorts  *string `json:"reserved_ports"`
+
+	Failover     *bool `json:"failover"`
+	FailoverBack *bool `json:"failover_back"`
 }
 
 // GetByID 根据ID获取节点
@@ -96,6 +129,11 @@ func (s *NodeService) GetByID(id uint) (*model.Node, error) {
 	return s.nodeRepo.GetByID(id)
 }
 
+// AllowsGroup 节点是否允许指定用户组访问
+func (s *NodeService) AllowsGroup(node *model.Node, groupID int) bool {
+	return nodeAllowsGroup(node, groupID)
+}
+
 // Update 更新节点
 func (s *NodeService) Update(id uint, req *UpdateNodeRequest) (*model.Node, error) {
 	node, err := s.nodeRepo.GetByID(id)
@@ -146,6 +184,24 @@ func (s *NodeService) Update(id uint, req *UpdateNodeRequest) (*model.Node, erro
 	if req.Status != nil {
 		node.Status = *req.Status
 	}
+	if req.PortRangeStart != nil {
+		node.PortRangeStart = *req.PortRangeStart
+	}
+	if req.PortRangeEnd != nil {
+		node.PortRangeEnd = *req.PortRangeEnd
+	}
+	if req.ReservedPorts != nil {
+		node.ReservedPorts = *req.ReservedPorts
+	}
+	if req.Failover != nil {
+		node.Failover = *req.Failover
+	}
+	if req.FailoverBack != nil {
+		node.FailoverBack = *req.FailoverBack
+	}
+	if err := validateNodePorts(node); err != nil {
+		return nil, err
+	}
 
 	if err := s.nodeRepo.Update(node); err != nil {
 		return nil, err
@@ -163,25 +219,26 @@ func (s *NodeService) Delete(id uint) error {
 	return s.nodeRepo.Delete(id)
 }
 
-// RefreshStatus 刷新节点状态 (测试连接并更新状态)
+// RefreshStatus 刷新节点状态 (立即探测并更新状态)
 func (s *NodeService) RefreshStatus(id uint) (*model.Node, error) {
 	node, err := s.nodeRepo.GetByID(id)
 	if err != nil {
 		return nil, err
 	}
 
-	client := nodepass.NewClient(node.Address, node.APIPort, node.APIToken, node.Insecure)
-	connected, _ := client.Ping()
-
-	if connected {
-		node.Status = 1
-	} else {
-		node.Status = 0
-	}
+	NewMonitorService().CheckNode(node)
+	return node, nil
+}
 
-	if err := s.nodeRepo.Update(node); err != nil {
-		return nil, err
+// validateNodePorts 校验节点端口配置
+func validateNodePorts(node *model.Node) error {
+	if node.PortRangeStart > node.PortRangeEnd {
+		return errors.New("端口范围起始值不能大于结束值")
 	}
+	return validatePortList(node.ReservedPorts)
+}
 
-	return node, nil
+// newNodeClient 根据节点信息创建 NodePass 客户端
+func newNodeClient(node *model.Node) *nodepass.Client {
+	return nodepass.NewClient(node.Address, node.APIPort, node.APIToken, node.Insecure)
 }
@@ -1,39 +1,55 @@
 package service
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
-	"nodepassPanel/internal/config"
+	"math"
+	"nodepassPanel/internal/global"
 	"nodepassPanel/internal/model"
 	"nodepassPanel/internal/payment"
-	"nodepassPanel/internal/payment/epay"
-	"nodepassPanel/internal/payment/stripe"
 	"nodepassPanel/internal/repository"
+	"nodepassPanel/internal/websocket"
+	"nodepassPanel/pkg/logger"
+	"strings"
 	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // OrderService 订单服务层
 type OrderService struct {
-	orderRepo     *repository.OrderRepository
-	planRepo      *repository.PlanRepository
-	userRepo      *repository.UserRepository
-	couponService *CouponService
+	orderRepo      *repository.OrderRepository
+	txnRepo        *repository.PaymentTransactionRepository
+	planRepo       *repository.PlanRepository
+	userRepo       *repository.UserRepository
+	couponService  *CouponService
+	settingService *SettingService
+	paymentService *PaymentService
+	enforcement    *EnforcementService
 }
 
 // NewOrderService 创建订单服务实例
 func NewOrderService() *OrderService {
 	return &OrderService{
-		orderRepo:     repository.NewOrderRepository(),
-		planRepo:      repository.NewPlanRepository(),
-		userRepo:      repository.NewUserRepository(),
-		couponService: NewCouponService(),
+		orderRepo:      repository.NewOrderRepository(),
+		txnRepo:        repository.NewPaymentTransactionRepository(),
+		planRepo:       repository.NewPlanRepository(),
+		userRepo:       repository.NewUserRepository(),
+		couponService:  NewCouponService(),
+		settingService: NewSettingService(),
+		paymentService: NewPaymentService(),
+		enforcement:    NewEnforcementService(),
 	}
 }
 
 // CreateOrderRequest 创建订单请求
 type CreateOrderRequest struct {
 	PlanID     uint   `json:"plan_id" binding:"required"`
-	CouponCode string `json:"coupon_code"` // 优惠券码
+	Period     string `json:"period" binding:"required,oneof=monthly quarterly half_yearly yearly onetime"` // 计费周期
+	CouponCode string `json:"coupon_code"`                                                                  // 优惠券码
 	Remark     string `json:"remark"`
 }
 
@@ -53,6 +69,9 @@ type OrderListResponse struct {
 	PageSize int           `json:"page_size"`
 }
 
+// gigabyte 套餐流量单位 GB 对应的字节数
+const gigabyte int64 = 1024 * 1024 * 1024
+
 // generateOrderNo 生成订单号
 func generateOrderNo() string {
 	return fmt.Sprintf("NP%d%04d", time.Now().Unix(), time.Now().Nanosecond()/1000000)
@@ -66,14 +85,39 @@ func (s *OrderService) Create(userID uint, req *CreateOrderRequest) (*model.Orde
 		return nil, errors.New("plan not found")
 	}
 
+	// 套餐变更订单按下单时的套餐状态计算抵扣，支付前不能再购买其他套餐
+	pending, err := s.orderRepo.HasPending(userID, model.OrderTypeUpgrade)
+	if err != nil {
+		return nil, err
+	}
+	if pending {
+		return nil, errors.New("存在待支付的套餐变更订单，请先支付或取消")
+	}
+
+	price, err := s.planRepo.GetPrice(plan.ID, req.Period)
+	if err != nil {
+		return nil, errors.New("该套餐不支持此计费周期")
+	}
+
+	// 流量包只增加流量，需要在套餐有效期内购买
+	if price.Duration == 0 {
+		user, err := s.userRepo.GetByID(userID)
+		if err != nil {
+			return nil, errors.New("user not found")
+		}
+		if user.ExpiredAt == nil || !user.ExpiredAt.After(time.Now()) {
+			return nil, errors.New("流量包需要在套餐有效期内购买")
+		}
+	}
+
 	// 初始金额
-	amount := plan.Price
+	amount := price.Price
 	discount := 0.0
 	var couponID *uint
 
 	// 处理优惠券
 	if req.CouponCode != "" {
-		coupon, verifiedDiscount, err := s.couponService.VerifyCoupon(req.CouponCode, userID, req.PlanID, amount)
+		coupon, verifiedDiscount, err := s.couponService.VerifyCoupon(req.CouponCode, userID, req.PlanID, req.Period, amount)
 		if err != nil {
 			return nil, fmt.Errorf("coupon error: %v", err)
 		}
@@ -106,29 +150,38 @@ func (s *OrderService) Create(userID uint, req *CreateOrderRequest) (*model.Orde
 		Status:    model.OrderStatusPending,
 		ExpiredAt: &expiredAt,
 		Remark:    req.Remark,
+
+		Period:      price.Period,
+		ResetPolicy: price.ResetPolicy,
+		GrantedDays: price.Duration,
 	}
 
-	if err := s.orderRepo.Create(order); err != nil {
+	if err := s.createWithCoupon(order); err != nil {
 		return nil, err
 	}
 
-	// 如果优惠券被使用，增加使用次数？
-	// 通常在订单 *支付成功* 后增加使用次数。
-	// 但是这里是创建订单。
-	// VerifyCoupon checked usage limit.
-	// If usage limit is checked at creation, multiple pending orders could exceed limit.
-	// Ideally we should lock or reserve usage.
-	// For simplicity, we check at creation. The strict check should happen at payment time or we accept minor over-usage.
-	// Or we increment used count now? No, if order cancelled, it's messy.
-	// Standard practice: Usage count increments on Payment Success.
-	// VerifyCoupon checks "UsedCount". (Paid orders).
-	// So if I create 10 pending orders, usage count is 0.
-	// Then I pay all 10 -> Usage count might go over limit if race.
-	// This is acceptable for now.
-
 	return order, nil
 }
 
+// createWithCoupon 创建订单并占用优惠券次数，避免多个待支付订单超出总量限制；订单取消或过期时释放
+func (s *OrderService) createWithCoupon(order *model.Order) error {
+	return global.DB.Transaction(func(tx *gorm.DB) error {
+		if order.CouponID != nil {
+			result := tx.Model(&model.Coupon{}).
+				Where("id = ? AND (total_limit = 0 OR used_count < total_limit)", *order.CouponID).
+				UpdateColumn("used_count", gorm.Expr("used_count + ?", 1))
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errors.New("coupon error: 优惠券已领完")
+			}
+			order.CouponReserved = true
+		}
+		return tx.Create(order).Error
+	})
+}
+
 // CreateRechargeOrder 创建充值订单
 func (s *OrderService) CreateRechargeOrder(userID uint, amount float64) (*model.Order, error) {
 	if amount <= 0 {
@@ -209,12 +262,97 @@ func (s *OrderService) Cancel(orderID uint, userID uint) error {
 	}
 
 	// 只能取消待支付的订单
-	if order.Status != model.OrderStatusPending {
+	cancelled, err := s.cancelPending(order, "")
+	if err != nil {
+		return err
+	}
+	if !cancelled {
 		return errors.New("order cannot be cancelled")
 	}
+	return nil
+}
+
+// CancelExpired 取消已过期的待支付订单，释放优惠券并通知用户
+func (s *OrderService) CancelExpired() {
+	orders, err := s.orderRepo.GetExpiredPending(time.Now(), 500)
+	if err != nil {
+		logger.Log.Error("Failed to load expired orders", zap.Error(err))
+		return
+	}
+
+	for i := range orders {
+		order := &orders[i]
+		cancelled, err := s.cancelPending(order, "订单超时自动取消")
+		if err != nil {
+			logger.Log.Error("Failed to cancel expired order", zap.String("order_no", order.OrderNo), zap.Error(err))
+			continue
+		}
+		if cancelled {
+			websocket.PushToUser(order.UserID, websocket.NewEvent(websocket.EventOrderExpired, order))
+		}
+	}
+}
+
+// orderExpired 订单是否已超过支付期限
+func orderExpired(order *model.Order, now time.Time) bool {
+	return order.ExpiredAt != nil && now.After(*order.ExpiredAt)
+}
+
+// cancelPending 以待支付状态为条件取消订单并追加备注，订单已被支付或取消时返回 false
+func (s *OrderService) cancelPending(order *model.Order, remark string) (bool, error) {
+	remark = appendRemark(order.Remark, remark)
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.Order{}).
+			Where("id = ? AND status = ?", order.ID, model.OrderStatusPending).
+			Updates(map[string]interface{}{
+				"status":          model.OrderStatusCancelled,
+				"remark":          remark,
+				"coupon_reserved": false,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errOrderNotPending
+		}
+		return releaseCoupon(tx, order)
+	})
+	if errors.Is(err, errOrderNotPending) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
 
 	order.Status = model.OrderStatusCancelled
-	return s.orderRepo.Update(order)
+	order.Remark = remark
+	order.CouponReserved = false
+	publishOrderStatus(order)
+	return true, nil
+}
+
+// releaseCoupon 在事务中释放订单占用的优惠券次数 (调用方负责清除订单的占用标记)
+func releaseCoupon(tx *gorm.DB, order *model.Order) error {
+	if order.CouponID == nil || !order.CouponReserved {
+		return nil
+	}
+	return tx.Model(&model.Coupon{}).
+		Where("id = ? AND used_count > 0", *order.CouponID).
+		UpdateColumn("used_count", gorm.Expr("used_count - ?", 1)).Error
+}
+
+// addRemark 追加订单备注
+func (s *OrderService) addRemark(order *model.Order, remark string) error {
+	order.Remark = appendRemark(order.Remark, remark)
+	return s.orderRepo.UpdateRemark(order.ID, order.Remark)
+}
+
+// appendRemark 在已有备注后另起一行追加
+func appendRemark(current, remark string) string {
+	if current == "" || remark == "" {
+		return current + remark
+	}
+	return current + "\n" + remark
 }
 
 // MarkPaid 标记已支付（手动审核）
@@ -224,52 +362,112 @@ func (s *OrderService) MarkPaid(orderID uint, payMethod string) error {
 		return errors.New("order not found")
 	}
 
-	if order.Status != model.OrderStatusPending {
+	// 过期后支付的订单由管理员确认后发放权益
+	if order.Status != model.OrderStatusPending && order.Status != model.OrderStatusPaidAfterExpiry {
 		return errors.New("order is not pending")
 	}
 
-	now := time.Now()
-	order.Status = model.OrderStatusPaid
-	order.PayMethod = payMethod
-	order.PaidAt = &now
+	txn := &model.PaymentTransaction{
+		OrderID: order.ID,
+		OrderNo: order.OrderNo,
+		Method:  payMethod,
+		Action:  model.PaymentActionManual,
+		Amount:  order.Paid,
+	}
+	completed, err := s.completePayment(order, order.Status, payMethod, "", nil)
+	if err == nil && !completed {
+		err = errors.New("order is not pending")
+	}
+	s.recordTransaction(txn, err)
+	return err
+}
 
-	if err := s.orderRepo.Update(order); err != nil {
-		return err
+// recordTransaction 保存支付网关交互记录，失败只记录日志，不影响支付流程
+func (s *OrderService) recordTransaction(txn *model.PaymentTransaction, err error) {
+	txn.Success = err == nil
+	if err != nil {
+		txn.Error = err.Error()
+	}
+	if err := s.txnRepo.Create(txn); err != nil {
+		logger.Log.Error("Payment: 保存支付记录失败",
+			zap.String("order_no", txn.OrderNo), zap.String("action", txn.Action), zap.Error(err))
 	}
+}
 
-	// Increment coupon usage if used
-	if order.CouponID != nil {
-		// s.couponRepo.IncrementUsedCount(int(*order.CouponID))
-		// I need access to couponRepo here.
-		// Inject couponRepo or use s.couponService.couponRepo (if exported? No, it's private).
-		// I should call s.couponService.MarkUsed(*order.CouponID).
-		// I need to add MarkUsed to CouponService.
+// GetPayments 获取订单的支付网关交互记录（管理员）
+func (s *OrderService) GetPayments(orderID uint) ([]model.PaymentTransaction, error) {
+	if _, err := s.orderRepo.GetByID(orderID); err != nil {
+		return nil, errors.New("order not found")
 	}
-	// Defer implementing MarkUsed to next step or ignore for now?
-	// Requirement says "Coupon System". Usage count is important.
-	// I already added IncrementUsedCount to CouponRepo (verified in previous read).
-	// So I should add IncrementUsage to CouponService and call it here.
+	return s.txnRepo.GetByOrderID(orderID)
+}
 
-	// For now I won't call it to avoid compilation error until I add it.
-	// Or I'll add the call and assume I will fix CouponService next.
-	// s.couponService.IncrementUsage(int(*order.CouponID))
+// errOrderNotPending 订单已不是待支付状态 (已被其他请求处理)
+var errOrderNotPending = errors.New("order is not pending")
 
-	// 处理订单完成后的逻辑：给用户添加时长和流量
-	return s.processOrderCompletion(order)
-}
+// completePayment 在一个事务中将 from 状态 (待支付或过期后支付) 的订单标记为已支付并发放权益
+// 以订单状态为条件更新，重复或并发的回调只有一个会生效，其余返回 false
+// charge 在同一事务中执行 (如扣除余额)，返回错误时整体回滚
+func (s *OrderService) completePayment(order *model.Order, from int, payMethod, tradeNo string, charge func(tx *gorm.DB) error) (bool, error) {
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":     model.OrderStatusPaid,
+		"paid_at":    now,
+		"pay_method": payMethod,
+	}
+	if tradeNo != "" {
+		updates["trade_no"] = tradeNo
+	}
 
-// processOrderCompletion 处理订单完成
-func (s *OrderService) processOrderCompletion(order *model.Order) error {
-	// 获取用户
-	user, err := s.userRepo.GetByID(order.UserID)
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.Order{}).
+			Where("id = ? AND status = ?", order.ID, from).
+			Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errOrderNotPending
+		}
+
+		if charge != nil {
+			if err := charge(tx); err != nil {
+				return err
+			}
+		}
+		return s.processOrderCompletion(tx, order)
+	})
+	if errors.Is(err, errOrderNotPending) {
+		return false, nil
+	}
 	if err != nil {
-		return err
+		return false, err
+	}
+
+	order.Status = model.OrderStatusPaid
+	order.PaidAt = &now
+	order.PayMethod = payMethod
+	if tradeNo != "" {
+		order.TradeNo = tradeNo
 	}
+	s.afterOrderPaid(order)
+	return true, nil
+}
 
+// processOrderCompletion 在事务中发放订单权益：充值订单增加余额，套餐订单增加时长、流量并更新用户组
+func (s *OrderService) processOrderCompletion(tx *gorm.DB, order *model.Order) error {
 	// 充值订单处理
 	if order.Type == model.OrderTypeRecharge {
-		user.Balance += order.Amount
-		return s.userRepo.Update(user)
+		_, err := postLedger(tx, &LedgerEntry{
+			UserID:  order.UserID,
+			Account: model.AccountBalance,
+			Counter: model.AccountSystemGateway,
+			Type:    model.BalanceTypeRecharge,
+			Amount:  order.Amount,
+			OrderID: order.ID,
+			Memo:    fmt.Sprintf("充值订单 %s", order.OrderNo),
+		})
+		return err
 	}
 
 	// 必须要有 PlanID
@@ -277,56 +475,431 @@ func (s *OrderService) processOrderCompletion(order *model.Order) error {
 		return errors.New("invalid order: missing plan_id for plan order")
 	}
 
-	// 获取套餐
-	plan, err := s.planRepo.GetByID(*order.PlanID)
-	if err != nil {
+	// 获取套餐 (事务内不能再占用其他连接)
+	var plan model.Plan
+	if err := tx.First(&plan, *order.PlanID).Error; err != nil {
+		return err
+	}
+
+	// 锁定用户，避免同一用户的多笔订单同时续期时互相覆盖到期时间
+	var user model.User
+	if err := lockForUpdate(tx).First(&user, order.UserID).Error; err != nil {
 		return err
 	}
 
-	// 添加时长
+	// 只更新权益相关字段，流量计数由采集任务并发累加
 	now := time.Now()
-	if user.ExpiredAt == nil || user.ExpiredAt.Before(now) {
-		// 从现在开始计算
-		expiredAt := now.AddDate(0, 0, plan.Duration)
-		user.ExpiredAt = &expiredAt
+	var updates map[string]interface{}
+	if order.Type == model.OrderTypeUpgrade {
+		// 套餐变更：替换原套餐，有效期从现在开始计算，已用流量之外重新提供下单时报价的流量
+		order.PrevExpiredAt = user.ExpiredAt
+		order.PrevTransferEnable = user.TransferEnable
+		updates = map[string]interface{}{
+			"expired_at":      now.AddDate(0, 0, order.GrantedDays),
+			"transfer_enable": gorm.Expr("upload + download + ?", order.GrantedTransfer),
+		}
 	} else {
-		// 从原有到期时间延长
-		expiredAt := user.ExpiredAt.AddDate(0, 0, plan.Duration)
-		user.ExpiredAt = &expiredAt
+		// 有效期按下单时的计费周期发放，未记录计费周期的旧订单按套餐有效期
+		if order.Period == "" {
+			order.GrantedDays = plan.Duration
+		}
+		order.GrantedTransfer = plan.Transfer * gigabyte
+		updates = map[string]interface{}{}
+
+		// 添加时长：已过期从现在开始计算，否则从原有到期时间延长；流量包不改变有效期
+		if order.GrantedDays > 0 {
+			expiredAt := now.AddDate(0, 0, order.GrantedDays)
+			if user.ExpiredAt != nil && user.ExpiredAt.After(now) {
+				expiredAt = user.ExpiredAt.AddDate(0, 0, order.GrantedDays)
+			}
+			updates["expired_at"] = expiredAt
+		}
+
+		// 按重置策略清零已用流量，否则在原有流量上累加
+		if order.ResetPolicy == model.TrafficResetPurchase || order.ResetPolicy == model.TrafficResetMonthly {
+			updates["upload"] = 0
+			updates["download"] = 0
+			updates["transfer_enable"] = order.GrantedTransfer
+		} else {
+			updates["transfer_enable"] = gorm.Expr("transfer_enable + ?", order.GrantedTransfer)
+		}
 	}
 
-	// 添加流量 (GB 转 Bytes)
-	user.TransferEnable += plan.Transfer * 1024 * 1024 * 1024
+	// 按月重置的套餐记录下次重置时间，流量包不影响当前套餐的重置周期
+	if order.GrantedDays > 0 {
+		var resetAt *time.Time
+		if order.ResetPolicy == model.TrafficResetMonthly {
+			next := now.AddDate(0, 1, 0)
+			if expiredAt, ok := updates["expired_at"].(time.Time); ok && next.Before(expiredAt) {
+				resetAt = &next
+			}
+		}
+		updates["traffic_reset_at"] = resetAt
+	}
+	if plan.GroupID > 0 && order.GrantedDays > 0 {
+		updates["group_id"] = plan.GroupID
+	}
+	if err := tx.Model(&model.User{}).Where("id = ?", user.ID).Updates(updates).Error; err != nil {
+		return err
+	}
 
-	// 更新用户组
-	if plan.GroupID > 0 {
-		user.GroupID = plan.GroupID
+	// 记录发放的权益与变更前状态，退款时据此收回
+	order.PrevGroupID = user.GroupID
+	if err := tx.Model(&model.Order{}).Where("id = ?", order.ID).Updates(map[string]interface{}{
+		"granted_days":         order.GrantedDays,
+		"granted_transfer":     order.GrantedTransfer,
+		"prev_group_id":        order.PrevGroupID,
+		"prev_expired_at":      order.PrevExpiredAt,
+		"prev_transfer_enable": order.PrevTransferEnable,
+	}).Error; err != nil {
+		return err
 	}
 
-	// Call coupon usage increment here
-	if order.CouponID != nil {
-		s.couponService.IncrementUsage(int(*order.CouponID))
+	// 优惠券使用次数 (创建时未占用的订单在支付时计入)
+	if order.CouponID != nil && !order.CouponReserved {
+		if err := tx.Model(&model.Coupon{}).Where("id = ?", *order.CouponID).
+			UpdateColumn("used_count", gorm.Expr("used_count + ?", 1)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// afterOrderPaid 订单支付事务提交后的通知与实例恢复
+func (s *OrderService) afterOrderPaid(order *model.Order) {
+	websocket.PushToUser(order.UserID, websocket.NewEvent(websocket.EventOrderPaid, order))
+	publishOrderStatus(order)
+
+	// 续费或变更套餐后恢复被停用的实例 (节点操作较慢，不阻塞支付回调)
+	if order.Type != model.OrderTypeRecharge {
+		go s.enforcement.ResumeIfCompliant(order.UserID, model.InstanceReasonPlanPurchased)
+	}
+}
+
+// lockForUpdate 行级锁 (SQLite 不支持 FOR UPDATE，写事务本身已串行)
+func lockForUpdate(tx *gorm.DB) *gorm.DB {
+	if tx.Dialector.Name() == "sqlite" {
+		return tx
 	}
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"})
+}
+
+// publishOrderStatus 向订阅了该订单的连接推送状态
+func publishOrderStatus(order *model.Order) {
+	websocket.Publish(websocket.OrderRoom(order.ID), websocket.NewEvent(websocket.EventOrderStatus, order))
+}
+
+// RefundRequest 退款请求
+type RefundRequest struct {
+	Amount float64 `json:"amount" binding:"omitempty,gt=0"` // 退款金额，为空时退还剩余全部金额
+	Reason string  `json:"reason" binding:"max=255"`
+}
 
-	return s.userRepo.Update(user)
+// RefundResult 退款结果
+type RefundResult struct {
+	Order    *model.Order `json:"order"`
+	Amount   float64      `json:"amount"`    // 本次退款金额
+	RefundNo string       `json:"refund_no"` // 网关退款单号
+	Manual   bool         `json:"manual"`    // 支付方式不支持原路退款，需在网关后台手动退款
 }
 
-// Refund 退款
-func (s *OrderService) Refund(orderID uint) error {
+// Refund 退款，支持部分退款
+// 订单发放的时长、流量与充值余额按退款比例收回，全额退款时恢复原用户组
+// 余额支付退回余额，支持原路退款的网关 (Stripe) 在事务外调用退款接口，其余方式仅更新订单，由管理员手动退款
+func (s *OrderService) Refund(orderID uint, req *RefundRequest) (*RefundResult, error) {
 	order, err := s.orderRepo.GetByID(orderID)
 	if err != nil {
-		return errors.New("order not found")
+		return nil, errors.New("order not found")
 	}
 
-	if order.Status != model.OrderStatusPaid {
-		return errors.New("order is not paid")
+	// 过期后支付的订单未发放权益，只能全额退款
+	review := order.Status == model.OrderStatusPaidAfterExpiry
+	if order.Status != model.OrderStatusPaid && !review {
+		return nil, errors.New("order is not paid")
 	}
 
+	remaining := payment.ToCents(order.Paid) - payment.ToCents(order.Refunded)
+	cents := payment.ToCents(req.Amount)
+	if cents == 0 {
+		cents = remaining
+	}
+	if cents > remaining {
+		return nil, fmt.Errorf("refund amount exceeds refundable %.2f", float64(remaining)/100)
+	}
+	if review && cents != remaining {
+		return nil, errors.New("order paid after expiry can only be fully refunded")
+	}
+	if order.Type == model.OrderTypeUpgrade && cents != remaining {
+		return nil, errors.New("upgrade order can only be fully refunded")
+	}
+
+	amount := float64(cents) / 100
+	full := cents == remaining
+	refunded := float64(payment.ToCents(order.Refunded)+cents) / 100
+
+	// 收回比例按累计退款占实付金额计算，多次部分退款的收回总量与一次全额退款一致；免费订单只能全额退款
+	fromRatio, toRatio := 0.0, 1.0
+	if order.Paid > 0 {
+		fromRatio = order.Refunded / order.Paid
+		if !full {
+			toRatio = refunded / order.Paid
+		}
+	}
+
+	status := model.OrderStatusPaid
+	if full {
+		status = model.OrderStatusRefunded
+	}
+
+	txn := &model.PaymentTransaction{
+		OrderID: order.ID,
+		OrderNo: order.OrderNo,
+		Method:  order.PayMethod,
+		Action:  model.PaymentActionRefund,
+		Amount:  amount,
+	}
+	result := &RefundResult{Order: order, Amount: amount}
+
 	now := time.Now()
-	order.Status = model.OrderStatusRefunded
+	// complete 以状态与已退金额为条件更新订单，防止并发退款超额
+	complete := func(tx *gorm.DB, from int) error {
+		update := tx.Model(&model.Order{}).
+			Where("id = ? AND status = ? AND refunded = ?", order.ID, from, order.Refunded).
+			Updates(map[string]interface{}{
+				"refunded":    refunded,
+				"status":      status,
+				"refunded_at": now,
+			})
+		if update.Error != nil {
+			return update.Error
+		}
+		if update.RowsAffected == 0 {
+			return errors.New("order was modified concurrently, please retry")
+		}
+		return nil
+	}
+
+	if refunder := s.refunder(order); refunder != nil {
+		var clawback func(tx *gorm.DB) error
+		if !review {
+			clawback = func(tx *gorm.DB) error {
+				return s.clawback(tx, order, amount, fromRatio, toRatio, full)
+			}
+		}
+		err = s.refundViaGateway(order, refunder, req.Reason, result, complete, clawback)
+	} else {
+		err = global.DB.Transaction(func(tx *gorm.DB) error {
+			if err := complete(tx, order.Status); err != nil {
+				return err
+			}
+			if !review {
+				if err := s.clawback(tx, order, amount, fromRatio, toRatio, full); err != nil {
+					return err
+				}
+			}
+			return s.refundPayment(tx, order, amount, req.Reason, result)
+		})
+	}
+
+	txn.TradeNo = result.RefundNo
+	if data, err := json.Marshal(map[string]interface{}{"amount": amount, "reason": req.Reason, "manual": result.Manual}); err == nil {
+		txn.Request = string(data)
+	}
+	s.recordTransaction(txn, err)
+	if err != nil {
+		return nil, err
+	}
+
+	order.Refunded = refunded
+	order.Status = status
 	order.RefundedAt = &now
+	publishOrderStatus(order)
+
+	// 权益收回后可能已超额或到期 (节点操作较慢，不阻塞请求)
+	go s.enforcement.SuspendIfViolating(order.UserID)
+	return result, nil
+}
+
+// clawback 在事务中收回订单发放的权益
+// 充值订单扣回退款金额，套餐订单收回 [fromRatio, toRatio) 区间对应的时长与流量
+func (s *OrderService) clawback(tx *gorm.DB, order *model.Order, amount, fromRatio, toRatio float64, full bool) error {
+	// 充值订单扣回余额，余额已被使用时无法退款
+	if order.Type == model.OrderTypeRecharge {
+		_, err := postLedger(tx, &LedgerEntry{
+			UserID:  order.UserID,
+			Account: model.AccountBalance,
+			Counter: model.AccountSystemGateway,
+			Type:    model.BalanceTypeRechargeRefund,
+			Amount:  -amount,
+			OrderID: order.ID,
+			Memo:    fmt.Sprintf("充值订单 %s 退款", order.OrderNo),
+		})
+		if errors.Is(err, errInsufficientBalance) {
+			return errors.New("用户余额不足以扣回充值金额")
+		}
+		return err
+	}
+
+	// 套餐变更订单只能全额退款，恢复变更前的套餐状态
+	if order.Type == model.OrderTypeUpgrade {
+		updates := map[string]interface{}{
+			"expired_at":      order.PrevExpiredAt,
+			"transfer_enable": order.PrevTransferEnable,
+		}
+		if order.PrevGroupID > 0 {
+			updates["group_id"] = order.PrevGroupID
+		}
+		return tx.Model(&model.User{}).Where("id = ?", order.UserID).Updates(updates).Error
+	}
+
+	var user model.User
+	if err := lockForUpdate(tx).First(&user, order.UserID).Error; err != nil {
+		return err
+	}
+
+	portion := func(granted float64) float64 {
+		return math.Round(granted*toRatio) - math.Round(granted*fromRatio)
+	}
+
+	updates := map[string]interface{}{}
+
+	days := int(portion(float64(order.GrantedDays)))
+	if days > 0 && user.ExpiredAt != nil {
+		updates["expired_at"] = user.ExpiredAt.AddDate(0, 0, -days)
+	}
+
+	transfer := int64(portion(float64(order.GrantedTransfer)))
+	if transfer > 0 {
+		updates["transfer_enable"] = max(user.TransferEnable-transfer, 0)
+	}
+
+	if full && order.PrevGroupID > 0 {
+		updates["group_id"] = order.PrevGroupID
+	}
 
-	return s.orderRepo.Update(order)
+	if len(updates) == 0 {
+		return nil
+	}
+	return tx.Model(&model.User{}).Where("id = ?", user.ID).Updates(updates).Error
+}
+
+// refundViaGateway 网关原路退款，网关请求不占用数据库事务
+// 先将订单标记为退款中并扣回充值余额 (余额不足时不发起退款)，提交后调用网关；
+// 网关失败时恢复订单状态与余额，成功后在新事务中收回权益并完成退款；clawback 为空时不收回权益
+func (s *OrderService) refundViaGateway(order *model.Order, refunder payment.Refunder, reason string, result *RefundResult,
+	complete func(tx *gorm.DB, from int) error, clawback func(tx *gorm.DB) error) error {
+	// 充值余额在发起退款前扣回，避免退款后余额已被消费
+	debit := clawback != nil && order.Type == model.OrderTypeRecharge
+
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		claim := tx.Model(&model.Order{}).
+			Where("id = ? AND status = ? AND refunded = ?", order.ID, order.Status, order.Refunded).
+			Update("status", model.OrderStatusRefunding)
+		if claim.Error != nil {
+			return claim.Error
+		}
+		if claim.RowsAffected == 0 {
+			return errors.New("order was modified concurrently, please retry")
+		}
+		if debit {
+			return clawback(tx)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := refunder.Refund(&payment.RefundRequest{
+		OrderID: order.OrderNo,
+		TradeNo: order.TradeNo,
+		Amount:  result.Amount,
+		Reason:  reason,
+	})
+	if err != nil {
+		if rollbackErr := s.revertRefunding(order, result.Amount, debit); rollbackErr != nil {
+			logger.Log.Error("订单退款: 恢复订单状态失败", zap.String("order_no", order.OrderNo), zap.Error(rollbackErr))
+		}
+		return fmt.Errorf("gateway refund failed: %v", err)
+	}
+	result.RefundNo = resp.RefundNo
+
+	err = global.DB.Transaction(func(tx *gorm.DB) error {
+		if err := complete(tx, model.OrderStatusRefunding); err != nil {
+			return err
+		}
+		if clawback != nil && !debit {
+			return clawback(tx)
+		}
+		return nil
+	})
+	if err != nil {
+		// 款项已退回，订单保持退款中状态等待管理员核对
+		logger.Log.Error("订单退款: 网关已退款但订单更新失败",
+			zap.String("order_no", order.OrderNo), zap.String("refund_no", resp.RefundNo), zap.Error(err))
+		return fmt.Errorf("网关已退款 (退款单号 %s)，但订单更新失败: %v", resp.RefundNo, err)
+	}
+	return nil
+}
+
+// revertRefunding 网关退款失败时恢复订单状态，credit 为真时退回已扣回的充值余额
+func (s *OrderService) revertRefunding(order *model.Order, amount float64, credit bool) error {
+	return global.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.Order{}).
+			Where("id = ? AND status = ?", order.ID, model.OrderStatusRefunding).
+			Update("status", order.Status)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		if !credit {
+			return nil
+		}
+		_, err := postLedger(tx, &LedgerEntry{
+			UserID:  order.UserID,
+			Account: model.AccountBalance,
+			Counter: model.AccountSystemGateway,
+			Type:    model.BalanceTypeRechargeRefund,
+			Amount:  amount,
+			OrderID: order.ID,
+			Memo:    fmt.Sprintf("充值订单 %s 退款失败，退回扣款", order.OrderNo),
+		})
+		return err
+	})
+}
+
+// refunder 获取支持原路退款的网关，余额支付与不支持原路退款的方式返回 nil
+func (s *OrderService) refunder(order *model.Order) payment.Refunder {
+	method := payment.PaymentMethod(order.PayMethod)
+	if method == payment.MethodBalance {
+		return nil
+	}
+	strategy, _, err := s.paymentService.Strategy(method)
+	if err != nil {
+		return nil
+	}
+	refunder, _ := strategy.(payment.Refunder)
+	return refunder
+}
+
+// refundPayment 在事务中退回不经过网关的款项：余额支付退回余额，其余方式由管理员手动退款
+func (s *OrderService) refundPayment(tx *gorm.DB, order *model.Order, amount float64, reason string, result *RefundResult) error {
+	method := payment.PaymentMethod(order.PayMethod)
+	if method == payment.MethodBalance {
+		_, err := postLedger(tx, &LedgerEntry{
+			UserID:  order.UserID,
+			Account: model.AccountBalance,
+			Counter: model.AccountSystemRevenue,
+			Type:    model.BalanceTypeRefund,
+			Amount:  amount,
+			OrderID: order.ID,
+			Memo:    fmt.Sprintf("订单 %s 退款: %s", order.OrderNo, reason),
+		})
+		return err
+	}
+
+	// 管理员手动标记或不支持原路退款的网关
+	result.Manual = true
+	return nil
 }
 
 // Delete 删除订单（管理员）
@@ -349,77 +922,103 @@ func (s *OrderService) PayOrder(orderNo string, method payment.PaymentMethod, cl
 	if order.Status != model.OrderStatusPending {
 		return nil, errors.New("订单不是待支付状态")
 	}
+	if orderExpired(order, time.Now()) {
+		return nil, errors.New("订单已过期")
+	}
 
-	if order.Status != model.OrderStatusPending {
-		return nil, errors.New("order is not pending")
+	txn := &model.PaymentTransaction{
+		OrderID:  order.ID,
+		OrderNo:  order.OrderNo,
+		Method:   string(method),
+		Action:   model.PaymentActionPay,
+		Amount:   order.Paid,
+		ClientIP: clientIP,
 	}
+	resp, err := s.pay(order, method, clientIP, txn)
+	s.recordTransaction(txn, err)
+	return resp, err
+}
 
+// pay 通过余额或支付网关发起支付，交互细节写入 txn
+func (s *OrderService) pay(order *model.Order, method payment.PaymentMethod, clientIP string, txn *model.PaymentTransaction) (*payment.PayResponse, error) {
 	// 余额支付特殊处理
 	if method == payment.MethodBalance {
-		user, err := s.userRepo.GetByID(order.UserID)
-		if err != nil {
-			return nil, err
-		}
-
-		if user.Balance < order.Amount {
-			return nil, errors.New("余额不足")
-		}
-
 		if order.Type == model.OrderTypeRecharge {
 			return nil, errors.New("充值订单不能使用余额支付")
 		}
 
-		// 扣除余额
-		user.Balance -= order.Amount
-		if err := s.userRepo.Update(user); err != nil {
-			return nil, err
-		}
-
-		// 标记支付成功
-		now := time.Now()
-		order.Status = model.OrderStatusPaid
-		order.PaidAt = &now
-		order.PayMethod = string(method)
-		if err := s.orderRepo.Update(order); err != nil {
+		// 扣除余额与标记支付在同一事务中完成，余额不足时整体回滚
+		completed, err := s.completePayment(order, model.OrderStatusPending, string(method), "", func(tx *gorm.DB) error {
+			_, err := postLedger(tx, &LedgerEntry{
+				UserID:  order.UserID,
+				Account: model.AccountBalance,
+				Counter: model.AccountSystemRevenue,
+				Type:    model.BalanceTypePurchase,
+				Amount:  -order.Paid,
+				OrderID: order.ID,
+				Memo:    fmt.Sprintf("订单 %s 余额支付", order.OrderNo),
+			})
+			return err
+		})
+		if err != nil {
 			return nil, err
 		}
-
-		// 完成订单
-		if err := s.processOrderCompletion(order); err != nil {
-			return nil, err
+		if !completed {
+			return nil, errors.New("订单不是待支付状态")
 		}
 
+		txn.TradeNo = fmt.Sprintf("BAL%s", order.OrderNo)
 		return &payment.PayResponse{
 			PayURL:      "",
 			ContentType: "success",
-			TradeNo:     fmt.Sprintf("BAL%s", order.OrderNo),
+			TradeNo:     txn.TradeNo,
 		}, nil
 	}
 
 	// 创建支付策略
-	strategy, err := s.getPaymentStrategy(method)
+	strategy, cfg, err := s.paymentService.PayStrategy(method, order.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	urls, err := s.settingService.SiteURLs()
 	if err != nil {
 		return nil, err
 	}
 
+	// 手续费由用户承担，每次发起支付按所选网关重新计算，并记录在本次支付记录中供回调核对
+	order.Fee = gatewayFee(order.Paid, cfg.FeePercent)
+	txn.Fee = order.Fee
 	req := &payment.PayRequest{
 		OrderID:     order.OrderNo,
-		Amount:      order.Paid, // 使用实付金额
+		Amount:      order.Paid + order.Fee, // 实付金额 + 手续费
 		Description: fmt.Sprintf("订单 %s", order.OrderNo),
 		ClientIP:    clientIP,
 		Method:      method,
+		NotifyURL:   urls.NotifyURL(method),
+		ReturnURL:   urls.ReturnURL(order.OrderNo, ReturnStatusSuccess),
+		CancelURL:   urls.ReturnURL(order.OrderNo, ReturnStatusCancel),
+		ExpiresAt:   order.ExpiredAt,
+	}
+	if data, err := json.Marshal(req); err == nil {
+		txn.Request = string(data)
 	}
 
 	resp, err := strategy.Pay(req)
 	if err != nil {
 		return nil, err
 	}
+	txn.PayURL = resp.PayURL
+	txn.TradeNo = resp.TradeNo
 
-	// 如果提供了 TradeNo (例如 Stripe Session ID)，更新订单
+	// 记录手续费与支付方式，回调时据此校验金额
+	// 如果提供了 TradeNo (例如 Stripe Session ID)，一并更新
 	if resp.TradeNo != "" {
 		order.TradeNo = resp.TradeNo
-		order.PayMethod = string(method)
-		s.orderRepo.Update(order)
+	}
+	order.PayMethod = string(method)
+	if err := s.orderRepo.UpdatePayAttempt(order); err != nil {
+		return nil, err
 	}
 
 	return resp, nil
@@ -427,46 +1026,154 @@ func (s *OrderService) PayOrder(orderNo string, method payment.PaymentMethod, cl
 
 // HandlePaymentNotify 处理回调
 func (s *OrderService) HandlePaymentNotify(method payment.PaymentMethod, params map[string]string) error {
-	strategy, err := s.getPaymentStrategy(method)
+	txn := &model.PaymentTransaction{
+		Method: string(method),
+		Action: model.PaymentActionNotify,
+	}
+	if data, err := json.Marshal(params); err == nil {
+		txn.Payload = string(data)
+	}
+
+	err := s.handleNotify(method, params, txn)
+	s.recordTransaction(txn, err)
+	return err
+}
+
+// handleNotify 验证回调并完成订单，验证结果写入 txn
+func (s *OrderService) handleNotify(method payment.PaymentMethod, params map[string]string, txn *model.PaymentTransaction) error {
+	strategy, _, err := s.paymentService.Strategy(method)
 	if err != nil {
 		return err
 	}
 
-	orderNo, _, err := strategy.Verify(params)
+	result, err := strategy.Verify(params)
 	if err != nil {
 		return fmt.Errorf("verify failed: %v", err)
 	}
+	txn.Verified = true
+	txn.OrderNo = result.OrderID
+	txn.Amount = result.Amount
+	txn.Currency = result.Currency
+	txn.TradeNo = result.TradeNo
 
-	order, err := s.orderRepo.GetByOrderNo(orderNo)
+	order, err := s.orderRepo.GetByOrderNo(result.OrderID)
 	if err != nil {
 		return errors.New("订单不存在")
 	}
+	txn.OrderID = order.ID
 
-	if order.Status == model.OrderStatusPaid {
-		return nil // 订单已支付
+	if order.Status == model.OrderStatusPaid || order.Status == model.OrderStatusPaidAfterExpiry {
+		return nil // 订单已支付或已转入审核
 	}
+	if order.Status != model.OrderStatusPending && order.Status != model.OrderStatusCancelled {
+		return errors.New("订单不是待支付状态")
+	}
+
+	// 金额与币种必须与对应支付记录一致，防止部分支付的回调发放完整权益
+	// 多次发起支付时各次手续费可能不同，按回调的交易号或支付方式找到对应的发起记录核对
+	fee := order.Fee
+	if attempt, err := s.txnRepo.GetPayAttempt(order.ID, string(method), result.TradeNo); err == nil {
+		fee = attempt.Fee
+	}
+	expected := order.Paid + fee
+	if !strings.EqualFold(result.Currency, payment.CurrencyCNY) {
+		// 款项已到账，不发放权益，转入人工审核
+		return s.holdPayment(order, method, result.TradeNo,
+			fmt.Sprintf("收到付款币种 %s 与订单不符，待审核", result.Currency))
+	}
+	if payment.ToCents(result.Amount) != payment.ToCents(expected) {
+		return s.holdPayment(order, method, result.TradeNo,
+			fmt.Sprintf("收到付款 %.2f 与应付 %.2f 不符，待审核", result.Amount, expected))
+	}
+
+	// 订单过期或取消后网关才确认付款：不发放权益，转入人工审核
+	if order.Status == model.OrderStatusCancelled || orderExpired(order, time.Now()) {
+		return s.holdPayment(order, method, result.TradeNo, "订单过期后收到付款，待审核")
+	}
+
+	completed, err := s.completePayment(order, model.OrderStatusPending, string(method), result.TradeNo, nil)
+	if err != nil {
+		return err
+	}
+	if !completed {
+		// 并发回调已完成该订单时视为成功，订单在此期间被取消时转入审核
+		latest, err := s.orderRepo.GetByID(order.ID)
+		if err != nil {
+			return err
+		}
+		switch latest.Status {
+		case model.OrderStatusPaid, model.OrderStatusPaidAfterExpiry:
+			return nil
+		case model.OrderStatusCancelled:
+			return s.holdPayment(latest, method, result.TradeNo, "订单过期后收到付款，待审核")
+		}
+		return errors.New("订单不是待支付状态")
+	}
+	return nil
+}
 
+// holdPayment 将需人工核对的付款 (过期或取消后到账、金额或币种不符) 转为待审核状态
+// 不发放权益，释放优惠券占用，由管理员确认发放 (MarkPaid) 或退款
+func (s *OrderService) holdPayment(order *model.Order, method payment.PaymentMethod, tradeNo, reason string) error {
 	now := time.Now()
-	order.Status = model.OrderStatusPaid
-	order.PaidAt = &now
-	order.PayMethod = string(method)
+	remark := appendRemark(order.Remark, reason)
+	updates := map[string]interface{}{
+		"status":          model.OrderStatusPaidAfterExpiry,
+		"paid_at":         now,
+		"pay_method":      string(method),
+		"remark":          remark,
+		"coupon_reserved": false,
+	}
+	if tradeNo != "" {
+		updates["trade_no"] = tradeNo
+	}
 
-	if err := s.orderRepo.Update(order); err != nil {
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.Order{}).
+			Where("id = ? AND status IN ?", order.ID, []int{model.OrderStatusPending, model.OrderStatusCancelled}).
+			Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errOrderNotPending
+		}
+		return releaseCoupon(tx, order)
+	})
+	if errors.Is(err, errOrderNotPending) {
+		// 并发回调已处理
+		latest, err := s.orderRepo.GetByID(order.ID)
+		if err != nil {
+			return err
+		}
+		if latest.Status == model.OrderStatusPaid || latest.Status == model.OrderStatusPaidAfterExpiry {
+			return nil
+		}
+		return errors.New("订单不是待支付状态")
+	}
+	if err != nil {
 		return err
 	}
 
-	// 处理订单完成逻辑
-	return s.processOrderCompletion(order)
+	order.Status = model.OrderStatusPaidAfterExpiry
+	order.PaidAt = &now
+	order.PayMethod = string(method)
+	order.Remark = remark
+	order.CouponReserved = false
+	if tradeNo != "" {
+		order.TradeNo = tradeNo
+	}
+	logger.Log.Warn("Payment held for review", zap.String("order_no", order.OrderNo),
+		zap.String("method", string(method)), zap.String("reason", reason))
+	publishOrderStatus(order)
+	websocket.PushToAdmins(websocket.NewEvent(websocket.EventOrderStatus, order))
+	return nil
 }
 
-func (s *OrderService) getPaymentStrategy(method payment.PaymentMethod) (payment.PaymentStrategy, error) {
-	switch method {
-	case payment.MethodStripe:
-		return stripe.NewStripePay(config.App.Payment.Stripe), nil
-	case payment.MethodAlipay, payment.MethodWeChat:
-		// EPay 通过 PayRequest 中的 'type' 参数处理两种方式，但我们只需初始化一次 EPay 适配器
-		return epay.NewEPay(config.App.Payment.EPay), nil
-	default:
-		return nil, fmt.Errorf("未知的支付方式: %s", method)
+// gatewayFee 按百分比计算网关手续费 (保留两位小数)
+func gatewayFee(amount, percent float64) float64 {
+	if percent <= 0 {
+		return 0
 	}
+	return float64(payment.ToCents(amount*percent/100)) / 100
 }
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"nodepassPanel/internal/model"
+	"nodepassPanel/internal/payment"
+	"time"
+)
+
+// UpgradeRequest 套餐变更请求
+type UpgradeRequest struct {
+	PlanID     uint   `json:"plan_id" form:"plan_id" binding:"required"`
+	Period     string `json:"period" form:"period" binding:"required,oneof=monthly quarterly half_yearly yearly"` // 新套餐计费周期
+	CouponCode string `json:"coupon_code" form:"coupon_code"`                                                     // 优惠券码，抵扣后仍需支付时可用
+}
+
+// UpgradeQuote 套餐变更报价
+// 原套餐剩余价值按剩余时间与剩余流量中较少的比例折算，抵扣新套餐价格；
+// 剩余价值超过新套餐价格 (降级) 时，超出部分按比例延长新套餐的时长与流量
+type UpgradeQuote struct {
+	CurrentPlan       *model.Plan `json:"current_plan"`
+	Plan              *model.Plan `json:"plan"`
+	Period            string      `json:"period"`             // 新套餐计费周期
+	RemainingDays     float64     `json:"remaining_days"`     // 原套餐剩余天数
+	RemainingTransfer int64       `json:"remaining_transfer"` // 原套餐剩余流量 (Bytes)
+	RemainingValue    float64     `json:"remaining_value"`    // 原套餐剩余价值
+	Amount            float64     `json:"amount"`             // 新套餐价格
+	Credit            float64     `json:"credit"`             // 抵扣金额
+	Discount          float64     `json:"discount"`           // 优惠券金额
+	Paid              float64     `json:"paid"`               // 应付金额
+	Days              int         `json:"days"`               // 变更后的有效天数 (从支付时起算)
+	Transfer          int64       `json:"transfer"`           // 变更后的可用流量 (Bytes)
+
+	couponID    *uint
+	resetPolicy string
+}
+
+// QuoteUpgrade 计算变更到指定套餐的价格，供用户支付前预览
+func (s *OrderService) QuoteUpgrade(userID uint, req *UpgradeRequest) (*UpgradeQuote, error) {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	now := time.Now()
+	if user.ExpiredAt == nil || !user.ExpiredAt.After(now) {
+		return nil, errors.New("当前没有生效中的套餐，请直接购买")
+	}
+	current, err := s.orderRepo.GetCurrentPlanOrder(userID)
+	if err != nil {
+		return nil, errors.New("当前没有生效中的套餐，请直接购买")
+	}
+	if *current.PlanID == req.PlanID && current.Period == req.Period {
+		return nil, errors.New("已是该套餐，请直接续费")
+	}
+	currentPlan, err := s.planRepo.GetByID(*current.PlanID)
+	if err != nil {
+		return nil, errors.New("当前套餐已下架，无法变更")
+	}
+	plan, err := s.planRepo.GetByID(req.PlanID)
+	if err != nil {
+		return nil, errors.New("plan not found")
+	}
+	price, err := s.planRepo.GetPrice(plan.ID, req.Period)
+	if err != nil {
+		return nil, errors.New("该套餐不支持此计费周期")
+	}
+
+	quote := &UpgradeQuote{
+		CurrentPlan:       currentPlan,
+		Plan:              plan,
+		Period:            price.Period,
+		RemainingDays:     user.ExpiredAt.Sub(now).Hours() / 24,
+		RemainingTransfer: max(user.TransferEnable-user.Upload-user.Download, 0),
+		Amount:            price.Price,
+		resetPolicy:       price.ResetPolicy,
+	}
+
+	// 剩余比例取时间与流量中消耗更多的一方，价值按原订单实际支付的套餐价格 (含抵扣，不含优惠与退款) 折算
+	// 以原订单发放的时长与流量为基准，未记录的旧订单按套餐当前配置；按月重置流量的套餐只按时间折算
+	grantedDays, grantedTransfer := current.GrantedDays, current.GrantedTransfer
+	if grantedDays <= 0 {
+		grantedDays = currentPlan.Duration
+	}
+	if grantedTransfer <= 0 {
+		grantedTransfer = currentPlan.Transfer * gigabyte
+	}
+	ratio := 0.0
+	if grantedDays > 0 {
+		ratio = quote.RemainingDays / float64(grantedDays)
+	}
+	if grantedTransfer > 0 && current.ResetPolicy != model.TrafficResetMonthly {
+		ratio = math.Min(ratio, float64(quote.RemainingTransfer)/float64(grantedTransfer))
+	}
+	value := max(current.Amount-current.Discount-current.Refunded, 0)
+	quote.RemainingValue = float64(payment.ToCents(value*ratio)) / 100
+
+	amountCents := payment.ToCents(price.Price)
+	creditCents := min(payment.ToCents(quote.RemainingValue), amountCents)
+	surplusCents := payment.ToCents(quote.RemainingValue) - creditCents
+	payableCents := amountCents - creditCents
+	quote.Credit = float64(creditCents) / 100
+
+	// 优惠券只作用于抵扣后的金额
+	if req.CouponCode != "" {
+		if payableCents == 0 {
+			return nil, errors.New("coupon error: 抵扣后无需支付，不能使用优惠券")
+		}
+		coupon, discount, err := s.couponService.VerifyCoupon(req.CouponCode, userID, req.PlanID, req.Period, float64(payableCents)/100)
+		if err != nil {
+			return nil, fmt.Errorf("coupon error: %v", err)
+		}
+		quote.Discount = float64(min(payment.ToCents(discount), payableCents)) / 100
+		couponID := uint(coupon.ID)
+		quote.couponID = &couponID
+	}
+	quote.Paid = float64(payableCents-payment.ToCents(quote.Discount)) / 100
+
+	factor := 1.0
+	if amountCents > 0 {
+		factor += float64(surplusCents) / float64(amountCents)
+	}
+	quote.Days = int(math.Round(float64(price.Duration) * factor))
+	quote.Transfer = int64(float64(plan.Transfer*gigabyte) * factor)
+	return quote, nil
+}
+
+// CreateUpgrade 按报价创建套餐变更订单，支付后替换用户当前套餐
+func (s *OrderService) CreateUpgrade(userID uint, req *UpgradeRequest) (*model.Order, error) {
+	// 报价基于当前套餐状态，有其他待支付的套餐订单时不能变更
+	pending, err := s.orderRepo.HasPending(userID, model.OrderTypePlan, model.OrderTypeUpgrade)
+	if err != nil {
+		return nil, err
+	}
+	if pending {
+		return nil, errors.New("存在待支付的套餐订单，请先支付或取消")
+	}
+
+	quote, err := s.QuoteUpgrade(userID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	expiredAt := time.Now().Add(30 * time.Minute)
+	planID := req.PlanID
+	order := &model.Order{
+		OrderNo:         generateOrderNo(),
+		Type:            model.OrderTypeUpgrade,
+		UserID:          userID,
+		PlanID:          &planID,
+		CouponID:        quote.couponID,
+		Amount:          quote.Amount,
+		Discount:        quote.Discount,
+		Credit:          quote.Credit,
+		Paid:            quote.Paid,
+		GrantedDays:     quote.Days,
+		GrantedTransfer: quote.Transfer,
+		Status:          model.OrderStatusPending,
+		ExpiredAt:       &expiredAt,
+		Remark:          fmt.Sprintf("套餐变更: %s → %s", quote.CurrentPlan.Name, quote.Plan.Name),
+
+		Period:      quote.Period,
+		ResetPolicy: quote.resetPolicy,
+	}
+
+	if err := s.createWithCoupon(order); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
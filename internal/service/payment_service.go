@@ -0,0 +1,292 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nodepassPanel/internal/config"
+	"nodepassPanel/internal/model"
+	"nodepassPanel/internal/payment"
+	"nodepassPanel/internal/repository"
+	"strings"
+
+	// 注册内置支付网关
+	_ "nodepassPanel/internal/payment/epay"
+	_ "nodepassPanel/internal/payment/stripe"
+)
+
+// gatewaySettingPrefix 网关配置在系统设置中的键名前缀
+const gatewaySettingPrefix = "payment_gateway_"
+
+// secretMask 返回给前端的密钥占位符，提交时原样返回表示不修改
+const secretMask = "******"
+
+// PaymentService 支付网关配置服务
+type PaymentService struct {
+	settingRepo *repository.SettingRepository
+}
+
+// NewPaymentService 创建支付网关配置服务实例
+func NewPaymentService() *PaymentService {
+	return &PaymentService{
+		settingRepo: repository.NewSettingRepository(),
+	}
+}
+
+// PaymentMethodInfo 用户可用的支付方式
+type PaymentMethodInfo struct {
+	Method      payment.PaymentMethod `json:"method"`
+	Label       string                `json:"label"`        // 支付方式名称
+	Gateway     string                `json:"gateway"`      // 网关标识
+	DisplayName string                `json:"display_name"` // 网关显示名称
+	FeePercent  float64               `json:"fee_percent"`  // 手续费百分比
+	OrderTypes  []string              `json:"order_types"`  // 允许的订单类型，为空不限制
+}
+
+// GatewayView 管理端网关信息 (密钥已隐藏)
+type GatewayView struct {
+	Name        string                `json:"name"`
+	DisplayName string                `json:"display_name"` // 默认显示名称
+	Methods     []payment.Method      `json:"methods"`
+	Schema      []payment.Field       `json:"schema"`
+	Config      payment.GatewayConfig `json:"config"`
+}
+
+// gatewaySettingKey 网关配置的设置键名
+func gatewaySettingKey(name string) string {
+	return gatewaySettingPrefix + name
+}
+
+// GetGatewayConfig 获取网关配置，未配置时返回未启用的空配置
+func (s *PaymentService) GetGatewayConfig(name string) (*payment.GatewayConfig, error) {
+	cfg := &payment.GatewayConfig{Credentials: map[string]string{}}
+
+	setting, err := s.settingRepo.Get(gatewaySettingKey(name))
+	if err != nil || setting.Value == "" {
+		return cfg, nil
+	}
+	if err := json.Unmarshal([]byte(setting.Value), cfg); err != nil {
+		return nil, fmt.Errorf("invalid %s gateway config: %v", name, err)
+	}
+	if cfg.Credentials == nil {
+		cfg.Credentials = map[string]string{}
+	}
+	return cfg, nil
+}
+
+// saveGatewayConfig 保存网关配置
+func (s *PaymentService) saveGatewayConfig(gateway *payment.Gateway, cfg *payment.GatewayConfig) error {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	return s.settingRepo.Set(gatewaySettingKey(gateway.Name), string(data), "json", model.SettingGroupPayment,
+		gateway.DisplayName+" 支付网关配置")
+}
+
+// InitGatewaySettings 首次启动时将配置文件中的网关配置写入系统设置，之后以系统设置为准
+func (s *PaymentService) InitGatewaySettings() error {
+	legacy := map[string]*payment.GatewayConfig{
+		"stripe": {
+			Enabled: config.App.Payment.Stripe.Enabled,
+			Credentials: map[string]string{
+				"api_key":     config.App.Payment.Stripe.APIKey,
+				"webhook_key": config.App.Payment.Stripe.WebhookKey,
+			},
+		},
+		"epay": {
+			Enabled: config.App.Payment.EPay.Enabled,
+			Credentials: map[string]string{
+				"url": config.App.Payment.EPay.URL,
+				"pid": config.App.Payment.EPay.PID,
+				"key": config.App.Payment.EPay.Key,
+			},
+		},
+	}
+
+	for _, gateway := range payment.Gateways() {
+		if _, err := s.settingRepo.Get(gatewaySettingKey(gateway.Name)); err == nil {
+			continue
+		}
+		cfg, ok := legacy[gateway.Name]
+		if !ok {
+			cfg = &payment.GatewayConfig{Credentials: map[string]string{}}
+		}
+		if err := s.saveGatewayConfig(gateway, cfg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AnyGatewayEnabled 是否启用了任一第三方支付网关
+func (s *PaymentService) AnyGatewayEnabled() bool {
+	for _, gateway := range payment.Gateways() {
+		if cfg, err := s.GetGatewayConfig(gateway.Name); err == nil && cfg.Enabled {
+			return true
+		}
+	}
+	return false
+}
+
+// Strategy 获取支付方式对应的网关策略与配置 (不检查是否启用，回调与退款需处理已停用网关的历史订单)
+func (s *PaymentService) Strategy(method payment.PaymentMethod) (payment.PaymentStrategy, *payment.GatewayConfig, error) {
+	gateway, ok := payment.LookupMethod(method)
+	if !ok {
+		return nil, nil, fmt.Errorf("未知的支付方式: %s", method)
+	}
+	cfg, err := s.GetGatewayConfig(gateway.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return gateway.New(cfg), cfg, nil
+}
+
+// PayStrategy 获取可用于发起支付的网关策略，校验网关已启用且允许该订单类型
+func (s *PaymentService) PayStrategy(method payment.PaymentMethod, orderType string) (payment.PaymentStrategy, *payment.GatewayConfig, error) {
+	strategy, cfg, err := s.Strategy(method)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !cfg.Enabled {
+		return nil, nil, fmt.Errorf("支付方式未启用: %s", method)
+	}
+	// 套餐变更订单按套餐订单校验
+	if orderType == model.OrderTypeUpgrade {
+		orderType = model.OrderTypePlan
+	}
+	if !cfg.AllowsOrderType(orderType) {
+		return nil, nil, fmt.Errorf("该订单不支持此支付方式: %s", method)
+	}
+	return strategy, cfg, nil
+}
+
+// ListMethods 获取用户可用的支付方式，orderType 不为空时只返回允许该类型订单的方式
+func (s *PaymentService) ListMethods(orderType string) []PaymentMethodInfo {
+	if orderType == model.OrderTypeUpgrade {
+		orderType = model.OrderTypePlan
+	}
+	methods := make([]PaymentMethodInfo, 0)
+
+	// 余额支付内置，充值订单不可用
+	if orderType != model.OrderTypeRecharge {
+		methods = append(methods, PaymentMethodInfo{
+			Method:      payment.MethodBalance,
+			Label:       "余额",
+			Gateway:     string(payment.MethodBalance),
+			DisplayName: "余额支付",
+			OrderTypes:  []string{model.OrderTypePlan},
+		})
+	}
+
+	for _, gateway := range payment.Gateways() {
+		cfg, err := s.GetGatewayConfig(gateway.Name)
+		if err != nil || !cfg.Enabled {
+			continue
+		}
+		if orderType != "" && !cfg.AllowsOrderType(orderType) {
+			continue
+		}
+
+		displayName := cfg.DisplayName
+		if displayName == "" {
+			displayName = gateway.DisplayName
+		}
+		for _, m := range gateway.Methods {
+			methods = append(methods, PaymentMethodInfo{
+				Method:      m.Method,
+				Label:       m.Label,
+				Gateway:     gateway.Name,
+				DisplayName: displayName,
+				FeePercent:  cfg.FeePercent,
+				OrderTypes:  cfg.OrderTypes,
+			})
+		}
+	}
+	return methods
+}
+
+// ListGateways 获取所有网关及其配置（管理员）
+func (s *PaymentService) ListGateways() ([]GatewayView, error) {
+	gateways := payment.Gateways()
+	views := make([]GatewayView, 0, len(gateways))
+	for _, gateway := range gateways {
+		cfg, err := s.GetGatewayConfig(gateway.Name)
+		if err != nil {
+			return nil, err
+		}
+		views = append(views, GatewayView{
+			Name:        gateway.Name,
+			DisplayName: gateway.DisplayName,
+			Methods:     gateway.Methods,
+			Schema:      gateway.Schema,
+			Config:      *maskSecrets(gateway, cfg),
+		})
+	}
+	return views, nil
+}
+
+// UpdateGateway 更新网关配置（管理员），密钥为占位符时保留原值
+func (s *PaymentService) UpdateGateway(name string, req *payment.GatewayConfig) error {
+	gateway, ok := payment.Lookup(name)
+	if !ok {
+		return errors.New("gateway not found")
+	}
+	current, err := s.GetGatewayConfig(name)
+	if err != nil {
+		return err
+	}
+
+	cfg := &payment.GatewayConfig{
+		Enabled:     req.Enabled,
+		DisplayName: strings.TrimSpace(req.DisplayName),
+		FeePercent:  req.FeePercent,
+		OrderTypes:  req.OrderTypes,
+		Credentials: map[string]string{},
+	}
+	for _, orderType := range cfg.OrderTypes {
+		if orderType != model.OrderTypePlan && orderType != model.OrderTypeRecharge {
+			return fmt.Errorf("unknown order type: %s", orderType)
+		}
+	}
+	for _, field := range gateway.Schema {
+		value := strings.TrimSpace(req.Credential(field.Key))
+		if field.Type == payment.FieldSecret && value == secretMask {
+			value = current.Credential(field.Key)
+		}
+		cfg.Credentials[field.Key] = value
+	}
+
+	if err := gateway.Validate(cfg); err != nil {
+		return err
+	}
+	return s.saveGatewayConfig(gateway, cfg)
+}
+
+// maskSecrets 隐藏密钥类配置项
+func maskSecrets(gateway *payment.Gateway, cfg *payment.GatewayConfig) *payment.GatewayConfig {
+	masked := *cfg
+	masked.Credentials = make(map[string]string, len(cfg.Credentials))
+	for key, value := range cfg.Credentials {
+		masked.Credentials[key] = value
+	}
+	for _, field := range gateway.Schema {
+		if field.Type == payment.FieldSecret && masked.Credentials[field.Key] != "" {
+			masked.Credentials[field.Key] = secretMask
+		}
+	}
+	return &masked
+}
+
+// validateGatewaySetting 校验直接通过系统设置接口写入的网关配置
+func validateGatewaySetting(key, value string) error {
+	gateway, ok := payment.Lookup(strings.TrimPrefix(key, gatewaySettingPrefix))
+	if !ok {
+		return fmt.Errorf("unknown payment gateway setting: %s", key)
+	}
+	var cfg payment.GatewayConfig
+	if err := json.Unmarshal([]byte(value), &cfg); err != nil {
+		return fmt.Errorf("invalid gateway config: %v", err)
+	}
+	return gateway.Validate(&cfg)
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"errors"
+	"fmt"
 	"nodepassPanel/internal/model"
 	"nodepassPanel/internal/repository"
 )
@@ -18,32 +19,38 @@ func NewPlanService() *PlanService {
 	}
 }
 
+// PlanPriceRequest 计费周期
+type PlanPriceRequest struct {
+	Period      string  `json:"period" binding:"required,oneof=monthly quarterly half_yearly yearly onetime"`
+	Price       float64 `json:"price" binding:"gte=0"`
+	Duration    int     `json:"duration" binding:"gte=0"`                                     // 有效期(天)，流量包为 0
+	ResetPolicy string  `json:"reset_policy" binding:"omitempty,oneof=none purchase monthly"` // 流量重置策略，默认不重置
+}
+
 // CreatePlanRequest 创建套餐请求
 type CreatePlanRequest struct {
-	Name        string  `json:"name" binding:"required"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price" binding:"gte=0"`
-	Duration    int     `json:"duration" binding:"required,gt=0"` // 有效期(天)
-	Transfer    int64   `json:"transfer" binding:"gte=0"`         // 流量限制(GB)
-	SpeedLimit  int     `json:"speed_limit" binding:"gte=0"`      // 速度限制(Mbps)
-	DeviceLimit int     `json:"device_limit" binding:"gte=0"`     // 设备数限制
-	GroupID     int     `json:"group_id"`                         // 用户组
-	Hidden      bool    `json:"hidden"`                           // 是否隐藏
-	Sort        int     `json:"sort"`                             // 排序权重
+	Name        string             `json:"name" binding:"required"`
+	Description string             `json:"description"`
+	Prices      []PlanPriceRequest `json:"prices" binding:"required,min=1,dive"` // 计费周期
+	Transfer    int64              `json:"transfer" binding:"gte=0"`             // 流量限制(GB)
+	SpeedLimit  int                `json:"speed_limit" binding:"gte=0"`          // 速度限制(Mbps)
+	DeviceLimit int                `json:"device_limit" binding:"gte=0"`         // 设备数限制
+	GroupID     int                `json:"group_id"`                             // 用户组
+	Hidden      bool               `json:"hidden"`                               // 是否隐藏
+	Sort        int                `json:"sort"`                                 // 排序权重
 }
 
 // UpdatePlanRequest 更新套餐请求
 type UpdatePlanRequest struct {
-	Name        *string  `json:"name"`
-	Description *string  `json:"description"`
-	Price       *float64 `json:"price" binding:"omitempty,gte=0"`
-	Duration    *int     `json:"duration" binding:"omitempty,gt=0"`
-	Transfer    *int64   `json:"transfer" binding:"omitempty,gte=0"`
-	SpeedLimit  *int     `json:"speed_limit" binding:"omitempty,gte=0"`
-	DeviceLimit *int     `json:"device_limit" binding:"omitempty,gte=0"`
-	GroupID     *int     `json:"group_id"`
-	Hidden      *bool    `json:"hidden"`
-	Sort        *int     `json:"sort"`
+	Name        *string            `json:"name"`
+	Description *string            `json:"description"`
+	Prices      []PlanPriceRequest `json:"prices" binding:"omitempty,min=1,dive"` // 不为空时替换全部计费周期
+	Transfer    *int64             `json:"transfer" binding:"omitempty,gte=0"`
+	SpeedLimit  *int               `json:"speed_limit" binding:"omitempty,gte=0"`
+	DeviceLimit *int               `json:"device_limit" binding:"omitempty,gte=0"`
+	GroupID     *int               `json:"group_id"`
+	Hidden      *bool              `json:"hidden"`
+	Sort        *int               `json:"sort"`
 }
 
 // PlanResponse 套餐响应
@@ -63,11 +70,15 @@ type PlanResponse struct {
 
 // Create 创建套餐
 func (s *PlanService) Create(req *CreatePlanRequest) (*model.Plan, error) {
+	prices, err := buildPrices(req.Prices)
+	if err != nil {
+		return nil, err
+	}
+
 	plan := &model.Plan{
 		Name:        req.Name,
 		Description: req.Description,
-		Price:       req.Price,
-		Duration:    req.Duration,
+		Prices:      prices,
 		Transfer:    req.Transfer,
 		SpeedLimit:  req.SpeedLimit,
 		DeviceLimit: req.DeviceLimit,
@@ -75,6 +86,7 @@ func (s *PlanService) Create(req *CreatePlanRequest) (*model.Plan, error) {
 		Hidden:      req.Hidden,
 		Sort:        req.Sort,
 	}
+	syncBasePrice(plan)
 
 	if err := s.planRepo.Create(plan); err != nil {
 		return nil, err
@@ -112,12 +124,6 @@ func (s *PlanService) Update(id uint, req *UpdatePlanRequest) (*model.Plan, erro
 	if req.Description != nil {
 		plan.Description = *req.Description
 	}
-	if req.Price != nil {
-		plan.Price = *req.Price
-	}
-	if req.Duration != nil {
-		plan.Duration = *req.Duration
-	}
 	if req.Transfer != nil {
 		plan.Transfer = *req.Transfer
 	}
@@ -137,13 +143,102 @@ func (s *PlanService) Update(id uint, req *UpdatePlanRequest) (*model.Plan, erro
 		plan.Sort = *req.Sort
 	}
 
-	if err := s.planRepo.Update(plan); err != nil {
+	var prices []model.PlanPrice
+	if req.Prices != nil {
+		if prices, err = buildPrices(req.Prices); err != nil {
+			return nil, err
+		}
+		plan.Prices = prices
+		syncBasePrice(plan)
+	}
+
+	if err := s.planRepo.Update(plan, prices); err != nil {
 		return nil, err
 	}
 
 	return plan, nil
 }
 
+// InitPlanPrices 为没有计费周期的套餐按原价格与有效期创建计费周期
+func (s *PlanService) InitPlanPrices() error {
+	plans, err := s.planRepo.GetWithoutPrices()
+	if err != nil || len(plans) == 0 {
+		return err
+	}
+
+	prices := make([]model.PlanPrice, 0, len(plans))
+	for _, plan := range plans {
+		prices = append(prices, model.PlanPrice{
+			PlanID:      plan.ID,
+			Period:      periodForDuration(plan.Duration),
+			Price:       plan.Price,
+			Duration:    plan.Duration,
+			ResetPolicy: model.TrafficResetNone,
+		})
+	}
+	return s.planRepo.CreatePrices(prices)
+}
+
+// buildPrices 校验计费周期：周期不能重复，流量包有效期为 0 且不重置流量，其余周期有效期必须大于 0
+func buildPrices(reqs []PlanPriceRequest) ([]model.PlanPrice, error) {
+	seen := make(map[string]bool, len(reqs))
+	prices := make([]model.PlanPrice, 0, len(reqs))
+	for _, req := range reqs {
+		if seen[req.Period] {
+			return nil, fmt.Errorf("计费周期重复: %s", req.Period)
+		}
+		seen[req.Period] = true
+
+		policy := req.ResetPolicy
+		if policy == "" {
+			policy = model.TrafficResetNone
+		}
+		if req.Period == model.PeriodOnetime {
+			if req.Duration != 0 || policy != model.TrafficResetNone {
+				return nil, errors.New("流量包不能设置有效期与流量重置")
+			}
+		} else if req.Duration <= 0 {
+			return nil, fmt.Errorf("计费周期 %s 的有效期必须大于 0", req.Period)
+		}
+
+		prices = append(prices, model.PlanPrice{
+			Period:      req.Period,
+			Price:       req.Price,
+			Duration:    req.Duration,
+			ResetPolicy: policy,
+		})
+	}
+	return prices, nil
+}
+
+// syncBasePrice 以有效期最短的周期作为套餐起价，只有流量包时取流量包价格
+func syncBasePrice(plan *model.Plan) {
+	var base *model.PlanPrice
+	for i := range plan.Prices {
+		price := &plan.Prices[i]
+		if base == nil || (price.Duration > 0 && (base.Duration == 0 || price.Duration < base.Duration)) {
+			base = price
+		}
+	}
+	if base != nil {
+		plan.Price = base.Price
+		plan.Duration = base.Duration
+	}
+}
+
+// periodForDuration 按有效期推断计费周期
+func periodForDuration(days int) string {
+	switch days {
+	case 90:
+		return model.PeriodQuarterly
+	case 180:
+		return model.PeriodHalfYearly
+	case 365:
+		return model.PeriodYearly
+	}
+	return model.PeriodMonthly
+}
+
 // Delete 删除套餐
 func (s *PlanService) Delete(id uint) error {
 	if !s.planRepo.ExistsByID(id) {
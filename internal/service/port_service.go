@@ -0,0 +1,311 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"nodepassPanel/internal/global"
+	"nodepassPanel/internal/model"
+	"nodepassPanel/internal/repository"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// maxAllocateAttempts 自动分配端口时遇到并发冲突的最大重试次数
+const maxAllocateAttempts = 5
+
+// ErrNoFreePort 节点端口已分配完
+var ErrNoFreePort = errors.New("节点没有可用端口")
+
+// PortService 端口分配服务
+type PortService struct {
+	instanceRepo *repository.InstanceRepository
+	nodeRepo     *repository.NodeRepository
+}
+
+// NewPortService 创建端口分配服务实例
+func NewPortService() *PortService {
+	return &PortService{
+		instanceRepo: repository.NewInstanceRepository(),
+		nodeRepo:     repository.NewNodeRepository(),
+	}
+}
+
+// PortUsage 节点端口使用情况
+type PortUsage struct {
+	NodeID         uint  `json:"node_id"`
+	RangeStart     int   `json:"range_start"`
+	RangeEnd       int   `json:"range_end"`
+	Reserved       []int `json:"reserved"`        // 保留端口
+	Allocated      []int `json:"allocated"`       // 面板已分配的端口
+	RemoteUsed     []int `json:"remote_used"`     // 节点上报正在使用的端口
+	Foreign        []int `json:"foreign"`         // 节点上存在但面板未记录的端口
+	Missing        []int `json:"missing"`         // 面板已分配但节点上不存在的端口
+	Free           int   `json:"free"`            // 剩余可分配数量
+	RemoteReported bool  `json:"remote_reported"` // 是否成功获取节点上报
+}
+
+// AllocateAndCreate 为实例分配端口并在同一事务中落库
+// requested > 0 时校验并使用指定端口，否则自动挑选空闲端口
+// 依赖 (node_id, server_port) 唯一索引保证并发安全，SQLite 与 Postgres 行为一致
+func (s *PortService) AllocateAndCreate(node *model.Node, instance *model.Instance, requested int) error {
+	remoteUsed, _ := s.remoteUsedPorts(node)
+
+	if requested > 0 {
+		if err := s.validate(node, requested, remoteUsed); err != nil {
+			return err
+		}
+		instance.ServerPort = requested
+		err := s.insert(instance)
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return fmt.Errorf("端口 %d 已被占用", requested)
+		}
+		return err
+	}
+
+	return s.allocateFree(node, instance, remoteUsed, s.insert)
+}
+
+// AllocateAndMove 将已有实例迁移到另一节点并分配端口 (故障迁移/迁回)
+// preferred > 0 时优先尝试该端口，不可用则自动挑选；失败时 instance 的 NodeID/ServerPort 已被修改，调用方需自行恢复
+func (s *PortService) AllocateAndMove(node *model.Node, instance *model.Instance, preferred int) error {
+	remoteUsed, _ := s.remoteUsedPorts(node)
+	instance.NodeID = node.ID
+
+	if preferred > 0 && s.validate(node, preferred, remoteUsed) == nil {
+		instance.ServerPort = preferred
+		err := s.save(instance)
+		if err == nil || !errors.Is(err, gorm.ErrDuplicatedKey) {
+			return err
+		}
+	}
+
+	return s.allocateFree(node, instance, remoteUsed, s.save)
+}
+
+// Validate 校验指定端口是否可用于节点 (excludeID 用于排除实例自身)
+func (s *PortService) Validate(node *model.Node, port int, excludeID uint) error {
+	if !inPortRange(node, port) {
+		return fmt.Errorf("端口 %d 不在节点允许范围 %d-%d 内", port, node.PortRangeStart, node.PortRangeEnd)
+	}
+	if reserved := parsePortList(node.ReservedPorts); reserved[port] || port == node.APIPort {
+		return fmt.Errorf("端口 %d 为保留端口", port)
+	}
+	if s.instanceRepo.PortInUse(node.ID, port, excludeID) {
+		return fmt.Errorf("端口 %d 已被占用", port)
+	}
+	return nil
+}
+
+// GetUsage 获取节点端口使用情况并与节点上报对账
+func (s *PortService) GetUsage(nodeID uint) (*PortUsage, error) {
+	node, err := s.nodeRepo.GetByID(nodeID)
+	if err != nil {
+		return nil, errors.New("node not found")
+	}
+
+	allocated, err := s.instanceRepo.GetUsedPorts(node.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &PortUsage{
+		NodeID:     node.ID,
+		RangeStart: node.PortRangeStart,
+		RangeEnd:   node.PortRangeEnd,
+		Reserved:   sortedPorts(parsePortList(node.ReservedPorts)),
+		Allocated:  allocated,
+		RemoteUsed: []int{},
+		Foreign:    []int{},
+		Missing:    []int{},
+	}
+	sort.Ints(usage.Allocated)
+
+	allocatedSet := make(map[int]bool, len(allocated))
+	for _, port := range allocated {
+		allocatedSet[port] = true
+	}
+
+	remoteUsed, err := s.remoteUsedPorts(node)
+	if err == nil {
+		usage.RemoteReported = true
+		usage.RemoteUsed = sortedPorts(remoteUsed)
+		for _, port := range usage.RemoteUsed {
+			if !allocatedSet[port] {
+				usage.Foreign = append(usage.Foreign, port)
+			}
+		}
+		for _, port := range usage.Allocated {
+			if !remoteUsed[port] {
+				usage.Missing = append(usage.Missing, port)
+			}
+		}
+	}
+
+	usage.Free = len(s.freePorts(node, allocatedSet, remoteUsed))
+	return usage, nil
+}
+
+// validate 校验指定端口，并额外检查节点上报的占用
+func (s *PortService) validate(node *model.Node, port int, remoteUsed map[int]bool) error {
+	if err := s.Validate(node, port, 0); err != nil {
+		return err
+	}
+	if remoteUsed[port] {
+		return fmt.Errorf("端口 %d 在节点上已被占用", port)
+	}
+	return nil
+}
+
+// pickFree 随机挑选一个空闲端口，降低并发请求间的冲突概率
+func (s *PortService) pickFree(node *model.Node, remoteUsed map[int]bool) (int, error) {
+	allocated, err := s.instanceRepo.GetUsedPorts(node.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	used := make(map[int]bool, len(allocated))
+	for _, port := range allocated {
+		used[port] = true
+	}
+
+	free := s.freePorts(node, used, remoteUsed)
+	if len(free) == 0 {
+		return 0, ErrNoFreePort
+	}
+	return free[rand.Intn(len(free))], nil
+}
+
+// freePorts 计算节点上所有可分配的端口
+func (s *PortService) freePorts(node *model.Node, allocated, remoteUsed map[int]bool) []int {
+	reserved := parsePortList(node.ReservedPorts)
+
+	free := make([]int, 0)
+	for port := node.PortRangeStart; port <= node.PortRangeEnd; port++ {
+		if port < 1 || port > 65535 {
+			continue
+		}
+		// Master API 端口不可分配
+		if reserved[port] || allocated[port] || remoteUsed[port] || port == node.APIPort {
+			continue
+		}
+		free = append(free, port)
+	}
+	return free
+}
+
+// allocateFree 自动挑选空闲端口并持久化，遇到唯一索引冲突时重新挑选
+func (s *PortService) allocateFree(node *model.Node, instance *model.Instance, remoteUsed map[int]bool, persist func(*model.Instance) error) error {
+	for attempt := 0; attempt < maxAllocateAttempts; attempt++ {
+		port, err := s.pickFree(node, remoteUsed)
+		if err != nil {
+			return err
+		}
+
+		instance.ServerPort = port
+		err = persist(instance)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrDuplicatedKey) {
+			return err
+		}
+		// 被并发请求抢占，重新挑选
+	}
+
+	return errors.New("端口分配冲突，请稍后重试")
+}
+
+// insert 在事务中创建实例
+func (s *PortService) insert(instance *model.Instance) error {
+	return global.DB.Transaction(func(tx *gorm.DB) error {
+		return tx.Create(instance).Error
+	})
+}
+
+// save 保存实例，不回写并发采集的流量计数
+func (s *PortService) save(instance *model.Instance) error {
+	return s.instanceRepo.Update(instance)
+}
+
+// remoteUsedPorts 获取节点上报的正在使用的端口
+func (s *PortService) remoteUsedPorts(node *model.Node) (map[int]bool, error) {
+	remotes, err := newNodeClient(node).ListInstances()
+	if err != nil {
+		return map[int]bool{}, err
+	}
+
+	used := make(map[int]bool, len(remotes))
+	for _, remote := range remotes {
+		if port := remote.TunnelPort(); port > 0 {
+			used[port] = true
+		}
+	}
+	return used, nil
+}
+
+// inPortRange 检查端口是否在节点允许范围内
+func inPortRange(node *model.Node, port int) bool {
+	return port >= node.PortRangeStart && port <= node.PortRangeEnd && port >= 1 && port <= 65535
+}
+
+// parsePortList 解析端口列表，支持 "22,80,8000-8100" 格式
+func parsePortList(value string) map[int]bool {
+	ports := make(map[int]bool)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		if from, to, ok := strings.Cut(part, "-"); ok {
+			start, err1 := strconv.Atoi(strings.TrimSpace(from))
+			end, err2 := strconv.Atoi(strings.TrimSpace(to))
+			if err1 != nil || err2 != nil || start > end {
+				continue
+			}
+			for port := start; port <= end && port <= 65535; port++ {
+				ports[port] = true
+			}
+			continue
+		}
+
+		if port, err := strconv.Atoi(part); err == nil {
+			ports[port] = true
+		}
+	}
+	return ports
+}
+
+// validatePortList 校验端口列表格式
+func validatePortList(value string) error {
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, isRange := strings.Cut(part, "-")
+		if !isRange {
+			to = from
+		}
+		start, err1 := strconv.Atoi(strings.TrimSpace(from))
+		end, err2 := strconv.Atoi(strings.TrimSpace(to))
+		if err1 != nil || err2 != nil || start < 1 || end > 65535 || start > end {
+			return fmt.Errorf("无效的端口配置: %s", part)
+		}
+	}
+	return nil
+}
+
+// sortedPorts 将端口集合转换为有序切片
+func sortedPorts(set map[int]bool) []int {
+	ports := make([]int, 0, len(set))
+	for port := range set {
+		ports = append(ports, port)
+	}
+	sort.Ints(ports)
+	return ports
+}
@@ -1,8 +1,11 @@
 package service
 
 import (
+	"errors"
 	"nodepassPanel/internal/model"
 	"nodepassPanel/internal/repository"
+	"strconv"
+	"strings"
 )
 
 // SettingService 系统设置服务层
@@ -66,14 +69,42 @@ func (s *SettingService) GetPublic() (map[string]string, error) {
 
 // Set 设置单个值
 func (s *SettingService) Set(key, value string) error {
+	if err := validateSetting(key, value); err != nil {
+		return err
+	}
 	return s.settingRepo.Set(key, value, "string", "", "")
 }
 
 // SetWithMeta 设置值（带元数据）
 func (s *SettingService) SetWithMeta(item SettingItem) error {
+	if err := validateSetting(item.Key, item.Value); err != nil {
+		return err
+	}
 	return s.settingRepo.Set(item.Key, item.Value, item.Type, item.Group, item.Desc)
 }
 
+// validateSetting 校验有格式要求的设置项
+func validateSetting(key, value string) error {
+	if value == "" {
+		return nil
+	}
+	if strings.HasPrefix(key, gatewaySettingPrefix) {
+		return validateGatewaySetting(key, value)
+	}
+	switch key {
+	case model.SettingKeySiteURL:
+		_, err := normalizeBaseURL(value)
+		return err
+	case model.SettingKeyPaymentReturnPath:
+		return validateReturnPath(value)
+	case model.SettingKeyAutoRenewDays:
+		if days, err := strconv.Atoi(value); err != nil || days < 1 || days > 30 {
+			return errors.New("自动续费天数必须在 1-30 之间")
+		}
+	}
+	return nil
+}
+
 // BatchUpdate 批量更新设置
 func (s *SettingService) BatchUpdate(req *BatchUpdateRequest) error {
 	for _, item := range req.Settings {
@@ -95,6 +126,7 @@ func (s *SettingService) InitDefaultSettings() error {
 		{Key: model.SettingKeySiteName, Value: "NyanPass", Type: "string", Group: model.SettingGroupSite, Desc: "站点名称"},
 		{Key: model.SettingKeySiteDescription, Value: "高性能中转面板", Type: "string", Group: model.SettingGroupSite, Desc: "站点描述"},
 		{Key: model.SettingKeySiteLogo, Value: "", Type: "string", Group: model.SettingGroupSite, Desc: "站点 Logo URL"},
+		{Key: model.SettingKeySiteURL, Value: "", Type: "string", Group: model.SettingGroupSite, Desc: "站点对外访问地址 (为空使用配置文件)"},
 		{Key: model.SettingKeyContactTelegram, Value: "", Type: "string", Group: model.SettingGroupSite, Desc: "客服 Telegram"},
 
 		{Key: model.SettingKeyRegisterEnabled, Value: "true", Type: "bool", Group: model.SettingGroupSite, Desc: "是否开放注册"},
@@ -102,6 +134,8 @@ func (s *SettingService) InitDefaultSettings() error {
 		{Key: model.SettingKeyInviteRewardDays, Value: "7", Type: "int", Group: model.SettingGroupInvite, Desc: "邀请奖励天数"},
 
 		{Key: model.SettingKeyPaymentEnabled, Value: "true", Type: "bool", Group: model.SettingGroupPayment, Desc: "是否开放支付"},
+		{Key: model.SettingKeyPaymentReturnPath, Value: "", Type: "string", Group: model.SettingGroupPayment, Desc: "支付完成跳转路径，支持 {order_no}、{status} (为空使用配置文件)"},
+		{Key: model.SettingKeyAutoRenewDays, Value: "3", Type: "int", Group: model.SettingGroupPayment, Desc: "到期前多少天自动续费 (1-30)"},
 
 		// 邮件设置
 		{Key: model.SettingKeyMailHost, Value: "smtp.example.com", Type: "string", Group: model.SettingGroupMail, Desc: "SMTP 服务器地址"},
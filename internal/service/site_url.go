@@ -0,0 +1,109 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"nodepassPanel/internal/config"
+	"nodepassPanel/internal/model"
+	"nodepassPanel/internal/payment"
+	"strings"
+)
+
+// defaultReturnPath 未配置时支付完成后跳转的前端路径
+const defaultReturnPath = "/user/orders?order_no={order_no}&status={status}"
+
+// 支付跳转状态，对应 ReturnPath 中的 {status}
+const (
+	ReturnStatusSuccess = "success" // 完成支付后返回 (是否到账以订单状态为准)
+	ReturnStatusCancel  = "cancel"  // 取消支付
+)
+
+// errSiteURLNotConfigured 配置文件与系统设置均未配置站点地址
+var errSiteURLNotConfigured = errors.New("site base url is not configured (site.base_url or setting site_url)")
+
+// SiteURLs 站点对外地址，用于生成支付回调与跳转地址
+type SiteURLs struct {
+	BaseURL    string `json:"base_url"`
+	ReturnPath string `json:"return_path"`
+}
+
+// SiteURLs 获取生效的站点地址：系统设置优先，其次为配置文件
+func (s *SettingService) SiteURLs() (*SiteURLs, error) {
+	baseURL := config.App.Site.BaseURL
+	if value, err := s.Get(model.SettingKeySiteURL); err == nil && value != "" {
+		baseURL = value
+	}
+	returnPath := config.App.Site.ReturnPath
+	if value, err := s.Get(model.SettingKeyPaymentReturnPath); err == nil && value != "" {
+		returnPath = value
+	}
+	if returnPath == "" {
+		returnPath = defaultReturnPath
+	}
+
+	if baseURL == "" {
+		return nil, errSiteURLNotConfigured
+	}
+	normalized, err := normalizeBaseURL(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateReturnPath(returnPath); err != nil {
+		return nil, err
+	}
+	return &SiteURLs{BaseURL: normalized, ReturnPath: returnPath}, nil
+}
+
+// ValidateSiteURLs 启动时校验站点地址，启用了第三方支付时必须配置
+func (s *SettingService) ValidateSiteURLs() error {
+	_, err := s.SiteURLs()
+	if errors.Is(err, errSiteURLNotConfigured) && !NewPaymentService().AnyGatewayEnabled() {
+		// 仅使用余额支付时不需要回调地址
+		return nil
+	}
+	return err
+}
+
+// NotifyURL 支付网关异步回调地址，method 对应 /payment/notify/:method
+func (u *SiteURLs) NotifyURL(method payment.PaymentMethod) string {
+	return u.BaseURL + "/api/v1/payment/notify/" + url.PathEscape(string(method))
+}
+
+// ReturnURL 支付完成或取消后跳转的前端地址
+func (u *SiteURLs) ReturnURL(orderNo, status string) string {
+	path := strings.NewReplacer(
+		"{order_no}", url.QueryEscape(orderNo),
+		"{status}", url.QueryEscape(status),
+	).Replace(u.ReturnPath)
+	return u.BaseURL + path
+}
+
+// normalizeBaseURL 校验站点地址为不带路径参数的 http(s) 绝对地址，并去掉末尾斜杠
+func normalizeBaseURL(raw string) (string, error) {
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", fmt.Errorf("invalid site url: %v", err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return "", errors.New("site url must start with http:// or https://")
+	}
+	if parsed.Host == "" {
+		return "", errors.New("site url must contain a host")
+	}
+	if parsed.RawQuery != "" || parsed.Fragment != "" {
+		return "", errors.New("site url must not contain query or fragment")
+	}
+	return strings.TrimRight(parsed.String(), "/"), nil
+}
+
+// validateReturnPath 校验跳转路径模板为站内路径
+func validateReturnPath(path string) error {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") {
+		return errors.New("return path must start with a single /")
+	}
+	if _, err := url.Parse(strings.NewReplacer("{order_no}", "x", "{status}", "x").Replace(path)); err != nil {
+		return fmt.Errorf("invalid return path: %v", err)
+	}
+	return nil
+}
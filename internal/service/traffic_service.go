@@ -0,0 +1,216 @@
+package service
+
+import (
+	"nodepassPanel/internal/model"
+	"nodepassPanel/internal/repository"
+	"nodepassPanel/internal/websocket"
+	"nodepassPanel/pkg/logger"
+	"nodepassPanel/pkg/nodepass"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// trafficWarningRatios 用量跨过这些比例时向用户推送流量预警
+var trafficWarningRatios = []float64{0.8, 0.95}
+
+// TrafficWarning 流量预警推送内容
+type TrafficWarning struct {
+	Used  int64   `json:"used"`  // 已用流量 (Bytes)
+	Total int64   `json:"total"` // 总流量 (Bytes)
+	Ratio float64 `json:"ratio"` // 触发的预警比例
+}
+
+// InstanceTraffic 规则流量推送内容
+type InstanceTraffic struct {
+	InstanceID uint  `json:"instance_id"`
+	Upload     int64 `json:"upload"`
+	Download   int64 `json:"download"`
+}
+
+// TrafficService 流量采集服务
+type TrafficService struct {
+	nodeRepo     *repository.NodeRepository
+	instanceRepo *repository.InstanceRepository
+	userRepo     *repository.UserRepository
+	orderRepo    *repository.OrderRepository
+	enforcement  *EnforcementService
+}
+
+// NewTrafficService 创建流量采集服务实例
+func NewTrafficService() *TrafficService {
+	return &TrafficService{
+		nodeRepo:     repository.NewNodeRepository(),
+		instanceRepo: repository.NewInstanceRepository(),
+		userRepo:     repository.NewUserRepository(),
+		orderRepo:    repository.NewOrderRepository(),
+		enforcement:  NewEnforcementService(),
+	}
+}
+
+// CollectAll 从所有节点拉取实例流量计数并累加到用户
+func (s *TrafficService) CollectAll() {
+	nodes, err := s.nodeRepo.GetAll()
+	if err != nil {
+		logger.Log.Error("流量采集: 获取节点失败", zap.Error(err))
+		return
+	}
+
+	for i := range nodes {
+		if err := s.CollectNode(&nodes[i]); err != nil {
+			logger.Log.Warn("流量采集: 节点采集失败",
+				zap.Uint("node_id", nodes[i].ID), zap.Error(err))
+		}
+	}
+}
+
+// CollectNode 采集单个节点的实例流量
+func (s *TrafficService) CollectNode(node *model.Node) error {
+	instances, err := s.instanceRepo.GetByNodeID(node.ID)
+	if err != nil {
+		return err
+	}
+	if len(instances) == 0 {
+		return nil
+	}
+
+	remotes, err := newNodeClient(node).ListInstances()
+	if err != nil {
+		return err
+	}
+
+	remoteByID := make(map[string]*nodepass.Instance, len(remotes))
+	for i := range remotes {
+		remoteByID[remotes[i].ID] = &remotes[i]
+	}
+
+	userDelta := make(map[uint]int64)
+	userTraffic := make(map[uint][]InstanceTraffic)
+	for i := range instances {
+		instance := &instances[i]
+		remote, ok := remoteByID[instance.NodePassID]
+		if instance.NodePassID == "" || !ok {
+			continue
+		}
+
+		// rx 为节点从用户侧接收的数据 (上传)，tx 为发回用户侧的数据 (下载)
+		rx := remote.TCPRx + remote.UDPRx
+		tx := remote.TCPTx + remote.UDPTx
+
+		if rx == instance.LastRx && tx == instance.LastTx {
+			continue
+		}
+
+		upload := applyRate(counterDelta(instance.LastRx, rx), node.Rate)
+		download := applyRate(counterDelta(instance.LastTx, tx), node.Rate)
+
+		applied, err := s.instanceRepo.RecordTraffic(instance, rx, tx, upload, download)
+		if err != nil {
+			logger.Log.Error("流量采集: 写入失败",
+				zap.Uint("instance_id", instance.ID), zap.Error(err))
+			continue
+		}
+		if !applied {
+			logger.Log.Debug("流量采集: 快照已被更新，跳过",
+				zap.Uint("instance_id", instance.ID))
+			continue
+		}
+		userDelta[instance.UserID] += upload + download
+		userTraffic[instance.UserID] = append(userTraffic[instance.UserID], InstanceTraffic{
+			InstanceID: instance.ID,
+			Upload:     instance.Upload + upload,
+			Download:   instance.Download + download,
+		})
+	}
+
+	for userID, delta := range userDelta {
+		s.warnIfCrossed(userID, delta)
+	}
+	for userID, traffic := range userTraffic {
+		websocket.Publish(websocket.InstancesRoom(userID), websocket.NewEvent(websocket.EventInstanceTraffic, traffic))
+	}
+
+	return nil
+}
+
+// ResetMonthly 按月重置流量：到达重置时间的用户清零已用流量，额度恢复为当前套餐发放的流量
+func (s *TrafficService) ResetMonthly() {
+	now := time.Now()
+	users, err := s.userRepo.GetTrafficResetDue(now)
+	if err != nil {
+		logger.Log.Error("流量重置: 获取用户失败", zap.Error(err))
+		return
+	}
+
+	for i := range users {
+		user := &users[i]
+		order, err := s.orderRepo.GetCurrentPlanOrder(user.ID)
+		if err != nil {
+			logger.Log.Warn("流量重置: 获取当前套餐失败", zap.Uint("user_id", user.ID), zap.Error(err))
+			continue
+		}
+
+		// 错过的周期不补发，下次重置时间顺延到当前时间之后；超过套餐到期时间则不再重置
+		resetAt := *user.TrafficResetAt
+		next := resetAt
+		for !next.After(now) {
+			next = next.AddDate(0, 1, 0)
+		}
+		nextReset := &next
+		if user.ExpiredAt == nil || !user.ExpiredAt.After(next) {
+			nextReset = nil
+		}
+
+		applied, err := s.userRepo.ResetMonthlyTraffic(user.ID, resetAt, order.GrantedTransfer, nextReset)
+		if err != nil {
+			logger.Log.Error("流量重置: 写入失败", zap.Uint("user_id", user.ID), zap.Error(err))
+			continue
+		}
+		if applied {
+			go s.enforcement.ResumeIfCompliant(user.ID, model.InstanceReasonRestored)
+		}
+	}
+}
+
+// warnIfCrossed 本次采集使用户用量跨过预警比例时推送预警
+func (s *TrafficService) warnIfCrossed(userID uint, delta int64) {
+	if delta <= 0 {
+		return
+	}
+
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil || user.TransferEnable <= 0 {
+		return
+	}
+
+	used := user.Upload + user.Download
+	before := used - delta
+	for i := len(trafficWarningRatios) - 1; i >= 0; i-- {
+		limit := int64(float64(user.TransferEnable) * trafficWarningRatios[i])
+		if before < limit && used >= limit {
+			websocket.PushToUser(userID, websocket.NewEvent(websocket.EventTrafficWarning, &TrafficWarning{
+				Used:  used,
+				Total: user.TransferEnable,
+				Ratio: trafficWarningRatios[i],
+			}))
+			return
+		}
+	}
+}
+
+// counterDelta 计算计数器增量
+// 当前值小于上次值说明节点重启导致计数归零，此时增量即为当前值
+func counterDelta(last, current int64) int64 {
+	if current < last {
+		return current
+	}
+	return current - last
+}
+
+// applyRate 按节点倍率折算流量
+func applyRate(bytes int64, rate float64) int64 {
+	if bytes <= 0 || rate < 0 {
+		return 0
+	}
+	return int64(float64(bytes) * rate)
+}
@@ -2,21 +2,26 @@ package service
 
 import (
 	"errors"
+	"nodepassPanel/internal/global"
 	"nodepassPanel/internal/model"
 	"nodepassPanel/internal/repository"
 	"nodepassPanel/pkg/utils"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // UserService 用户服务层
 type UserService struct {
-	userRepo *repository.UserRepository
+	userRepo    *repository.UserRepository
+	enforcement *EnforcementService
 }
 
 // NewUserService 创建用户服务实例
 func NewUserService() *UserService {
 	return &UserService{
-		userRepo: repository.NewUserRepository(),
+		userRepo:    repository.NewUserRepository(),
+		enforcement: NewEnforcementService(),
 	}
 }
 
@@ -194,7 +199,8 @@ func (s *UserService) GetUserByID(id uint) (*model.User, error) {
 }
 
 // UpdateUser 更新用户（管理员）
-func (s *UserService) UpdateUser(id uint, req *AdminUpdateUserRequest) (*model.User, error) {
+// 余额与佣金的修改按差额记入资金流水
+func (s *UserService) UpdateUser(id uint, req *AdminUpdateUserRequest, adminID uint) (*model.User, error) {
 	user, err := s.userRepo.GetByID(id)
 	if err != nil {
 		return nil, errors.New("user not found")
@@ -211,11 +217,12 @@ func (s *UserService) UpdateUser(id uint, req *AdminUpdateUserRequest) (*model.U
 		}
 		user.Password = hashedPwd
 	}
-	if req.Balance != nil {
-		user.Balance = *req.Balance
+	adjustments := map[string]float64{}
+	if req.Balance != nil && *req.Balance != user.Balance {
+		adjustments[model.AccountBalance] = *req.Balance - user.Balance
 	}
-	if req.Commission != nil {
-		user.Commission = *req.Commission
+	if req.Commission != nil && *req.Commission != user.Commission {
+		adjustments[model.AccountCommission] = *req.Commission - user.Commission
 	}
 	if req.Upload != nil {
 		user.Upload = *req.Upload
@@ -239,7 +246,41 @@ func (s *UserService) UpdateUser(id uint, req *AdminUpdateUserRequest) (*model.U
 		user.ExpiredAt = req.ExpiredAt
 	}
 
-	if err := s.userRepo.Update(user); err != nil {
+	// 未修改的流量计数不回写，避免覆盖采集任务在读取之后累加的流量
+	omit := []string{"balance", "commission"}
+	if req.Upload == nil {
+		omit = append(omit, "upload")
+	}
+	if req.Download == nil {
+		omit = append(omit, "download")
+	}
+
+	err = global.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(omit...).Save(user).Error; err != nil {
+			return err
+		}
+		for account, amount := range adjustments {
+			log, err := postLedger(tx, &LedgerEntry{
+				UserID:  user.ID,
+				Account: account,
+				Counter: model.AccountSystemAdjustment,
+				Type:    model.BalanceTypeAdminAdjust,
+				Amount:  amount,
+				AdminID: adminID,
+				Memo:    "管理员修改",
+			})
+			if err != nil {
+				return err
+			}
+			if account == model.AccountBalance {
+				user.Balance = log.BalanceAfter
+			} else {
+				user.Commission = log.BalanceAfter
+			}
+		}
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -257,27 +298,26 @@ func (s *UserService) DeleteUser(id uint) error {
 
 // ResetTraffic 重置用户流量（管理员）
 func (s *UserService) ResetTraffic(id uint) error {
-	user, err := s.userRepo.GetByID(id)
-	if err != nil {
+	if _, err := s.userRepo.GetByID(id); err != nil {
 		return errors.New("user not found")
 	}
-
-	user.Upload = 0
-	user.Download = 0
-
-	return s.userRepo.Update(user)
+	return s.userRepo.ResetTraffic(id)
 }
 
-// ChargeUser 给用户充值（管理员）
-func (s *UserService) ChargeUser(id uint, amount float64) error {
-	user, err := s.userRepo.GetByID(id)
-	if err != nil {
-		return errors.New("user not found")
-	}
-
-	user.Balance += amount
-
-	return s.userRepo.Update(user)
+// ChargeUser 给用户充值（管理员），金额为负时扣减余额
+func (s *UserService) ChargeUser(id uint, amount float64, adminID uint) error {
+	return global.DB.Transaction(func(tx *gorm.DB) error {
+		_, err := postLedger(tx, &LedgerEntry{
+			UserID:  id,
+			Account: model.AccountBalance,
+			Counter: model.AccountSystemAdjustment,
+			Type:    model.BalanceTypeAdminCharge,
+			Amount:  amount,
+			AdminID: adminID,
+			Memo:    "管理员充值",
+		})
+		return err
+	})
 }
 
 // BanUser 禁用用户（管理员）
@@ -289,7 +329,13 @@ func (s *UserService) BanUser(id uint) error {
 
 	user.Status = 0
 
-	return s.userRepo.Update(user)
+	if err := s.userRepo.Update(user); err != nil {
+		return err
+	}
+
+	// 停用该用户在所有节点上的实例
+	s.enforcement.SuspendUser(id, model.InstanceReasonBanned)
+	return nil
 }
 
 // UnbanUser 启用用户（管理员）
@@ -301,7 +347,13 @@ func (s *UserService) UnbanUser(id uint) error {
 
 	user.Status = 1
 
-	return s.userRepo.Update(user)
+	if err := s.userRepo.Update(user); err != nil {
+		return err
+	}
+
+	// 未超额且未到期时恢复实例
+	s.enforcement.ResumeIfCompliant(id, model.InstanceReasonUnbanned)
+	return nil
 }
 
 // ==================== 批量操作 ====================
@@ -323,12 +375,45 @@ func (s *UserService) BatchUpdateStatus(ids []uint, status int) (int64, error) {
 	if err != nil {
 		return 0, err
 	}
+
+	// 批量同步节点耗时较长，异步执行
+	go func() {
+		for _, id := range ids {
+			if status == 1 {
+				s.enforcement.ResumeIfCompliant(id, model.InstanceReasonUnbanned)
+			} else {
+				s.enforcement.SuspendUser(id, model.InstanceReasonBanned)
+			}
+		}
+	}()
+
 	return count, nil
 }
 
-// BatchCharge 批量充值
-func (s *UserService) BatchCharge(ids []uint, amount float64) (int64, error) {
-	count, err := s.userRepo.BatchAddBalance(ids, amount)
+// BatchCharge 批量充值，跳过不存在的用户
+func (s *UserService) BatchCharge(ids []uint, amount float64, adminID uint) (int64, error) {
+	var count int64
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		for _, id := range ids {
+			_, err := postLedger(tx, &LedgerEntry{
+				UserID:  id,
+				Account: model.AccountBalance,
+				Counter: model.AccountSystemAdjustment,
+				Type:    model.BalanceTypeAdminCharge,
+				Amount:  amount,
+				AdminID: adminID,
+				Memo:    "管理员批量充值",
+			})
+			if errors.Is(err, errLedgerUserNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
 	if err != nil {
 		return 0, err
 	}
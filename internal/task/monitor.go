@@ -23,6 +23,74 @@ func StartTasks() {
 		fmt.Println("Error scheduling monitor:", err)
 	}
 
+	metrics := service.NewNodeMetricService()
+
+	// Prune expired node metrics every hour
+	_, err = c.AddFunc("0 5 * * * *", func() {
+		metrics.Prune()
+	})
+	if err != nil {
+		fmt.Println("Error scheduling metric pruning:", err)
+	}
+
+	traffic := service.NewTrafficService()
+
+	// Collect instance traffic every minute
+	_, err = c.AddFunc("0 * * * * *", func() {
+		traffic.CollectAll()
+	})
+	if err != nil {
+		fmt.Println("Error scheduling traffic collector:", err)
+	}
+
+	// Reset monthly traffic quotas every hour
+	_, err = c.AddFunc("0 20 * * * *", func() {
+		traffic.ResetMonthly()
+	})
+	if err != nil {
+		fmt.Println("Error scheduling traffic reset:", err)
+	}
+
+	enforcement := service.NewEnforcementService()
+
+	// Enforce quota / expiry / ban every minute (after traffic collection)
+	_, err = c.AddFunc("30 * * * * *", func() {
+		enforcement.EnforceAll()
+	})
+	if err != nil {
+		fmt.Println("Error scheduling enforcement:", err)
+	}
+
+	orders := service.NewOrderService()
+
+	// Cancel expired pending orders every minute
+	_, err = c.AddFunc("10 * * * * *", func() {
+		orders.CancelExpired()
+	})
+	if err != nil {
+		fmt.Println("Error scheduling order expiry:", err)
+	}
+
+	autoRenew := service.NewAutoRenewService()
+
+	// Renew expiring plans from balance once a day
+	_, err = c.AddFunc("0 30 3 * * *", func() {
+		autoRenew.RenewDue()
+	})
+	if err != nil {
+		fmt.Println("Error scheduling auto renewal:", err)
+	}
+
+	crypto := service.NewCryptoPaymentService()
+
+	// Confirm USDT payments on chain every 30 seconds
+	_, err = c.AddFunc("15,45 * * * * *", func() {
+		crypto.Scan()
+	})
+	if err != nil {
+		fmt.Println("Error scheduling usdt watcher:", err)
+	}
+
 	c.Start()
 	fmt.Println("Cron Tasks Started")
 }
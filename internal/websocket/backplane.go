@@ -0,0 +1,53 @@
+package websocket
+
+import "sync"
+
+// Backplane 在多个面板实例之间分发推送消息
+// Hub.Broadcast/BroadcastTo 将消息交给 Backplane 发布，Backplane 再把各实例发布的消息投递给本实例的 Hub
+type Backplane interface {
+	// Start 开始接收消息，deliver 将消息投递给本实例的 Hub
+	Start(deliver func(BroadcastMessage)) error
+	// Publish 发布消息到所有实例 (包括本实例)
+	Publish(msg BroadcastMessage) error
+	// Close 停止接收并释放资源
+	Close() error
+}
+
+// MemoryBackplane 进程内 Backplane，仅适用于单实例部署
+type MemoryBackplane struct {
+	mu      sync.RWMutex
+	deliver func(BroadcastMessage)
+}
+
+// NewMemoryBackplane 创建进程内 Backplane
+func NewMemoryBackplane() *MemoryBackplane {
+	return &MemoryBackplane{}
+}
+
+// Start 开始接收消息
+func (b *MemoryBackplane) Start(deliver func(BroadcastMessage)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.deliver = deliver
+	return nil
+}
+
+// Publish 直接投递给本实例
+func (b *MemoryBackplane) Publish(msg BroadcastMessage) error {
+	b.mu.RLock()
+	deliver := b.deliver
+	b.mu.RUnlock()
+
+	if deliver != nil {
+		deliver(msg)
+	}
+	return nil
+}
+
+// Close 停止接收
+func (b *MemoryBackplane) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.deliver = nil
+	return nil
+}
@@ -0,0 +1,230 @@
+package websocket
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// DefaultPostgresChannel 默认通知频道名
+	DefaultPostgresChannel = "nodepass_ws"
+
+	// maxNotifyPayload NOTIFY 负载上限为 8000 字节，超出时消息写入表中，仅通知引用 ID
+	maxNotifyPayload = 7900
+
+	// backplaneTable 存放超大消息的表
+	backplaneTable = "ws_backplane_messages"
+
+	// backplaneRetention 超大消息保留时长，所有实例应在此时间内完成读取
+	backplaneRetention = 5 * time.Minute
+)
+
+// postgresEnvelope NOTIFY 负载
+type postgresEnvelope struct {
+	Origin  string `json:"o"`           // 发布者实例 ID，接收时跳过自己发布的消息
+	Room    string `json:"r,omitempty"` // 房间，为空表示全局广播
+	Message []byte `json:"m,omitempty"` // 消息内容
+	Ref     int64  `json:"ref,omitempty"`
+}
+
+// PostgresBackplane 基于 Postgres LISTEN/NOTIFY 的 Backplane
+// 本实例发布的消息直接投递给本地 Hub，同时通过 NOTIFY 广播给其他实例
+type PostgresBackplane struct {
+	pool    *pgxpool.Pool
+	channel string
+	origin  string
+
+	mu      sync.RWMutex
+	deliver func(BroadcastMessage)
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// NewPostgresBackplane 创建 Postgres Backplane
+func NewPostgresBackplane(dsn, channel string) (*PostgresBackplane, error) {
+	if channel == "" {
+		channel = DefaultPostgresChannel
+	}
+
+	pool, err := pgxpool.New(context.Background(), dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	origin := make([]byte, 8)
+	if _, err := rand.Read(origin); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	return &PostgresBackplane{
+		pool:    pool,
+		channel: channel,
+		origin:  hex.EncodeToString(origin),
+	}, nil
+}
+
+// Start 创建消息表并开始监听
+func (b *PostgresBackplane) Start(deliver func(BroadcastMessage)) error {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	_, err := b.pool.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+backplaneTable+` (
+		id BIGSERIAL PRIMARY KEY,
+		payload BYTEA NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	b.mu.Lock()
+	b.deliver = deliver
+	b.cancel = cancel
+	b.done = make(chan struct{})
+	b.mu.Unlock()
+
+	go b.listen(ctx)
+	return nil
+}
+
+// Publish 投递给本实例并通知其他实例
+func (b *PostgresBackplane) Publish(msg BroadcastMessage) error {
+	b.mu.RLock()
+	deliver := b.deliver
+	b.mu.RUnlock()
+
+	if deliver != nil {
+		deliver(msg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	env := postgresEnvelope{Origin: b.origin, Room: msg.Room, Message: msg.Message}
+	payload, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+
+	if len(payload) > maxNotifyPayload {
+		if err := b.pool.QueryRow(ctx,
+			`INSERT INTO `+backplaneTable+` (payload) VALUES ($1) RETURNING id`, payload,
+		).Scan(&env.Ref); err != nil {
+			return err
+		}
+		b.pool.Exec(ctx, `DELETE FROM `+backplaneTable+` WHERE created_at < $1`, time.Now().Add(-backplaneRetention))
+
+		env.Room, env.Message = "", nil
+		if payload, err = json.Marshal(env); err != nil {
+			return err
+		}
+	}
+
+	_, err = b.pool.Exec(ctx, "SELECT pg_notify($1, $2)", b.channel, string(payload))
+	return err
+}
+
+// Close 停止监听并关闭连接池
+func (b *PostgresBackplane) Close() error {
+	b.mu.Lock()
+	cancel, done := b.cancel, b.done
+	b.deliver = nil
+	b.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+	b.pool.Close()
+	return nil
+}
+
+// listen 监听通知，连接断开时自动重连
+func (b *PostgresBackplane) listen(ctx context.Context) {
+	defer close(b.done)
+
+	backoff := time.Second
+	for {
+		err := b.listenOnce(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Printf("websocket backplane: listen failed: %v, retrying in %s", err, backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// listenOnce 占用一个连接执行 LISTEN 并循环接收通知
+func (b *PostgresBackplane) listenOnce(ctx context.Context) error {
+	conn, err := b.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `LISTEN "`+b.channel+`"`); err != nil {
+		return err
+	}
+
+	for {
+		notification, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var env postgresEnvelope
+		if err := json.Unmarshal([]byte(notification.Payload), &env); err != nil || env.Origin == b.origin {
+			continue
+		}
+
+		if env.Ref > 0 {
+			if err := b.load(ctx, &env); err != nil {
+				log.Printf("websocket backplane: load message %d failed: %v", env.Ref, err)
+				continue
+			}
+		}
+
+		b.mu.RLock()
+		deliver := b.deliver
+		b.mu.RUnlock()
+		if deliver != nil {
+			deliver(BroadcastMessage{Room: env.Room, Message: env.Message})
+		}
+	}
+}
+
+// load 读取写入表中的超大消息
+func (b *PostgresBackplane) load(ctx context.Context, env *postgresEnvelope) error {
+	var payload []byte
+	if err := b.pool.QueryRow(ctx, `SELECT payload FROM `+backplaneTable+` WHERE id = $1`, env.Ref).Scan(&payload); err != nil {
+		return err
+	}
+
+	var stored postgresEnvelope
+	if err := json.Unmarshal(payload, &stored); err != nil {
+		return err
+	}
+	if stored.Origin != env.Origin {
+		return errors.New("origin mismatch")
+	}
+
+	env.Room, env.Message = stored.Room, stored.Message
+	return nil
+}
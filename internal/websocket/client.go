@@ -3,6 +3,7 @@ package websocket
 import (
 	"log"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -19,8 +20,8 @@ const (
 	// Send pings to peer with this period. Must be less than pongWait.
 	pingPeriod = (pongWait * 9) / 10
 
-	// Maximum message size allowed from peer.
-	maxMessageSize = 512
+	// Maximum message size allowed from peer. Per-type limits are enforced in handleMessage.
+	maxMessageSize = 64 * 1024
 )
 
 var upgrader = websocket.Upgrader{
@@ -41,8 +42,38 @@ type Client struct {
 	// 发送消息的缓冲通道
 	send chan []byte
 
-	// 客户端所在的房间
+	// 客户端所在的房间 (由 Hub.Run 维护)
 	rooms []string
+
+	// 通过订阅加入的房间 (由 Hub.Run 维护)
+	subscribed map[string]bool
+
+	// 连接认证信息
+	session *Session
+
+	// 客户端确认处理到的最大事件序号
+	lastAck atomic.Uint64
+}
+
+// Session 已认证的连接信息
+type Session struct {
+	UserID      uint
+	IsAdmin     bool
+	Subprotocol string // 客户端通过 Sec-WebSocket-Protocol 传递 Token 时需回显的协议名
+
+	// 断线续传: 客户端重连时携带上次收到的 epoch 与最大序号
+	Resume  bool
+	Epoch   string
+	LastSeq uint64
+}
+
+// Rooms 连接应加入的房间
+func (s *Session) Rooms() []string {
+	rooms := []string{RoomPublic, UserRoom(s.UserID)}
+	if s.IsAdmin {
+		rooms = append(rooms, RoomAdmin)
+	}
+	return rooms
 }
 
 // readPump 将消息从 WebSocket 连接泵送到 Hub
@@ -62,9 +93,7 @@ func (c *Client) readPump() {
 			}
 			break
 		}
-		// 是否回显或处理逻辑?
-		// c.hub.broadcast <- message
-		_ = message
+		c.handleMessage(message)
 	}
 }
 
@@ -85,19 +114,8 @@ func (c *Client) writePump() {
 				return
 			}
 
-			w, err := c.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
-			}
-			w.Write(message)
-
-			// 将排队的聊天消息添加到当前 WebSocket 消息中
-			n := len(c.send)
-			for i := 0; i < n; i++ {
-				w.Write(<-c.send)
-			}
-
-			if err := w.Close(); err != nil {
+			// 每条消息独立成帧，保证客户端收到的都是完整的 JSON
+			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
 				return
 			}
 		case <-ticker.C:
@@ -109,14 +127,36 @@ func (c *Client) writePump() {
 	}
 }
 
-// ServeWs 处理来自 Peer 的 WebSocket 请求
-func ServeWs(hub *Hub, c *gin.Context, rooms []string) {
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+// acked 记录客户端确认的事件序号
+func (c *Client) acked(seq uint64) {
+	for {
+		current := c.lastAck.Load()
+		if seq <= current || c.lastAck.CompareAndSwap(current, seq) {
+			return
+		}
+	}
+}
+
+// ServeWs 处理来自 Peer 的 WebSocket 请求 (调用方需先完成认证)
+func ServeWs(hub *Hub, c *gin.Context, session *Session) {
+	var header http.Header
+	if session.Subprotocol != "" {
+		header = http.Header{"Sec-WebSocket-Protocol": {session.Subprotocol}}
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, header)
 	if err != nil {
 		log.Println(err)
 		return
 	}
-	client := &Client{hub: hub, conn: conn, send: make(chan []byte, 256), rooms: rooms}
+	client := &Client{
+		hub:        hub,
+		conn:       conn,
+		send:       make(chan []byte, hub.queueSize),
+		rooms:      session.Rooms(),
+		subscribed: make(map[string]bool),
+		session:    session,
+	}
 	client.hub.register <- client
 
 	// 在新的 goroutine 中完成所有工作，允许调用者回收内存
@@ -0,0 +1,105 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// 房间
+const (
+	RoomPublic = "public" // 所有已认证连接
+	RoomAdmin  = "admin"  // 管理员连接
+)
+
+// 服务端推送的事件类型
+const (
+	EventNodeStatus     = "node_status"     // 节点状态变化
+	EventOrderPaid      = "order_paid"      // 订单支付完成
+	EventOrderExpired   = "order_expired"   // 订单超时自动取消
+	EventTrafficWarning = "traffic_warning" // 流量即将用尽
+	EventInstanceStatus = "instance_status" // 转发规则状态变化 (停用、恢复、迁移)
+	EventAutoRenew      = "auto_renew"      // 自动续费结果 (成功、余额不足、已关闭)
+
+	// 以下事件仅发送给订阅了对应主题的连接
+	EventNodeMetrics     = "node_metrics"     // 节点每轮探测结果 (主题 node:<id>)
+	EventInstanceTraffic = "instance_traffic" // 规则流量更新 (主题 instances)
+	EventOrderStatus     = "order_status"     // 订单状态变化 (主题 order:<id>)
+)
+
+// Event 服务端推送事件，与 Envelope 使用相同的 type/payload 字段
+type Event struct {
+	Type    string      `json:"type"`
+	Payload interface{} `json:"payload"`
+	Time    time.Time   `json:"time"`
+}
+
+// NewEvent 创建事件
+func NewEvent(eventType string, payload interface{}) *Event {
+	return &Event{Type: eventType, Payload: payload, Time: time.Now()}
+}
+
+// UserRoom 用户私有房间名
+func UserRoom(userID uint) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+// NodeRoom 节点主题房间名 (主题 node:<id>)
+func NodeRoom(nodeID uint) string {
+	return fmt.Sprintf("node:%d", nodeID)
+}
+
+// InstancesRoom 用户规则主题房间名 (主题 instances)
+func InstancesRoom(userID uint) string {
+	return fmt.Sprintf("instances:%d", userID)
+}
+
+// OrderRoom 订单主题房间名 (主题 order:<id>)
+func OrderRoom(orderID uint) string {
+	return fmt.Sprintf("order:%d", orderID)
+}
+
+// Publish 向房间推送事件，room 为空时全局广播
+func (h *Hub) Publish(room string, event *Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if room == "" {
+		h.Broadcast(data)
+	} else {
+		h.BroadcastTo(room, data)
+	}
+	return nil
+}
+
+// PushToUser 向指定用户的所有连接推送事件
+func (h *Hub) PushToUser(userID uint, event *Event) error {
+	return h.Publish(UserRoom(userID), event)
+}
+
+// PushToAdmins 向所有管理员连接推送事件
+func (h *Hub) PushToAdmins(event *Event) error {
+	return h.Publish(RoomAdmin, event)
+}
+
+// Publish 通过全局 Hub 向房间推送事件 (Hub 未初始化时忽略)
+func Publish(room string, event *Event) {
+	if GlobalHub != nil {
+		GlobalHub.Publish(room, event)
+	}
+}
+
+// PushToUser 通过全局 Hub 向用户推送事件 (Hub 未初始化时忽略)
+func PushToUser(userID uint, event *Event) {
+	if GlobalHub != nil {
+		GlobalHub.PushToUser(userID, event)
+	}
+}
+
+// PushToAdmins 通过全局 Hub 向管理员推送事件 (Hub 未初始化时忽略)
+func PushToAdmins(event *Event) {
+	if GlobalHub != nil {
+		GlobalHub.PushToAdmins(event)
+	}
+}
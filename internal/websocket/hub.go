@@ -1,5 +1,22 @@
 package websocket
 
+import (
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// SlowConsumerPolicy 客户端发送队列已满时的处理策略
+type SlowConsumerPolicy string
+
+const (
+	SlowConsumerDropOldest SlowConsumerPolicy = "drop_oldest" // 丢弃队列中最旧的消息 (默认)
+	SlowConsumerDisconnect SlowConsumerPolicy = "disconnect"  // 断开连接，客户端重连后通过续传或重新同步恢复
+)
+
+// defaultQueueSize 每个客户端发送队列的默认长度
+const defaultQueueSize = 256
+
 // Hub 维护活跃客户端集合并向客户端广播消息
 type Hub struct {
 	// 注册的客户端
@@ -16,6 +33,56 @@ type Hub struct {
 
 	// 房间映射
 	rooms map[string]map[*Client]bool
+
+	// 客户端订阅/取消订阅请求
+	subscriptions chan subscription
+
+	// 发送给单个客户端的消息 (请求响应、错误)
+	direct chan directMessage
+
+	// 客户端消息路由
+	router *Router
+
+	// 多实例消息分发
+	backplane Backplane
+
+	// 实例标识，序号仅在同一实例内连续
+	epoch string
+
+	// 最近分配的消息序号 (由 Run 维护)
+	seq uint64
+
+	// 各房间最近的消息，用于断线续传 (由 Run 维护，全局广播使用空字符串作为键)
+	buffers map[string]*replayBuffer
+
+	// 已释放缓冲中的最大序号，早于该序号的续传请求无法判断是否有遗漏
+	prunedSeq uint64
+
+	// 慢消费者策略与客户端发送队列长度 (应在 Run 之前设置)
+	policy    SlowConsumerPolicy
+	queueSize int
+
+	// 运行统计
+	statsRequests chan chan Stats
+	dropped       atomic.Uint64
+	disconnected  atomic.Uint64
+}
+
+// subscription 订阅变更请求，处理结果通过 result 返回
+type subscription struct {
+	client *Client
+	room   string
+	join   bool
+	result chan error
+
+	// 加入房间后补发序号大于 lastSeq 的消息 (为空则不补发)
+	lastSeq *uint64
+}
+
+// directMessage 发送给单个客户端的消息
+type directMessage struct {
+	client  *Client
+	message []byte
 }
 
 type BroadcastMessage struct {
@@ -26,75 +93,240 @@ type BroadcastMessage struct {
 var GlobalHub *Hub
 
 func NewHub() *Hub {
-	return &Hub{
+	h := &Hub{
 		broadcast:  make(chan BroadcastMessage),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
 		clients:    make(map[*Client]bool),
 		rooms:      make(map[string]map[*Client]bool),
+
+		subscriptions: make(chan subscription),
+		direct:        make(chan directMessage),
+		router:        NewRouter(),
+
+		epoch:   newEpoch(),
+		buffers: make(map[string]*replayBuffer),
+
+		policy:        SlowConsumerDropOldest,
+		queueSize:     defaultQueueSize,
+		statsRequests: make(chan chan Stats),
+	}
+	h.SetBackplane(NewMemoryBackplane())
+	return h
+}
+
+// SetBackplane 替换 Backplane (应在 Run 之前调用)，旧的 Backplane 会被关闭
+func (h *Hub) SetBackplane(backplane Backplane) error {
+	if err := backplane.Start(h.deliver); err != nil {
+		return err
+	}
+	if h.backplane != nil {
+		h.backplane.Close()
 	}
+	h.backplane = backplane
+	return nil
+}
+
+// SetSlowConsumerPolicy 设置慢消费者策略与客户端发送队列长度 (应在 Run 之前调用，queueSize <= 0 使用默认值)
+func (h *Hub) SetSlowConsumerPolicy(policy SlowConsumerPolicy, queueSize int) {
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+	h.policy = policy
+	h.queueSize = queueSize
+}
+
+// Close 关闭 Backplane
+func (h *Hub) Close() error {
+	return h.backplane.Close()
+}
+
+// deliver 将 Backplane 收到的消息交给 Run 分发
+func (h *Hub) deliver(msg BroadcastMessage) {
+	h.broadcast <- msg
+}
+
+// Router 返回客户端消息路由，用于注册请求类型与主题解析
+func (h *Hub) Router() *Router {
+	return h.router
 }
 
 func (h *Hub) Run() {
+	pruneTicker := time.NewTicker(replayPruneInterval)
+	defer pruneTicker.Stop()
+
 	for {
 		select {
 		case client := <-h.register:
 			h.clients[client] = true
 			for _, room := range client.rooms {
-				if h.rooms[room] == nil {
-					h.rooms[room] = make(map[*Client]bool)
-				}
-				h.rooms[room][client] = true
+				h.join(client, room)
 			}
+			h.welcome(client)
 		case client := <-h.unregister:
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
-				for _, room := range client.rooms {
-					if clients, ok := h.rooms[room]; ok {
-						delete(clients, client)
-						if len(clients) == 0 {
-							delete(h.rooms, room)
-						}
-					}
-				}
-			}
+			h.remove(client)
+		case sub := <-h.subscriptions:
+			sub.result <- h.applySubscription(sub)
+		case msg := <-h.direct:
+			h.enqueue(msg.client, msg.message)
+		case result := <-h.statsRequests:
+			result <- h.snapshot()
+		case <-pruneTicker.C:
+			h.pruneBuffers()
 		case msg := <-h.broadcast:
+			message := h.record(msg)
 			if msg.Room == "" {
 				// 全局广播
 				for client := range h.clients {
-					select {
-					case client.send <- msg.Message:
-					default:
-						close(client.send)
-						delete(h.clients, client)
-					}
+					h.enqueue(client, message)
 				}
 			} else {
 				// 房间广播
-				if clients, ok := h.rooms[msg.Room]; ok {
-					for client := range clients {
-						select {
-						case client.send <- msg.Message:
-						default:
-							close(client.send)
-							delete(h.clients, client)
-							// 清理房间逻辑?
-							// 通常注销通道会处理清理。
-							// 这里我们只是丢弃客户端。
-							// 为了简化，仅关闭发送通道。
-						}
-					}
+				for client := range h.rooms[msg.Room] {
+					h.enqueue(client, message)
 				}
 			}
 		}
 	}
 }
 
+// join 将客户端加入房间 (在 Run 中调用)
+func (h *Hub) join(client *Client, room string) {
+	if h.rooms[room] == nil {
+		h.rooms[room] = make(map[*Client]bool)
+	}
+	h.rooms[room][client] = true
+}
+
+// leave 将客户端移出房间 (在 Run 中调用)
+func (h *Hub) leave(client *Client, room string) {
+	if clients, ok := h.rooms[room]; ok {
+		delete(clients, client)
+		if len(clients) == 0 {
+			delete(h.rooms, room)
+		}
+	}
+}
+
+// remove 移除客户端并关闭其发送队列，是客户端离开 Hub 的唯一路径 (在 Run 中调用)
+// 发送队列只在这里关闭，且所有写入都发生在 Run 中，因此不会向已关闭的队列写入
+func (h *Hub) remove(client *Client) {
+	if _, ok := h.clients[client]; !ok {
+		return
+	}
+	delete(h.clients, client)
+	for _, room := range client.rooms {
+		h.leave(client, room)
+	}
+	close(client.send)
+}
+
+// enqueue 将消息写入客户端发送队列 (在 Run 中调用)
+// 队列已满时按慢消费者策略丢弃最旧的消息或断开连接，返回消息是否已入队
+func (h *Hub) enqueue(client *Client, message []byte) bool {
+	if _, ok := h.clients[client]; !ok {
+		return false
+	}
+
+	select {
+	case client.send <- message:
+		return true
+	default:
+	}
+
+	if h.policy == SlowConsumerDisconnect {
+		h.disconnected.Add(1)
+		h.dropped.Add(1)
+		h.remove(client)
+		return false
+	}
+
+	// 丢弃最旧的一条再写入；writePump 可能同时取走消息，因此两步都不阻塞
+	select {
+	case <-client.send:
+		h.dropped.Add(1)
+	default:
+	}
+	select {
+	case client.send <- message:
+		return true
+	default:
+		h.dropped.Add(1)
+		return false
+	}
+}
+
+// Broadcast 向所有实例的所有连接广播消息
 func (h *Hub) Broadcast(msg []byte) {
-	h.broadcast <- BroadcastMessage{Message: msg}
+	h.publish(BroadcastMessage{Message: msg})
 }
 
+// BroadcastTo 向所有实例中指定房间的连接广播消息
 func (h *Hub) BroadcastTo(room string, msg []byte) {
-	h.broadcast <- BroadcastMessage{Room: room, Message: msg}
+	h.publish(BroadcastMessage{Room: room, Message: msg})
+}
+
+// publish 通过 Backplane 发布消息
+func (h *Hub) publish(msg BroadcastMessage) {
+	if err := h.backplane.Publish(msg); err != nil {
+		log.Printf("websocket: publish failed: %v", err)
+	}
+}
+
+// applySubscription 在 Run 中处理订阅变更
+func (h *Hub) applySubscription(sub subscription) error {
+	client := sub.client
+	if _, ok := h.clients[client]; !ok {
+		return NewError(ErrCodeRequestFailed, "connection closed")
+	}
+
+	if !sub.join {
+		if !client.subscribed[sub.room] {
+			return nil
+		}
+		delete(client.subscribed, sub.room)
+		for i, room := range client.rooms {
+			if room == sub.room {
+				client.rooms = append(client.rooms[:i], client.rooms[i+1:]...)
+				break
+			}
+		}
+		h.leave(client, sub.room)
+		return nil
+	}
+
+	if h.rooms[sub.room][client] {
+		return nil
+	}
+	if len(client.subscribed) >= maxSubscriptionsPerConn {
+		return NewError(ErrCodeTooManyTopics, "too many subscriptions")
+	}
+
+	client.subscribed[sub.room] = true
+	client.rooms = append(client.rooms, sub.room)
+	h.join(client, sub.room)
+
+	if sub.lastSeq != nil {
+		h.replay(client, []string{sub.room}, *sub.lastSeq)
+	}
+	return nil
+}
+
+// subscribe 将客户端加入房间，lastSeq 不为空时补发该房间错过的消息
+func (h *Hub) subscribe(client *Client, room string, lastSeq *uint64) error {
+	result := make(chan error, 1)
+	h.subscriptions <- subscription{client: client, room: room, join: true, result: result, lastSeq: lastSeq}
+	return <-result
+}
+
+// unsubscribe 将客户端移出通过订阅加入的房间
+func (h *Hub) unsubscribe(client *Client, room string) error {
+	result := make(chan error, 1)
+	h.subscriptions <- subscription{client: client, room: room, join: false, result: result}
+	return <-result
+}
+
+// sendTo 向单个客户端发送消息
+func (h *Hub) sendTo(client *Client, msg []byte) {
+	h.direct <- directMessage{client: client, message: msg}
 }
@@ -0,0 +1,174 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// newTestClient 创建不带网络连接的客户端并注册到 Hub
+func newTestClient(h *Hub, rooms ...string) *Client {
+	client := &Client{
+		hub:        h,
+		send:       make(chan []byte, h.queueSize),
+		rooms:      rooms,
+		subscribed: make(map[string]bool),
+		session:    &Session{},
+	}
+	h.register <- client
+	return client
+}
+
+// drain 持续读取客户端发送队列直到关闭
+func drain(client *Client) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		for range client.send {
+		}
+		close(done)
+	}()
+	return done
+}
+
+func newTestHub(t *testing.T, policy SlowConsumerPolicy, queueSize int) *Hub {
+	t.Helper()
+	h := NewHub()
+	h.SetSlowConsumerPolicy(policy, queueSize)
+	go h.Run()
+	return h
+}
+
+func TestSlowConsumerDropOldest(t *testing.T) {
+	h := newTestHub(t, SlowConsumerDropOldest, 4)
+	client := newTestClient(h, "room")
+
+	for i := 1; i <= 10; i++ {
+		h.BroadcastTo("room", []byte(fmt.Sprintf(`{"n":%d}`, i)))
+	}
+
+	stats := h.Stats()
+	if stats.Clients != 1 || stats.Rooms != 1 {
+		t.Fatalf("clients/rooms = %d/%d, want 1/1", stats.Clients, stats.Rooms)
+	}
+	if stats.QueueDepth != 4 || stats.MaxQueueDepth != 4 {
+		t.Fatalf("queue depth = %d (max %d), want 4", stats.QueueDepth, stats.MaxQueueDepth)
+	}
+	// welcome 与前 6 条广播被挤出队列
+	if stats.Dropped != 7 {
+		t.Fatalf("dropped = %d, want 7", stats.Dropped)
+	}
+
+	for want := 7; want <= 10; want++ {
+		var msg struct{ N int }
+		if err := json.Unmarshal(<-client.send, &msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.N != want {
+			t.Fatalf("got message %d, want %d", msg.N, want)
+		}
+	}
+}
+
+func TestSlowConsumerDisconnect(t *testing.T) {
+	h := newTestHub(t, SlowConsumerDisconnect, 2)
+	slow := newTestClient(h, "room", "slow")
+	fast := newTestClient(h, "room")
+
+	for i := 0; i < 5; i++ {
+		h.BroadcastTo("slow", []byte(`{"type":"x"}`))
+	}
+
+	stats := h.Stats()
+	if stats.Clients != 1 {
+		t.Fatalf("clients = %d, want 1", stats.Clients)
+	}
+	// 慢连接独占的房间应一并清理
+	if stats.Rooms != 1 {
+		t.Fatalf("rooms = %d, want 1", stats.Rooms)
+	}
+	if stats.Disconnected != 1 || stats.Dropped != 1 {
+		t.Fatalf("disconnected/dropped = %d/%d, want 1/1", stats.Disconnected, stats.Dropped)
+	}
+
+	// 慢连接的队列已关闭，已入队的消息仍可读出
+	n := 0
+	for range slow.send {
+		n++
+	}
+	if n != 2 {
+		t.Fatalf("slow client received %d queued messages, want 2", n)
+	}
+
+	// 连接断开后 readPump 仍会注销，重复移除与后续广播都不应 panic
+	h.unregister <- slow
+	h.BroadcastTo("slow", []byte(`{"type":"x"}`))
+	h.Broadcast([]byte(`{"type":"x"}`))
+
+	// welcome 与全局广播
+	h.unregister <- fast
+	n = 0
+	for range fast.send {
+		n++
+	}
+	if n != 2 {
+		t.Fatalf("fast client received %d queued messages, want 2", n)
+	}
+	if stats := h.Stats(); stats.Clients != 0 || stats.Rooms != 0 {
+		t.Fatalf("clients/rooms = %d/%d after unregister, want 0/0", stats.Clients, stats.Rooms)
+	}
+}
+
+func TestConcurrentBroadcastSubscribeUnregister(t *testing.T) {
+	for _, policy := range []SlowConsumerPolicy{SlowConsumerDropOldest, SlowConsumerDisconnect} {
+		t.Run(string(policy), func(t *testing.T) {
+			h := newTestHub(t, policy, 8)
+
+			const clients = 20
+			var wg sync.WaitGroup
+			for i := 0; i < clients; i++ {
+				client := newTestClient(h, RoomPublic, UserRoom(uint(i)))
+				// 一半的连接从不读取，触发慢消费者处理
+				var done <-chan struct{}
+				if i%2 == 0 {
+					done = drain(client)
+				}
+
+				wg.Add(1)
+				go func(i int, client *Client) {
+					defer wg.Done()
+					room := NodeRoom(uint(i % 3))
+					for j := 0; j < 50; j++ {
+						if err := h.subscribe(client, room, nil); err != nil && policy == SlowConsumerDropOldest {
+							t.Errorf("subscribe: %v", err)
+						}
+						h.BroadcastTo(room, []byte(`{"type":"node"}`))
+						h.Broadcast([]byte(`{"type":"global"}`))
+						h.unsubscribe(client, room)
+					}
+					h.unregister <- client
+					if done != nil {
+						<-done
+					}
+				}(i, client)
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					h.Stats()
+				}
+			}()
+			wg.Wait()
+
+			stats := h.Stats()
+			if stats.Clients != 0 || stats.Rooms != 0 || stats.QueueDepth != 0 {
+				t.Fatalf("clients/rooms/depth = %d/%d/%d, want 0/0/0", stats.Clients, stats.Rooms, stats.QueueDepth)
+			}
+			if stats.Dropped == 0 {
+				t.Fatal("expected dropped messages from slow clients")
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+)
+
+// 客户端消息类型 (内置)
+const (
+	TypeSubscribe   = "subscribe"   // 订阅主题 payload: {"topic": "node:1", "last_seq": 10}
+	TypeUnsubscribe = "unsubscribe" // 取消订阅 payload: {"topic": "node:1"}
+	TypeAck         = "ack"         // 客户端确认已处理的事件 payload: {"seq": 10}
+	TypePing        = "ping"        // 应用层心跳
+)
+
+// 服务端消息类型
+const (
+	TypeReply = "reply" // 请求的响应，id 与请求一致
+	TypeError = "error" // 错误，id 与请求一致 (无法解析时为空)
+	TypePong  = "pong"  // 心跳响应
+)
+
+// 错误码
+const (
+	ErrCodeInvalidMessage  = "invalid_message"
+	ErrCodeUnknownType     = "unknown_type"
+	ErrCodeMessageTooLarge = "message_too_large"
+	ErrCodeInvalidTopic    = "invalid_topic"
+	ErrCodeForbidden       = "forbidden"
+	ErrCodeTooManyTopics   = "too_many_subscriptions"
+	ErrCodeBadRequest      = "bad_request"
+	ErrCodeRequestFailed   = "request_failed"
+)
+
+const (
+	// defaultMaxMessageSize 未单独指定的消息类型允许的最大字节数
+	defaultMaxMessageSize = 512
+	// maxSubscriptionsPerConn 单个连接最多订阅的主题数
+	maxSubscriptionsPerConn = 32
+)
+
+// Envelope 客户端与服务端之间的消息信封
+type Envelope struct {
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"`      // 客户端请求 ID，响应时原样返回
+	Payload json.RawMessage `json:"payload,omitempty"` // 消息内容
+}
+
+// ErrorPayload 错误消息内容
+type ErrorPayload struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error 带错误码的协议错误，请求处理函数可返回该类型以指定错误码
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// NewError 创建协议错误
+func NewError(code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// TopicPayload 订阅/取消订阅消息内容
+type TopicPayload struct {
+	Topic   string  `json:"topic"`
+	LastSeq *uint64 `json:"last_seq,omitempty"` // 订阅时补发该主题序号大于 last_seq 的消息
+}
+
+// AckPayload 确认消息内容
+type AckPayload struct {
+	Seq uint64 `json:"seq"`
+}
+
+// RequestHandler 请求处理函数，返回值作为 reply 的 payload
+type RequestHandler func(session *Session, payload json.RawMessage) (interface{}, error)
+
+// TopicResolver 校验连接能否订阅主题，并返回主题对应的房间名
+type TopicResolver func(session *Session, topic string) (string, error)
+
+// route 已注册的请求类型
+type route struct {
+	handler RequestHandler
+	maxSize int
+}
+
+// Router 客户端消息路由
+type Router struct {
+	mu       sync.RWMutex
+	routes   map[string]route
+	resolver TopicResolver
+}
+
+// NewRouter 创建消息路由
+func NewRouter() *Router {
+	return &Router{routes: make(map[string]route)}
+}
+
+// Handle 注册请求类型，maxSize 为该类型允许的最大消息字节数 (<=0 使用默认值)
+func (r *Router) Handle(msgType string, maxSize int, handler RequestHandler) {
+	if maxSize <= 0 {
+		maxSize = defaultMaxMessageSize
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.routes[msgType] = route{handler: handler, maxSize: maxSize}
+}
+
+// SetTopicResolver 设置主题解析函数，未设置时拒绝所有订阅
+func (r *Router) SetTopicResolver(resolver TopicResolver) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.resolver = resolver
+}
+
+// lookup 查找请求类型
+func (r *Router) lookup(msgType string) (route, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	rt, ok := r.routes[msgType]
+	return rt, ok
+}
+
+// resolveTopic 解析主题
+func (r *Router) resolveTopic(session *Session, topic string) (string, error) {
+	r.mu.RLock()
+	resolver := r.resolver
+	r.mu.RUnlock()
+
+	if resolver == nil {
+		return "", NewError(ErrCodeInvalidTopic, "subscriptions are not supported")
+	}
+	return resolver(session, topic)
+}
+
+// builtinMaxSize 内置消息类型的最大字节数
+var builtinMaxSize = map[string]int{
+	TypeSubscribe:   defaultMaxMessageSize,
+	TypeUnsubscribe: defaultMaxMessageSize,
+	TypeAck:         256,
+	TypePing:        128,
+}
+
+// handleMessage 处理一条客户端消息
+func (c *Client) handleMessage(message []byte) {
+	var env Envelope
+	if err := json.Unmarshal(message, &env); err != nil || env.Type == "" {
+		c.sendError("", NewError(ErrCodeInvalidMessage, "message must be a JSON object with a type"))
+		return
+	}
+
+	maxSize, builtin := builtinMaxSize[env.Type]
+	rt, registered := c.hub.router.lookup(env.Type)
+	if !builtin && !registered {
+		c.sendError(env.ID, NewError(ErrCodeUnknownType, "unknown message type: "+env.Type))
+		return
+	}
+	if registered {
+		maxSize = rt.maxSize
+	}
+	if len(message) > maxSize {
+		c.sendError(env.ID, NewError(ErrCodeMessageTooLarge, "message exceeds size limit for type "+env.Type))
+		return
+	}
+
+	switch env.Type {
+	case TypeSubscribe, TypeUnsubscribe:
+		c.handleSubscription(&env)
+	case TypeAck:
+		var ack AckPayload
+		if err := json.Unmarshal(env.Payload, &ack); err != nil {
+			c.sendError(env.ID, NewError(ErrCodeBadRequest, "invalid ack payload"))
+			return
+		}
+		c.acked(ack.Seq)
+	case TypePing:
+		c.sendEnvelope(TypePong, env.ID, nil)
+	default:
+		result, err := rt.handler(c.session, env.Payload)
+		if err != nil {
+			c.sendError(env.ID, err)
+			return
+		}
+		c.sendEnvelope(TypeReply, env.ID, result)
+	}
+}
+
+// handleSubscription 处理订阅/取消订阅
+func (c *Client) handleSubscription(env *Envelope) {
+	var payload TopicPayload
+	if err := json.Unmarshal(env.Payload, &payload); err != nil || payload.Topic == "" {
+		c.sendError(env.ID, NewError(ErrCodeBadRequest, "topic is required"))
+		return
+	}
+
+	room, err := c.hub.router.resolveTopic(c.session, payload.Topic)
+	if err != nil {
+		c.sendError(env.ID, err)
+		return
+	}
+
+	if env.Type == TypeSubscribe {
+		err = c.hub.subscribe(c, room, payload.LastSeq)
+	} else {
+		err = c.hub.unsubscribe(c, room)
+	}
+	if err != nil {
+		c.sendError(env.ID, err)
+		return
+	}
+
+	c.sendEnvelope(TypeAck, env.ID, payload)
+}
+
+// sendEnvelope 向客户端发送消息
+func (c *Client) sendEnvelope(msgType, id string, payload interface{}) {
+	env := Envelope{Type: msgType, ID: id}
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			c.sendError(id, NewError(ErrCodeRequestFailed, "failed to encode response"))
+			return
+		}
+		env.Payload = data
+	}
+
+	data, _ := json.Marshal(env)
+	c.hub.sendTo(c, data)
+}
+
+// sendError 向客户端发送错误
+func (c *Client) sendError(id string, err error) {
+	payload := ErrorPayload{Code: ErrCodeRequestFailed, Message: err.Error()}
+	var protoErr *Error
+	if errors.As(err, &protoErr) {
+		payload.Code = protoErr.Code
+	}
+
+	data, _ := json.Marshal(payload)
+	env, _ := json.Marshal(Envelope{Type: TypeError, ID: id, Payload: data})
+	c.hub.sendTo(c, env)
+}
@@ -0,0 +1,198 @@
+package websocket
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	// replayBufferSize 每个房间保留的最近消息数
+	replayBufferSize = 128
+
+	// replayIdleTimeout 房间超过该时间没有新消息时释放其缓冲
+	replayIdleTimeout = 10 * time.Minute
+
+	// replayPruneInterval 清理空闲缓冲的间隔
+	replayPruneInterval = time.Minute
+)
+
+// 服务端消息类型 (续传)
+const (
+	TypeWelcome = "welcome" // 连接建立后发送，payload: {"epoch": "...", "seq": 当前序号}
+	TypeResync  = "resync"  // 无法补发错过的消息，客户端需重新拉取完整状态
+)
+
+// 需要重新同步的原因
+const (
+	ResyncEpochChanged = "epoch_changed" // 服务端已重启或连接到了其他实例
+	ResyncOverrun      = "overrun"       // 错过的消息已超出缓冲
+)
+
+// WelcomePayload 连接建立消息内容
+type WelcomePayload struct {
+	Epoch string `json:"epoch"` // Hub 实例标识，重启或切换实例后变化，此时序号不再连续
+	Seq   uint64 `json:"seq"`   // 当前最新序号
+}
+
+// ResyncPayload 重新同步消息内容
+type ResyncPayload struct {
+	Reason string `json:"reason"`
+	Room   string `json:"room,omitempty"` // 订阅时续传失败的房间
+	Seq    uint64 `json:"seq"`            // 当前最新序号
+}
+
+// sequenced 带序号的消息
+type sequenced struct {
+	seq     uint64
+	message []byte
+}
+
+// replayBuffer 房间的消息环形缓冲，仅由 Hub.Run 访问
+type replayBuffer struct {
+	items      []sequenced
+	start      int
+	evictedMax uint64 // 已被覆盖的最大序号
+	lastWrite  time.Time
+}
+
+// add 追加消息，缓冲满时覆盖最旧的一条
+func (b *replayBuffer) add(seq uint64, message []byte) {
+	b.lastWrite = time.Now()
+	if len(b.items) < replayBufferSize {
+		b.items = append(b.items, sequenced{seq: seq, message: message})
+		return
+	}
+	b.evictedMax = b.items[b.start].seq
+	b.items[b.start] = sequenced{seq: seq, message: message}
+	b.start = (b.start + 1) % len(b.items)
+}
+
+// since 返回序号大于 seq 的消息 (按序号递增)
+func (b *replayBuffer) since(seq uint64) []sequenced {
+	var result []sequenced
+	for i := 0; i < len(b.items); i++ {
+		item := b.items[(b.start+i)%len(b.items)]
+		if item.seq > seq {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// encodeEnvelope 编码服务端主动发送的消息
+func encodeEnvelope(msgType string, payload interface{}) []byte {
+	data, _ := json.Marshal(payload)
+	env, _ := json.Marshal(Envelope{Type: msgType, Payload: data})
+	return env
+}
+
+// welcome 向新连接发送实例标识与当前序号，并按需补发断线期间的消息 (在 Run 中调用)
+func (h *Hub) welcome(client *Client) {
+	h.enqueue(client, encodeEnvelope(TypeWelcome, WelcomePayload{Epoch: h.epoch, Seq: h.seq}))
+
+	session := client.session
+	if !session.Resume {
+		return
+	}
+	if session.Epoch != "" && session.Epoch != h.epoch {
+		h.enqueue(client, encodeEnvelope(TypeResync, ResyncPayload{Reason: ResyncEpochChanged, Seq: h.seq}))
+		return
+	}
+	h.replay(client, append([]string{""}, client.rooms...), session.LastSeq)
+}
+
+// newEpoch 生成 Hub 实例标识
+func newEpoch() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// withSeq 在 JSON 对象消息中写入 seq 字段，非 JSON 对象原样返回
+func withSeq(message []byte, seq uint64) []byte {
+	if len(message) < 2 || message[0] != '{' {
+		return message
+	}
+
+	prefix := `{"seq":` + strconv.FormatUint(seq, 10)
+	rest := message[1:]
+	if len(bytes.TrimSpace(rest)) > 1 {
+		prefix += ","
+	}
+
+	result := make([]byte, 0, len(prefix)+len(rest))
+	result = append(result, prefix...)
+	return append(result, rest...)
+}
+
+// record 为广播消息分配序号并写入房间缓冲 (在 Run 中调用)
+func (h *Hub) record(msg BroadcastMessage) []byte {
+	h.seq++
+	message := withSeq(msg.Message, h.seq)
+
+	buffer, ok := h.buffers[msg.Room]
+	if !ok {
+		buffer = &replayBuffer{}
+		h.buffers[msg.Room] = buffer
+	}
+	buffer.add(h.seq, message)
+	return message
+}
+
+// pruneBuffers 释放空闲房间的缓冲 (在 Run 中调用)
+// 被释放的房间无法再判断客户端是否错过消息，因此更早的续传请求一律要求重新同步
+func (h *Hub) pruneBuffers() {
+	deadline := time.Now().Add(-replayIdleTimeout)
+	for room, buffer := range h.buffers {
+		if room == "" || buffer.lastWrite.After(deadline) {
+			continue
+		}
+		if last := buffer.items[(buffer.start+len(buffer.items)-1)%len(buffer.items)].seq; last > h.prunedSeq {
+			h.prunedSeq = last
+		}
+		delete(h.buffers, room)
+	}
+}
+
+// replay 向客户端补发 rooms 中序号大于 lastSeq 的消息 (在 Run 中调用)
+// 无法完整补发时发送 resync 消息并返回 false
+func (h *Hub) replay(client *Client, rooms []string, lastSeq uint64) bool {
+	resync := func(reason, room string) bool {
+		h.enqueue(client, encodeEnvelope(TypeResync, ResyncPayload{Reason: reason, Room: room, Seq: h.seq}))
+		return false
+	}
+
+	if lastSeq > h.seq {
+		return resync(ResyncEpochChanged, "")
+	}
+	if lastSeq < h.prunedSeq {
+		return resync(ResyncOverrun, "")
+	}
+
+	var missed []sequenced
+	for _, room := range rooms {
+		buffer, ok := h.buffers[room]
+		if !ok {
+			continue
+		}
+		if buffer.evictedMax > lastSeq {
+			return resync(ResyncOverrun, room)
+		}
+		missed = append(missed, buffer.since(lastSeq)...)
+	}
+
+	if len(missed) > cap(client.send)-len(client.send) {
+		return resync(ResyncOverrun, "")
+	}
+
+	sort.Slice(missed, func(i, j int) bool { return missed[i].seq < missed[j].seq })
+	for _, item := range missed {
+		h.enqueue(client, item.message)
+	}
+	return true
+}
@@ -0,0 +1,42 @@
+package websocket
+
+// Stats Hub 运行统计
+type Stats struct {
+	Clients       int                `json:"clients"`         // 当前连接数
+	Rooms         int                `json:"rooms"`           // 当前有连接的房间数
+	Policy        SlowConsumerPolicy `json:"policy"`          // 慢消费者策略
+	QueueSize     int                `json:"queue_size"`      // 每个连接的发送队列长度
+	QueueDepth    int                `json:"queue_depth"`     // 所有连接待发送的消息总数
+	MaxQueueDepth int                `json:"max_queue_depth"` // 单个连接待发送消息数的最大值
+	Dropped       uint64             `json:"dropped"`         // 因队列已满丢弃的消息数
+	Disconnected  uint64             `json:"disconnected"`    // 因队列已满被断开的连接数
+	Seq           uint64             `json:"seq"`             // 最新消息序号
+}
+
+// Stats 获取运行统计 (需要 Run 正在运行)
+func (h *Hub) Stats() Stats {
+	result := make(chan Stats, 1)
+	h.statsRequests <- result
+	return <-result
+}
+
+// snapshot 统计当前状态 (在 Run 中调用)
+func (h *Hub) snapshot() Stats {
+	stats := Stats{
+		Clients:      len(h.clients),
+		Rooms:        len(h.rooms),
+		Policy:       h.policy,
+		QueueSize:    h.queueSize,
+		Dropped:      h.dropped.Load(),
+		Disconnected: h.disconnected.Load(),
+		Seq:          h.seq,
+	}
+	for client := range h.clients {
+		depth := len(client.send)
+		stats.QueueDepth += depth
+		if depth > stats.MaxQueueDepth {
+			stats.MaxQueueDepth = depth
+		}
+	}
+	return stats
+}
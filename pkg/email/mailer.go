@@ -3,6 +3,7 @@ package email
 import (
 	"crypto/tls"
 	"fmt"
+	"html"
 	"net/smtp"
 	"nodepassPanel/internal/config"
 	"nodepassPanel/pkg/logger"
@@ -14,6 +15,7 @@ import (
 // Mailer 邮件发送器接口
 type Mailer interface {
 	SendVerifyCode(to, code string, codeType int) error
+	SendNotice(to, subject, content string) error
 }
 
 // SMTPMailer SMTP 邮件发送器
@@ -104,6 +106,22 @@ func (m *SMTPMailer) SendVerifyCode(to, code string, codeType int) error {
 	return m.send(to, subject, body)
 }
 
+// SendNotice 发送系统通知邮件 (content 为纯文本，按行渲染)
+func (m *SMTPMailer) SendNotice(to, subject, content string) error {
+	lines := strings.Split(html.EscapeString(content), "\n")
+	body := fmt.Sprintf(`
+<div style="max-width: 600px; margin: 0 auto; padding: 30px; font-family: 'PingFang SC', 'Microsoft YaHei', sans-serif;">
+  <h2 style="color: #1F2937; margin: 0 0 20px 0;">%s</h2>
+  <p style="color: #374151; line-height: 1.6;">%s</p>
+  <p style="text-align: center; color: #6B7280; font-size: 12px; margin-top: 30px;">
+    此邮件由系统自动发送，请勿回复
+  </p>
+</div>
+`, html.EscapeString(subject), strings.Join(lines, "<br>"))
+
+	return m.send(to, "【NyanPass】"+subject, body)
+}
+
 // send 发送邮件
 func (m *SMTPMailer) send(to, subject, body string) error {
 	// 构建邮件内容
@@ -4,7 +4,11 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 )
 
@@ -38,6 +42,93 @@ type GenericResponse struct {
 	Error   string          `json:"error"`
 }
 
+// 实例类型
+const (
+	InstanceTypeServer = "server" // 服务端 (监听隧道)
+	InstanceTypeClient = "client" // 客户端 (连接隧道)
+)
+
+// 实例运行状态
+const (
+	InstanceStatusRunning = "running"
+	InstanceStatusStopped = "stopped"
+	InstanceStatusError   = "error"
+)
+
+// 实例控制动作
+const (
+	ActionStart   = "start"
+	ActionStop    = "stop"
+	ActionRestart = "restart"
+	ActionReset   = "reset" // 重置流量计数
+)
+
+// Instance NodePass Master 上的实例
+type Instance struct {
+	ID      string `json:"id"`
+	Alias   string `json:"alias"`
+	Type    string `json:"type"`    // server, client
+	Status  string `json:"status"`  // running, stopped, error
+	URL     string `json:"url"`     // 隧道 URL，例如 server://0.0.0.0:10101/127.0.0.1:8080
+	Restart bool   `json:"restart"` // 是否随 Master 自启动
+
+	// 流量统计 (单位: Bytes，节点重启后会归零)
+	TCPRx int64 `json:"tcprx"`
+	TCPTx int64 `json:"tcptx"`
+	UDPRx int64 `json:"udprx"`
+	UDPTx int64 `json:"udptx"`
+
+	Pool int `json:"pool"` // 连接池大小
+	Ping int `json:"ping"` // 隧道延迟 (ms)
+}
+
+// TunnelPort 解析实例隧道 URL 中监听的端口 (解析失败返回 0)
+func (i *Instance) TunnelPort() int {
+	u, err := url.Parse(i.URL)
+	if err != nil {
+		return 0
+	}
+	port, _ := strconv.Atoi(u.Port())
+	return port
+}
+
+// CreateInstanceRequest 创建实例请求
+type CreateInstanceRequest struct {
+	URL   string `json:"url"`
+	Alias string `json:"alias,omitempty"`
+}
+
+// UpdateInstanceRequest 更新实例请求 (替换隧道 URL 并重启)
+type UpdateInstanceRequest struct {
+	URL string `json:"url"`
+}
+
+// ControlInstanceRequest 实例控制请求
+type ControlInstanceRequest struct {
+	Action string `json:"action"` // start, stop, restart, reset
+}
+
+// MasterInfo Master 系统信息
+type MasterInfo struct {
+	Version string `json:"ver"`
+	OS      string `json:"os"`
+	Arch    string `json:"arch"`
+	Name    string `json:"name"`
+	Uptime  int64  `json:"uptime"` // 运行时长 (秒)
+
+	// 系统资源 (旧版本 Master 不返回，此时为零值)
+	CPU      float64 `json:"cpu"`       // CPU 使用率 (%)
+	MemTotal uint64  `json:"mem_total"` // 内存总量 (Bytes)
+	MemUsed  uint64  `json:"mem_used"`  // 已用内存 (Bytes)
+}
+
+// BuildForwardURL 构造单端转发隧道 URL
+// 在 Master 所在主机监听 listenPort，并将流量转发到 target
+func BuildForwardURL(listenPort int, targetAddress string, targetPort int) string {
+	target := net.JoinHostPort(targetAddress, strconv.Itoa(targetPort))
+	return fmt.Sprintf("client://:%d/%s?mode=1", listenPort, target)
+}
+
 // Ping 测试连接
 func (c *Client) Ping() (bool, error) {
 	// 假设有一个 /ping 接口
@@ -60,10 +151,102 @@ func (c *Client) Ping() (bool, error) {
 	return false, fmt.Errorf("bad status: %d", resp.StatusCode)
 }
 
-// SyncUser 同步用户到节点 (示例)
-func (c *Client) SyncUser(userMap map[string]interface{}) error {
-	data, _ := json.Marshal(userMap)
-	req, err := http.NewRequest("POST", c.BaseURL+"/users/sync", bytes.NewBuffer(data))
+// GetInfo 获取 Master 系统信息
+func (c *Client) GetInfo() (*MasterInfo, error) {
+	var info MasterInfo
+	if err := c.do("GET", "/info", nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// ListInstances 获取实例列表
+func (c *Client) ListInstances() ([]Instance, error) {
+	var instances []Instance
+	if err := c.do("GET", "/instances", nil, &instances); err != nil {
+		return nil, err
+	}
+	return instances, nil
+}
+
+// GetInstance 获取实例详情
+func (c *Client) GetInstance(id string) (*Instance, error) {
+	var instance Instance
+	if err := c.do("GET", "/instances/"+url.PathEscape(id), nil, &instance); err != nil {
+		return nil, err
+	}
+	return &instance, nil
+}
+
+// CreateInstance 通过隧道 URL 创建实例
+func (c *Client) CreateInstance(req *CreateInstanceRequest) (*Instance, error) {
+	if req.URL == "" {
+		return nil, fmt.Errorf("instance url is required")
+	}
+
+	var instance Instance
+	if err := c.do("POST", "/instances", req, &instance); err != nil {
+		return nil, err
+	}
+	return &instance, nil
+}
+
+// UpdateInstance 更新实例隧道 URL
+func (c *Client) UpdateInstance(id string, req *UpdateInstanceRequest) (*Instance, error) {
+	if req.URL == "" {
+		return nil, fmt.Errorf("instance url is required")
+	}
+
+	var instance Instance
+	if err := c.do("PUT", "/instances/"+url.PathEscape(id), req, &instance); err != nil {
+		return nil, err
+	}
+	return &instance, nil
+}
+
+// StartInstance 启动实例
+func (c *Client) StartInstance(id string) (*Instance, error) {
+	return c.controlInstance(id, ActionStart)
+}
+
+// StopInstance 停止实例
+func (c *Client) StopInstance(id string) (*Instance, error) {
+	return c.controlInstance(id, ActionStop)
+}
+
+// RestartInstance 重启实例
+func (c *Client) RestartInstance(id string) (*Instance, error) {
+	return c.controlInstance(id, ActionRestart)
+}
+
+// DeleteInstance 删除实例
+func (c *Client) DeleteInstance(id string) error {
+	return c.do("DELETE", "/instances/"+url.PathEscape(id), nil, nil)
+}
+
+// controlInstance 发送实例控制动作
+func (c *Client) controlInstance(id, action string) (*Instance, error) {
+	var instance Instance
+	body := &ControlInstanceRequest{Action: action}
+	if err := c.do("PATCH", "/instances/"+url.PathEscape(id), body, &instance); err != nil {
+		return nil, err
+	}
+	return &instance, nil
+}
+
+// do 发送请求并通过 GenericResponse 解码数据
+// out 为 nil 时忽略返回数据
+func (c *Client) do(method, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewBuffer(data)
+	}
+
+	req, err := http.NewRequest(method, c.BaseURL+path, reader)
 	if err != nil {
 		return err
 	}
@@ -76,8 +259,34 @@ func (c *Client) SyncUser(userMap map[string]interface{}) error {
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("sync failed: %d", resp.StatusCode)
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	// 成功且无响应体 (如 DELETE 返回 204)
+	success := resp.StatusCode >= 200 && resp.StatusCode < 300
+	if success && len(bytes.TrimSpace(raw)) == 0 {
+		return nil
+	}
+
+	var result GenericResponse
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return fmt.Errorf("%s %s: bad status %d: invalid response", method, path, resp.StatusCode)
+	}
+
+	if !success || !result.Success {
+		if result.Error != "" {
+			return fmt.Errorf("%s %s: %s", method, path, result.Error)
+		}
+		return fmt.Errorf("%s %s: bad status: %d", method, path, resp.StatusCode)
+	}
+
+	if out == nil || len(result.Data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(result.Data, out); err != nil {
+		return fmt.Errorf("%s %s: decode data: %w", method, path, err)
 	}
 	return nil
 }
@@ -85,5 +294,6 @@ func (c *Client) SyncUser(userMap map[string]interface{}) error {
 func (c *Client) setHeaders(req *http.Request) {
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("X-API-Key", c.Token)
 	req.Header.Set("User-Agent", "NyanPass-Panel/1.0")
 }
@@ -0,0 +1,149 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"nodepassPanel/pkg/email"
+	"strings"
+	"time"
+)
+
+// Message 通知消息
+type Message struct {
+	Event   string      `json:"event"`   // 事件类型，如 node_down / node_recovered
+	Title   string      `json:"title"`   // 标题
+	Content string      `json:"content"` // 纯文本正文
+	Data    interface{} `json:"data"`    // 附加结构化数据 (Webhook 原样下发)
+	Time    time.Time   `json:"time"`
+}
+
+// Notifier 通知通道接口
+type Notifier interface {
+	Name() string
+	Send(msg *Message) error
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// EmailNotifier 邮件通知通道
+type EmailNotifier struct {
+	mailer email.Mailer
+	to     []string
+}
+
+// NewEmailNotifier 创建邮件通知通道
+func NewEmailNotifier(to []string) *EmailNotifier {
+	return &EmailNotifier{mailer: email.NewSMTPMailer(), to: to}
+}
+
+// Name 通道名称
+func (n *EmailNotifier) Name() string { return "email" }
+
+// Send 向所有收件人发送邮件，返回最后一个错误
+func (n *EmailNotifier) Send(msg *Message) error {
+	var lastErr error
+	for _, to := range n.to {
+		if err := n.mailer.SendNotice(to, msg.Title, msg.Content); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// WebhookNotifier 通用 Webhook 通知通道
+// 以 JSON POST 下发 Message，配置 secret 时在 X-Signature 头中附带 HMAC-SHA256 签名
+type WebhookNotifier struct {
+	url    string
+	secret string
+}
+
+// NewWebhookNotifier 创建 Webhook 通知通道
+func NewWebhookNotifier(url, secret string) *WebhookNotifier {
+	return &WebhookNotifier{url: url, secret: secret}
+}
+
+// Name 通道名称
+func (n *WebhookNotifier) Name() string { return "webhook" }
+
+// Send 发送 Webhook
+func (n *WebhookNotifier) Send(msg *Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.secret != "" {
+		mac := hmac.New(sha256.New, []byte(n.secret))
+		mac.Write(body)
+		req.Header.Set("X-Signature", hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	return doRequest(req)
+}
+
+// TelegramNotifier Telegram Bot 通知通道
+type TelegramNotifier struct {
+	botToken string
+	chatID   string
+}
+
+// NewTelegramNotifier 创建 Telegram 通知通道
+func NewTelegramNotifier(botToken, chatID string) *TelegramNotifier {
+	return &TelegramNotifier{botToken: botToken, chatID: chatID}
+}
+
+// Name 通道名称
+func (n *TelegramNotifier) Name() string { return "telegram" }
+
+// Send 发送 Telegram 消息
+func (n *TelegramNotifier) Send(msg *Message) error {
+	form := url.Values{}
+	form.Set("chat_id", n.chatID)
+	form.Set("text", msg.Title+"\n\n"+msg.Content)
+	form.Set("disable_web_page_preview", "true")
+
+	endpoint := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", n.botToken)
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewBufferString(form.Encode()))
+	if err != nil {
+		return n.redact(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return n.redact(doRequest(req))
+}
+
+// redact 隐去错误信息中的 Bot Token (请求失败时 *url.Error 包含完整 URL)
+func (n *TelegramNotifier) redact(err error) error {
+	if err == nil || n.botToken == "" {
+		return err
+	}
+	return errors.New(strings.ReplaceAll(err.Error(), n.botToken, "<token>"))
+}
+
+// doRequest 执行请求，非 2xx 响应视为失败
+func doRequest(req *http.Request) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
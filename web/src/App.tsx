@@ -11,6 +11,7 @@ import AdminOrdersPage from './pages/admin/Orders';
 import AnnouncementsPage from './pages/admin/Announcements';
 import AdminSettingsPage from './pages/admin/Settings';
 import AdminCouponsPage from './pages/admin/Coupons';
+import AdminBalanceLogsPage from './pages/admin/BalanceLogs';
 
 // 用户布局和页面
 import UserLayout from './layouts/UserLayout';
@@ -48,6 +49,7 @@ function App() {
           <Route path="announcements" element={<AnnouncementsPage />} />
           <Route path="settings" element={<AdminSettingsPage />} />
           <Route path="coupons" element={<AdminCouponsPage />} />
+          <Route path="balance-logs" element={<AdminBalanceLogsPage />} />
         </Route>
 
         {/* 默认重定向到用户面板 */}
@@ -1,6 +1,6 @@
-import { useState } from 'react';
-import { useMutation, useQueryClient } from '@tanstack/react-query';
-import { Wallet, CreditCard, RefreshCw } from 'lucide-react';
+import { useEffect, useState } from 'react';
+import { useMutation, useQuery, useQueryClient } from '@tanstack/react-query';
+import { Wallet, CreditCard, RefreshCw, Copy } from 'lucide-react';
 import api from '../../lib/api';
 import Modal from '../ui/Modal';
 import { useToast } from '../ui/Toast';
@@ -15,6 +15,25 @@ interface PaymentModalProps {
     allowBalance?: boolean; // 是否允许余额支付 (充值订单不允许余额支付)
 }
 
+// 后端 /payment/methods 返回的支付方式
+interface PaymentMethodInfo {
+    method: string;
+    label: string;
+    gateway: string;
+    display_name: string;
+    fee_percent: number;
+    order_types: string[] | null;
+}
+
+// USDT 收款信息
+interface CryptoInfo {
+    network: string;
+    address: string;
+    amount: string;
+    rate: number;
+    expires_at: string;
+}
+
 export default function PaymentModal({
     isOpen,
     onClose,
@@ -24,16 +43,30 @@ export default function PaymentModal({
     onSuccess,
     allowBalance = true
 }: PaymentModalProps) {
-    const [paymentMethod, setPaymentMethod] = useState(allowBalance ? 'balance' : 'alipay');
+    const [paymentMethod, setPaymentMethod] = useState(allowBalance ? 'balance' : '');
+    const [crypto, setCrypto] = useState<CryptoInfo | null>(null);
     const toast = useToast();
     const queryClient = useQueryClient();
+    const orderType = allowBalance ? 'plan' : 'recharge';
+
+    // 获取管理员启用的支付方式
+    const { data: methods = [], isLoading: methodsLoading } = useQuery<PaymentMethodInfo[]>({
+        queryKey: ['payment-methods', orderType],
+        queryFn: () => api.get('/payment/methods', { params: { order_type: orderType } }).then(res => res.data.data),
+        enabled: isOpen,
+    });
+    const gatewayMethods = methods.filter(m => m.method !== 'balance');
+    const selected = methods.find(m => m.method === paymentMethod);
+    const fee = selected?.fee_percent ? Math.round(amount * selected.fee_percent) / 100 : 0;
 
     // 支付订单
     const payMutation = useMutation({
         mutationFn: (data: { order_no: string; method: string }) => api.post('/user/payment/pay', data),
         onSuccess: (res) => {
-            const { pay_url, content_type } = res.data.data;
-            if (content_type === 'success') {
+            const { pay_url, content_type, crypto } = res.data.data;
+            if (content_type === 'crypto') {
+                setCrypto(crypto);
+            } else if (content_type === 'success') {
                 toast.success('支付成功！');
                 queryClient.invalidateQueries({ queryKey: ['user-profile'] }); // Update balance
                 if (onSuccess) onSuccess();
@@ -56,15 +89,31 @@ export default function PaymentModal({
         });
     };
 
-    // 如果不允许余额支付且当前选中的是余额，自动切换到第一个可用
-    if (!allowBalance && paymentMethod === 'balance') {
-        setPaymentMethod('alipay');
-    }
+    const copy = async (text: string) => {
+        try {
+            await navigator.clipboard.writeText(text);
+            toast.success('已复制');
+        } catch {
+            toast.error('复制失败');
+        }
+    };
+
+    const handleClose = () => {
+        setCrypto(null);
+        onClose();
+    };
+
+    // 当前选中的方式不可用时，自动切换到第一个可用
+    useEffect(() => {
+        if (methodsLoading || methods.some(m => m.method === paymentMethod)) return;
+        const first = (allowBalance ? methods : gatewayMethods)[0];
+        setPaymentMethod(first ? first.method : '');
+    }, [methods, methodsLoading, paymentMethod, allowBalance]);
 
     return (
         <Modal
             isOpen={isOpen}
-            onClose={onClose}
+            onClose={handleClose}
             title={
                 <div>
                     <h3 className="text-lg font-semibold text-slate-900">支付订单</h3>
@@ -72,7 +121,14 @@ export default function PaymentModal({
                 </div>
             }
             width="sm"
-            footer={
+            footer={crypto ? (
+                <button
+                    onClick={handleClose}
+                    className="w-full py-2 bg-white border border-slate-200 hover:bg-slate-50 text-slate-700 rounded-lg transition"
+                >
+                    我已转账，到账后自动完成
+                </button>
+            ) : (
                 <div className="flex gap-3">
                     <button
                         onClick={onClose}
@@ -82,81 +138,109 @@ export default function PaymentModal({
                     </button>
                     <button
                         onClick={handleConfirmPay}
-                        disabled={payMutation.isPending || (paymentMethod === 'balance' && balance < amount)}
+                        disabled={payMutation.isPending || !paymentMethod || (paymentMethod === 'balance' && balance < amount)}
                         className="flex-1 py-2 bg-primary hover:bg-primary/90 text-white rounded-lg transition disabled:opacity-50 flex items-center justify-center gap-2 shadow-lg shadow-primary/25"
                     >
                         {payMutation.isPending ? <RefreshCw className="w-4 h-4 animate-spin" /> : '确认支付'}
                     </button>
                 </div>
-            }
+            )}
         >
-            <div className="space-y-6">
-                <div className="text-center py-2">
-                    <p className="text-sm text-slate-500 mb-1">支付金额</p>
-                    <p className="text-4xl font-bold text-primary">¥{amount.toFixed(2)}</p>
+            {crypto ? (
+                <div className="space-y-4">
+                    <div className="text-center py-2">
+                        <p className="text-sm text-slate-500 mb-1">请转账 USDT ({crypto.network.toUpperCase()})</p>
+                        <button onClick={() => copy(crypto.amount)} className="inline-flex items-center gap-2 text-3xl font-bold text-primary">
+                            {crypto.amount}
+                            <Copy className="w-4 h-4" />
+                        </button>
+                        <p className="text-xs text-slate-500 mt-1">汇率 1 USDT = ¥{crypto.rate}，请转入精确金额，否则无法自动确认</p>
+                    </div>
+                    <div className="p-3 bg-slate-50 border border-slate-200 rounded-lg">
+                        <p className="text-xs text-slate-500 mb-1">收款地址</p>
+                        <button onClick={() => copy(crypto.address)} className="w-full flex items-center justify-between gap-2 font-mono text-sm text-slate-900 break-all text-left">
+                            {crypto.address}
+                            <Copy className="w-4 h-4 shrink-0 text-slate-400" />
+                        </button>
+                    </div>
+                    <p className="text-xs text-slate-500 text-center">
+                        请在 {new Date(crypto.expires_at).toLocaleString()} 前完成转账，超时订单将自动取消
+                    </p>
                 </div>
+            ) : (
+                <div className="space-y-6">
+                    <div className="text-center py-2">
+                        <p className="text-sm text-slate-500 mb-1">支付金额</p>
+                        <p className="text-4xl font-bold text-primary">¥{(amount + fee).toFixed(2)}</p>
+                        {fee > 0 && (
+                            <p className="text-xs text-slate-500 mt-1">含手续费 ¥{fee.toFixed(2)} ({selected?.fee_percent}%)</p>
+                        )}
+                    </div>
 
-                <div className="space-y-3">
-                    <label className="text-sm font-medium text-slate-700">选择支付方式</label>
                     <div className="space-y-3">
-                        {allowBalance && (
-                            <button
-                                onClick={() => setPaymentMethod('balance')}
-                                className={`w-full flex items-center justify-between p-4 rounded-xl border-2 transition-all duration-200 ${paymentMethod === 'balance'
-                                    ? 'border-primary bg-primary/5 shadow-sm'
-                                    : 'border-slate-100 hover:border-slate-300 hover:bg-slate-50'
-                                    }`}
-                            >
-                                <div className="flex items-center gap-4">
-                                    <div className="p-2.5 bg-white border border-slate-200 rounded-lg text-slate-600 shadow-sm">
-                                        <Wallet className="w-6 h-6" />
-                                    </div>
-                                    <div className="text-left">
-                                        <p className="font-medium text-slate-900">余额支付</p>
-                                        <p className="text-xs text-slate-500 mt-0.5">当前余额: ¥{balance.toFixed(2)}</p>
+                        <label className="text-sm font-medium text-slate-700">选择支付方式</label>
+                        <div className="space-y-3">
+                            {allowBalance && methods.some(m => m.method === 'balance') && (
+                                <button
+                                    onClick={() => setPaymentMethod('balance')}
+                                    className={`w-full flex items-center justify-between p-4 rounded-xl border-2 transition-all duration-200 ${paymentMethod === 'balance'
+                                        ? 'border-primary bg-primary/5 shadow-sm'
+                                        : 'border-slate-100 hover:border-slate-300 hover:bg-slate-50'
+                                        }`}
+                                >
+                                    <div className="flex items-center gap-4">
+                                        <div className="p-2.5 bg-white border border-slate-200 rounded-lg text-slate-600 shadow-sm">
+                                            <Wallet className="w-6 h-6" />
+                                        </div>
+                                        <div className="text-left">
+                                            <p className="font-medium text-slate-900">余额支付</p>
+                                            <p className="text-xs text-slate-500 mt-0.5">当前余额: ¥{balance.toFixed(2)}</p>
+                                        </div>
                                     </div>
-                                </div>
-                                {paymentMethod === 'balance' && (
-                                    <div className="w-5 h-5 rounded-full bg-primary flex items-center justify-center">
-                                        <div className="w-2 h-2 rounded-full bg-white" />
-                                    </div>
-                                )}
-                            </button>
-                        )}
+                                    {paymentMethod === 'balance' && (
+                                        <div className="w-5 h-5 rounded-full bg-primary flex items-center justify-center">
+                                            <div className="w-2 h-2 rounded-full bg-white" />
+                                        </div>
+                                    )}
+                                </button>
+                            )}
 
-                        {/* 其他支付方式 */}
-                        {['alipay', 'stripe'].map(method => (
-                            <button
-                                key={method}
-                                onClick={() => setPaymentMethod(method)}
-                                className={`w-full flex items-center justify-between p-4 rounded-xl border-2 transition-all duration-200 ${paymentMethod === method
-                                    ? 'border-primary bg-primary/5 shadow-sm'
-                                    : 'border-slate-100 hover:border-slate-300 hover:bg-slate-50'
-                                    }`}
-                            >
-                                <div className="flex items-center gap-4">
-                                    <div className="p-2.5 bg-blue-50 text-blue-600 border border-blue-100 rounded-lg shadow-sm">
-                                        <CreditCard className="w-6 h-6" />
-                                    </div>
-                                    <div className="text-left">
-                                        <p className="font-medium text-slate-900">
-                                            {method === 'alipay' ? '支付宝' : 'Stripe / 信用卡'}
-                                        </p>
-                                        <p className="text-xs text-slate-500 mt-0.5">
-                                            {method === 'alipay' ? '快捷支付' : '安全支付'}
-                                        </p>
+                            {/* 其他支付方式 */}
+                            {gatewayMethods.map(({ method, label, display_name, fee_percent }) => (
+                                <button
+                                    key={method}
+                                    onClick={() => setPaymentMethod(method)}
+                                    className={`w-full flex items-center justify-between p-4 rounded-xl border-2 transition-all duration-200 ${paymentMethod === method
+                                        ? 'border-primary bg-primary/5 shadow-sm'
+                                        : 'border-slate-100 hover:border-slate-300 hover:bg-slate-50'
+                                        }`}
+                                >
+                                    <div className="flex items-center gap-4">
+                                        <div className="p-2.5 bg-blue-50 text-blue-600 border border-blue-100 rounded-lg shadow-sm">
+                                            <CreditCard className="w-6 h-6" />
+                                        </div>
+                                        <div className="text-left">
+                                            <p className="font-medium text-slate-900">{label}</p>
+                                            <p className="text-xs text-slate-500 mt-0.5">
+                                                {display_name}{fee_percent > 0 && ` · 手续费 ${fee_percent}%`}
+                                            </p>
+                                        </div>
                                     </div>
-                                </div>
-                                {paymentMethod === method && (
-                                    <div className="w-5 h-5 rounded-full bg-primary flex items-center justify-center">
-                                        <div className="w-2 h-2 rounded-full bg-white" />
-                                    </div>
-                                )}
-                            </button>
-                        ))}
+                                    {paymentMethod === method && (
+                                        <div className="w-5 h-5 rounded-full bg-primary flex items-center justify-center">
+                                            <div className="w-2 h-2 rounded-full bg-white" />
+                                        </div>
+                                    )}
+                                </button>
+                            ))}
+
+                            {!methodsLoading && methods.length === 0 && (
+                                <p className="text-sm text-slate-500 text-center py-4">暂无可用的支付方式</p>
+                            )}
+                        </div>
                     </div>
                 </div>
-            </div>
+            )}
         </Modal>
     );
 }
@@ -14,7 +14,8 @@ import {
     LogOut,
     ChevronDown,
     Ticket,
-    Tag
+    Tag,
+    Wallet
 } from 'lucide-react';
 import { clsx } from 'clsx';
 import api from '../lib/api';
@@ -26,6 +27,7 @@ const navItems = [
     { path: '/admin/nodes', icon: Server, label: '节点管理' },
     { path: '/admin/plans', icon: Package, label: '套餐管理' },
     { path: '/admin/orders', icon: ShoppingCart, label: '订单管理' },
+    { path: '/admin/balance-logs', icon: Wallet, label: '资金流水' },
     { path: '/admin/recharge-codes', icon: Ticket, label: '充值卡密' },
     { path: '/admin/coupons', icon: Tag, label: '优惠券' },
     { path: '/admin/announcements', icon: Megaphone, label: '公告管理' },
@@ -0,0 +1,231 @@
+import { useState } from 'react';
+import { useQuery } from '@tanstack/react-query';
+import { RefreshCw, Wallet, Search } from 'lucide-react';
+import api from '../../lib/api';
+
+interface BalanceLog {
+    id: number;
+    txn_no: string;
+    user_id: number;
+    account: string;
+    type: string;
+    amount: number;
+    balance_after: number;
+    order_id: number;
+    admin_id: number;
+    memo: string;
+    created_at: string;
+}
+
+interface BalanceLogListResponse {
+    list: BalanceLog[];
+    total: number;
+    page: number;
+    page_size: number;
+}
+
+const accountLabels: Record<string, string> = {
+    balance: '余额',
+    commission: '佣金',
+    system_gateway: '支付网关',
+    system_revenue: '销售收入',
+    system_adjustment: '管理员调账',
+    system_referral: '邀请返利',
+};
+
+const typeLabels: Record<string, string> = {
+    recharge: '在线充值',
+    recharge_refund: '充值退款',
+    purchase: '余额购买',
+    refund: '订单退款',
+    admin_charge: '管理员充值',
+    admin_adjust: '管理员调整',
+    commission: '邀请返利',
+};
+
+// 资金流水审计页面
+export default function BalanceLogsPage() {
+    const [page, setPage] = useState(1);
+    const [userId, setUserId] = useState('');
+    const [typeFilter, setTypeFilter] = useState('');
+    const [system, setSystem] = useState(false);
+
+    const { data, isLoading, refetch } = useQuery<{ data: BalanceLogListResponse }>({
+        queryKey: ['admin-balance-logs', page, userId, typeFilter, system],
+        queryFn: () => api.get('/admin/balance/logs', {
+            params: {
+                page,
+                page_size: 20,
+                user_id: userId || undefined,
+                type: typeFilter || undefined,
+                system: system || undefined,
+            }
+        }).then(res => res.data),
+    });
+
+    const logs = data?.data?.list || [];
+    const total = data?.data?.total || 0;
+    const totalPages = Math.ceil(total / 20);
+
+    return (
+        <div className="space-y-6">
+            {/* 页面标题 */}
+            <div>
+                <h1 className="text-2xl font-bold text-slate-900">资金流水</h1>
+                <p className="text-slate-500 mt-1">审计用户余额与佣金的每一笔变动</p>
+            </div>
+
+            {/* 筛选栏 */}
+            <div className="flex items-center gap-4 flex-wrap bg-white p-4 border border-slate-200 rounded-xl shadow-sm">
+                <div className="flex items-center gap-2 flex-1 min-w-[200px]">
+                    <Search className="w-4 h-4 text-slate-400" />
+                    <input
+                        type="number"
+                        value={userId}
+                        onChange={(e) => {
+                            setUserId(e.target.value);
+                            setPage(1);
+                        }}
+                        placeholder="用户ID"
+                        className="flex-1 bg-transparent border-none focus:outline-none text-sm text-slate-700 placeholder:text-slate-400"
+                    />
+                </div>
+                <div className="w-px h-6 bg-slate-200 mx-2" />
+                <div className="flex items-center gap-2">
+                    <span className="text-sm text-slate-500">类型：</span>
+                    <select
+                        value={typeFilter}
+                        onChange={(e) => {
+                            setTypeFilter(e.target.value);
+                            setPage(1);
+                        }}
+                        className="bg-slate-50 border border-slate-200 rounded-lg px-3 py-2 text-slate-900 text-sm focus:outline-none focus:border-primary"
+                    >
+                        <option value="">全部</option>
+                        {Object.entries(typeLabels).map(([value, label]) => (
+                            <option key={value} value={value}>{label}</option>
+                        ))}
+                    </select>
+                </div>
+                <label className="flex items-center gap-2 text-sm text-slate-500">
+                    <input
+                        type="checkbox"
+                        checked={system}
+                        onChange={(e) => {
+                            setSystem(e.target.checked);
+                            setPage(1);
+                        }}
+                    />
+                    包含系统账户
+                </label>
+                <div className="flex-1" />
+                <button
+                    onClick={() => refetch()}
+                    className="p-2.5 bg-slate-50 hover:bg-slate-100 text-slate-600 rounded-lg transition border border-slate-200"
+                    title="刷新"
+                >
+                    <RefreshCw className="w-4 h-4" />
+                </button>
+            </div>
+
+            {/* 流水列表 */}
+            <div className="bg-white border border-slate-200 rounded-xl overflow-hidden shadow-sm">
+                <div className="overflow-x-auto">
+                    <table className="w-full">
+                        <thead className="bg-slate-50">
+                            <tr className="border-b border-slate-200">
+                                <th className="px-6 py-4 text-left text-xs font-medium text-slate-500 uppercase">时间</th>
+                                <th className="px-6 py-4 text-left text-xs font-medium text-slate-500 uppercase">用户</th>
+                                <th className="px-6 py-4 text-left text-xs font-medium text-slate-500 uppercase">账户</th>
+                                <th className="px-6 py-4 text-left text-xs font-medium text-slate-500 uppercase">类型</th>
+                                <th className="px-6 py-4 text-right text-xs font-medium text-slate-500 uppercase">金额</th>
+                                <th className="px-6 py-4 text-right text-xs font-medium text-slate-500 uppercase">变动后</th>
+                                <th className="px-6 py-4 text-left text-xs font-medium text-slate-500 uppercase">备注</th>
+                            </tr>
+                        </thead>
+                        <tbody className="divide-y divide-slate-100">
+                            {isLoading ? (
+                                <tr>
+                                    <td colSpan={7} className="px-6 py-8 text-center text-slate-500">
+                                        加载中...
+                                    </td>
+                                </tr>
+                            ) : logs.length === 0 ? (
+                                <tr>
+                                    <td colSpan={7} className="px-6 py-8 text-center text-slate-500">
+                                        <Wallet className="w-12 h-12 mx-auto mb-4 opacity-50" />
+                                        <p>暂无流水</p>
+                                    </td>
+                                </tr>
+                            ) : (
+                                logs.map((log) => (
+                                    <tr key={log.id} className="hover:bg-slate-50 transition">
+                                        <td className="px-6 py-4">
+                                            <div className="flex flex-col">
+                                                <span className="text-sm text-slate-500">
+                                                    {new Date(log.created_at).toLocaleString('zh-CN')}
+                                                </span>
+                                                <span className="font-mono text-xs text-slate-400">{log.txn_no.slice(0, 8)}</span>
+                                            </div>
+                                        </td>
+                                        <td className="px-6 py-4">
+                                            <span className="text-sm text-slate-900">
+                                                {log.user_id ? `ID: ${log.user_id}` : '系统'}
+                                            </span>
+                                        </td>
+                                        <td className="px-6 py-4">
+                                            <span className="text-sm text-slate-500">{accountLabels[log.account] || log.account}</span>
+                                        </td>
+                                        <td className="px-6 py-4">
+                                            <span className="text-sm text-slate-900">{typeLabels[log.type] || log.type}</span>
+                                        </td>
+                                        <td className="px-6 py-4 text-right">
+                                            <span className={`text-sm font-medium ${log.amount >= 0 ? 'text-green-600' : 'text-red-600'}`}>
+                                                {log.amount >= 0 ? '+' : ''}{log.amount.toFixed(2)}
+                                            </span>
+                                        </td>
+                                        <td className="px-6 py-4 text-right">
+                                            <span className="text-sm text-slate-500">
+                                                {log.user_id ? `¥${log.balance_after.toFixed(2)}` : '-'}
+                                            </span>
+                                        </td>
+                                        <td className="px-6 py-4">
+                                            <span className="text-sm text-slate-500">
+                                                {log.memo || '-'}
+                                                {log.admin_id > 0 && ` (管理员 ${log.admin_id})`}
+                                            </span>
+                                        </td>
+                                    </tr>
+                                ))
+                            )}
+                        </tbody>
+                    </table>
+                </div>
+
+                {/* 分页 */}
+                {totalPages > 1 && (
+                    <div className="flex items-center justify-between px-6 py-4 border-t border-slate-200">
+                        <p className="text-sm text-slate-500">共 {total} 条</p>
+                        <div className="flex items-center gap-2">
+                            <button
+                                onClick={() => setPage(p => Math.max(1, p - 1))}
+                                disabled={page === 1}
+                                className="px-3 py-1.5 bg-white hover:bg-slate-50 text-slate-600 border border-slate-200 rounded-lg transition disabled:opacity-50"
+                            >
+                                上一页
+                            </button>
+                            <span className="text-sm text-slate-500">{page} / {totalPages}</span>
+                            <button
+                                onClick={() => setPage(p => Math.min(totalPages, p + 1))}
+                                disabled={page === totalPages}
+                                className="px-3 py-1.5 bg-white hover:bg-slate-50 text-slate-600 border border-slate-200 rounded-lg transition disabled:opacity-50"
+                            >
+                                下一页
+                            </button>
+                        </div>
+                    </div>
+                )}
+            </div>
+        </div>
+    );
+}
@@ -24,6 +24,7 @@ interface Coupon {
     total_limit: number;
     used_count: number;
     plan_ids: string;
+    periods: string;
     start_at: number;
     expired_at: number;
     status: number;
@@ -46,6 +47,7 @@ interface CouponFormData {
     limit_per_user: number;
     total_limit: number;
     plan_ids: string;
+    periods: string;
     start_at: string; // YYYY-MM-DDTHH:mm
     expired_at: string; // YYYY-MM-DDTHH:mm
     status: number;
@@ -60,6 +62,7 @@ const initialFormState: CouponFormData = {
     limit_per_user: 1,
     total_limit: 0,
     plan_ids: '',
+    periods: '',
     start_at: '',
     expired_at: '',
     status: 1,
@@ -147,6 +150,7 @@ export default function CouponsPage() {
             limit_per_user: coupon.limit_per_user,
             total_limit: coupon.total_limit,
             plan_ids: coupon.plan_ids || '',
+            periods: coupon.periods || '',
             start_at: coupon.start_at ? new Date(coupon.start_at * 1000).toISOString().slice(0, 16) : '',
             // Assuming start_at is timestamp in seconds from backend based on my interface definition in this file (lines 28-29)
             // Wait, my interface specific start_at: number.
@@ -449,6 +453,16 @@ export default function CouponsPage() {
                                         placeholder="例如: 1,2,3"
                                     />
                                 </div>
+                                <div className="col-span-2">
+                                    <label className="block text-sm text-slate-700 mb-1">指定计费周期 (逗号分隔，留空所有)</label>
+                                    <input
+                                        type="text"
+                                        value={formData.periods}
+                                        onChange={(e) => setFormData({ ...formData, periods: e.target.value })}
+                                        className="w-full bg-slate-50 border border-slate-200 rounded px-3 py-2 text-slate-900 focus:outline-none focus:border-primary"
+                                        placeholder="monthly, quarterly, half_yearly, yearly, onetime"
+                                    />
+                                </div>
                                 <div>
                                     <label className="block text-sm text-slate-700 mb-1">开始时间</label>
                                     <input
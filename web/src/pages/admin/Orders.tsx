@@ -7,7 +7,8 @@ import {
     XCircle,
     Clock,
     RotateCcw,
-    Search
+    Search,
+    AlertTriangle
 } from 'lucide-react';
 import api from '../../lib/api';
 
@@ -40,6 +41,8 @@ const statusConfig: Record<number, { label: string; color: string; icon: typeof
     1: { label: '已支付', color: 'text-green-600 bg-green-50 border border-green-100', icon: CheckCircle },
     2: { label: '已取消', color: 'text-slate-500 bg-slate-50 border border-slate-100', icon: XCircle },
     3: { label: '已退款', color: 'text-red-600 bg-red-50 border border-red-100', icon: RotateCcw },
+    4: { label: '待审核', color: 'text-orange-600 bg-orange-50 border border-orange-100', icon: AlertTriangle },
+    5: { label: '退款中', color: 'text-purple-600 bg-purple-50 border border-purple-100', icon: RotateCcw },
 };
 
 // 订单管理页面
@@ -57,7 +60,7 @@ export default function OrdersPage() {
     });
 
     const markPaidMutation = useMutation({
-        mutationFn: (id: number) => api.post(`/admin/orders/${id}/paid`, { pay_method: 'manual' }),
+        mutationFn: (order: Order) => api.post(`/admin/orders/${order.id}/paid`, { pay_method: order.pay_method || 'manual' }),
         onSuccess: () => {
             queryClient.invalidateQueries({ queryKey: ['admin-orders'] });
         },
@@ -76,7 +79,7 @@ export default function OrdersPage() {
 
     const handleMarkPaid = (order: Order) => {
         if (confirm(`确定要将订单 ${order.order_no} 标记为已支付吗？`)) {
-            markPaidMutation.mutate(order.id);
+            markPaidMutation.mutate(order);
         }
     };
 
@@ -125,6 +128,8 @@ export default function OrdersPage() {
                         <option value="1">已支付</option>
                         <option value="2">已取消</option>
                         <option value="3">已退款</option>
+                        <option value="4">待审核</option>
+                        <option value="5">退款中</option>
                     </select>
                 </div>
                 <div className="flex-1" />
@@ -209,7 +214,7 @@ export default function OrdersPage() {
                                             </td>
                                             <td className="px-6 py-4 text-right">
                                                 <div className="flex items-center justify-end gap-2">
-                                                    {order.status === 0 && (
+                                                    {(order.status === 0 || order.status === 4) && (
                                                         <button
                                                             onClick={() => handleMarkPaid(order)}
                                                             className="px-3 py-1.5 text-xs bg-green-50 text-green-600 hover:bg-green-100 border border-green-200 rounded transition"
@@ -217,7 +222,7 @@ export default function OrdersPage() {
                                                             确认支付
                                                         </button>
                                                     )}
-                                                    {order.status === 1 && (
+                                                    {(order.status === 1 || order.status === 4) && (
                                                         <button
                                                             onClick={() => handleRefund(order)}
                                                             className="px-3 py-1.5 text-xs bg-red-50 text-red-600 hover:bg-red-100 border border-red-200 rounded transition"
@@ -12,12 +12,20 @@ import {
 } from 'lucide-react';
 import api from '../../lib/api';
 
+interface PlanPrice {
+    period: string;
+    price: number;
+    duration: number;
+    reset_policy: string;
+}
+
 interface Plan {
     id: number;
     name: string;
     description: string;
     price: number;
     duration: number;
+    prices: PlanPrice[];
     transfer: number;
     speed_limit: number;
     device_limit: number;
@@ -30,8 +38,7 @@ interface Plan {
 interface PlanFormData {
     name: string;
     description: string;
-    price: number;
-    duration: number;
+    prices: PlanPrice[];
     transfer: number;
     speed_limit: number;
     device_limit: number;
@@ -40,11 +47,28 @@ interface PlanFormData {
     sort: number;
 }
 
+const periodOptions: { value: string; label: string; duration: number }[] = [
+    { value: 'monthly', label: '月付', duration: 30 },
+    { value: 'quarterly', label: '季付', duration: 90 },
+    { value: 'half_yearly', label: '半年付', duration: 180 },
+    { value: 'yearly', label: '年付', duration: 365 },
+    { value: 'onetime', label: '流量包', duration: 0 },
+];
+
+const periodLabels: Record<string, string> = Object.fromEntries(
+    periodOptions.map(option => [option.value, option.label])
+);
+
+const resetPolicyLabels: Record<string, string> = {
+    none: '不重置',
+    purchase: '购买时重置',
+    monthly: '每月重置',
+};
+
 const defaultFormData: PlanFormData = {
     name: '',
     description: '',
-    price: 0,
-    duration: 30,
+    prices: [{ period: 'monthly', price: 0, duration: 30, reset_policy: 'none' }],
     transfer: 100,
     speed_limit: 0,
     device_limit: 0,
@@ -98,8 +122,9 @@ export default function PlansPage() {
         setFormData({
             name: plan.name,
             description: plan.description,
-            price: plan.price,
-            duration: plan.duration,
+            prices: (plan.prices || []).map(({ period, price, duration, reset_policy }) => ({
+                period, price, duration, reset_policy,
+            })),
             transfer: plan.transfer,
             speed_limit: plan.speed_limit,
             device_limit: plan.device_limit,
@@ -142,6 +167,34 @@ export default function PlansPage() {
         }
     };
 
+    // 计费周期编辑
+    const updatePrice = (index: number, patch: Partial<PlanPrice>) => {
+        const prices = formData.prices.map((item, i) => {
+            if (i !== index) return item;
+            const next = { ...item, ...patch };
+            // 切换周期时带出默认有效期，流量包不设有效期与重置
+            if (patch.period) {
+                next.duration = periodOptions.find(option => option.value === patch.period)?.duration ?? next.duration;
+                if (patch.period === 'onetime') next.reset_policy = 'none';
+            }
+            return next;
+        });
+        setFormData({ ...formData, prices });
+    };
+
+    const addPrice = () => {
+        const unused = periodOptions.find(option => !formData.prices.some(item => item.period === option.value));
+        if (!unused) return;
+        setFormData({
+            ...formData,
+            prices: [...formData.prices, { period: unused.value, price: 0, duration: unused.duration, reset_policy: 'none' }],
+        });
+    };
+
+    const removePrice = (index: number) => {
+        setFormData({ ...formData, prices: formData.prices.filter((_, i) => i !== index) });
+    };
+
     // 删除套餐
     const handleDelete = (plan: Plan) => {
         if (confirm(`确定要删除套餐 "${plan.name}" 吗？此操作不可恢复！`)) {
@@ -228,7 +281,15 @@ export default function PlansPage() {
                             {/* 价格 */}
                             <div className="mb-4">
                                 <span className="text-3xl font-bold text-slate-900">¥{plan.price}</span>
-                                <span className="text-slate-500">/{plan.duration}天</span>
+                                <span className="text-slate-500">/{plan.duration > 0 ? `${plan.duration}天` : '流量包'} 起</span>
+                                <div className="flex flex-wrap gap-1.5 mt-2">
+                                    {(plan.prices || []).map((item) => (
+                                        <span key={item.period} className="px-2 py-0.5 text-xs bg-slate-100 text-slate-600 rounded">
+                                            {periodLabels[item.period] || item.period} ¥{item.price}
+                                            {item.reset_policy !== 'none' && ` · ${resetPolicyLabels[item.reset_policy]}`}
+                                        </span>
+                                    ))}
+                                </div>
                             </div>
 
                             {/* 套餐详情 */}
@@ -321,35 +382,84 @@ export default function PlansPage() {
                                 />
                             </div>
 
-                            {/* 价格和时长 */}
-                            <div className="grid grid-cols-2 gap-4">
-                                <div>
-                                    <label className="block text-sm font-medium text-slate-700 mb-2">
-                                        价格 (元) <span className="text-red-400">*</span>
+                            {/* 计费周期 */}
+                            <div>
+                                <div className="flex items-center justify-between mb-2">
+                                    <label className="block text-sm font-medium text-slate-700">
+                                        计费周期 <span className="text-red-400">*</span>
                                     </label>
-                                    <input
-                                        type="number"
-                                        value={formData.price}
-                                        onChange={(e) => setFormData({ ...formData, price: Number(e.target.value) })}
-                                        required
-                                        min={0}
-                                        step={0.01}
-                                        className="w-full px-4 py-2.5 bg-white border border-slate-200 rounded-lg text-slate-900 focus:outline-none focus:border-primary"
-                                    />
+                                    <button
+                                        type="button"
+                                        onClick={addPrice}
+                                        disabled={formData.prices.length >= periodOptions.length}
+                                        className="flex items-center gap-1 text-sm text-primary hover:underline disabled:opacity-50"
+                                    >
+                                        <Plus className="w-3 h-3" />
+                                        添加周期
+                                    </button>
                                 </div>
-                                <div>
-                                    <label className="block text-sm font-medium text-slate-700 mb-2">
-                                        时长 (天) <span className="text-red-400">*</span>
-                                    </label>
-                                    <input
-                                        type="number"
-                                        value={formData.duration}
-                                        onChange={(e) => setFormData({ ...formData, duration: Number(e.target.value) })}
-                                        required
-                                        min={1}
-                                        className="w-full px-4 py-2.5 bg-white border border-slate-200 rounded-lg text-slate-900 focus:outline-none focus:border-primary"
-                                    />
+                                <div className="space-y-2">
+                                    {formData.prices.map((item, index) => (
+                                        <div key={index} className="grid grid-cols-[1fr_1fr_1fr_1.2fr_auto] gap-2 items-center">
+                                            <select
+                                                value={item.period}
+                                                onChange={(e) => updatePrice(index, { period: e.target.value })}
+                                                className="px-2 py-2 bg-white border border-slate-200 rounded-lg text-sm text-slate-900 focus:outline-none focus:border-primary"
+                                            >
+                                                {periodOptions.map((option) => (
+                                                    <option
+                                                        key={option.value}
+                                                        value={option.value}
+                                                        disabled={option.value !== item.period && formData.prices.some(p => p.period === option.value)}
+                                                    >
+                                                        {option.label}
+                                                    </option>
+                                                ))}
+                                            </select>
+                                            <input
+                                                type="number"
+                                                value={item.price}
+                                                onChange={(e) => updatePrice(index, { price: Number(e.target.value) })}
+                                                required
+                                                min={0}
+                                                step={0.01}
+                                                title="价格 (元)"
+                                                className="px-2 py-2 bg-white border border-slate-200 rounded-lg text-sm text-slate-900 focus:outline-none focus:border-primary"
+                                            />
+                                            <input
+                                                type="number"
+                                                value={item.duration}
+                                                onChange={(e) => updatePrice(index, { duration: Number(e.target.value) })}
+                                                required
+                                                min={item.period === 'onetime' ? 0 : 1}
+                                                max={item.period === 'onetime' ? 0 : undefined}
+                                                disabled={item.period === 'onetime'}
+                                                title="时长 (天)"
+                                                className="px-2 py-2 bg-white border border-slate-200 rounded-lg text-sm text-slate-900 focus:outline-none focus:border-primary disabled:bg-slate-50"
+                                            />
+                                            <select
+                                                value={item.reset_policy}
+                                                onChange={(e) => updatePrice(index, { reset_policy: e.target.value })}
+                                                disabled={item.period === 'onetime'}
+                                                className="px-2 py-2 bg-white border border-slate-200 rounded-lg text-sm text-slate-900 focus:outline-none focus:border-primary disabled:bg-slate-50"
+                                            >
+                                                {Object.entries(resetPolicyLabels).map(([value, label]) => (
+                                                    <option key={value} value={value}>{label}</option>
+                                                ))}
+                                            </select>
+                                            <button
+                                                type="button"
+                                                onClick={() => removePrice(index)}
+                                                disabled={formData.prices.length <= 1}
+                                                className="p-2 text-slate-400 hover:text-red-600 transition disabled:opacity-30"
+                                                title="删除"
+                                            >
+                                                <Trash2 className="w-4 h-4" />
+                                            </button>
+                                        </div>
+                                    ))}
                                 </div>
+                                <p className="text-xs text-slate-500 mt-1">价格 (元) / 时长 (天) / 流量重置；流量包只增加流量，不延长有效期</p>
                             </div>
 
                             {/* 流量和速度限制 */}
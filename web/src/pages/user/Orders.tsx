@@ -23,7 +23,7 @@ interface Order {
     plan_id: number;
     plan_name: string;
     amount: number;
-    status: number; // 0=待支付 1=已支付 2=已取消 3=已退款
+    status: number; // 0=待支付 1=已支付 2=已取消 3=已退款 4=过期后支付 (待审核) 5=退款中
     payment_method: string;
     created_at: string;
     paid_at: string | null;
@@ -42,6 +42,8 @@ const statusConfig: Record<number, { label: string; color: string; icon: React.C
     1: { label: '已支付', color: 'text-green-600 bg-green-50 border border-green-200', icon: CheckCircle },
     2: { label: '已取消', color: 'text-slate-500 bg-slate-100 border border-slate-200', icon: XCircle },
     3: { label: '已退款', color: 'text-red-600 bg-red-50 border border-red-200', icon: AlertCircle },
+    4: { label: '待审核', color: 'text-orange-600 bg-orange-50 border border-orange-200', icon: Clock },
+    5: { label: '退款中', color: 'text-purple-600 bg-purple-50 border border-purple-200', icon: Clock },
 };
 
 // 用户订单页面
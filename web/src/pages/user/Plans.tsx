@@ -8,18 +8,27 @@ import {
     ArrowRight,
     Loader2,
     Tag,
-    X
+    X,
+    RefreshCw
 } from 'lucide-react';
 import { useNavigate } from 'react-router-dom';
 import api from '../../lib/api';
 import { useToast } from '../../components/ui/Toast';
 
+interface PlanPrice {
+    period: string;
+    price: number;
+    duration: number;
+    reset_policy: string;
+}
+
 interface Plan {
     id: number;
     name: string;
     description: string;
     price: number;
     duration: number;
+    prices: PlanPrice[];
     transfer: number;
     speed_limit: number;
     device_limit: number;
@@ -31,15 +40,65 @@ interface UserProfile {
     balance: number;
 }
 
+interface UpgradeQuote {
+    current_plan: Plan;
+    plan: Plan;
+    remaining_days: number;
+    remaining_transfer: number;
+    remaining_value: number;
+    amount: number;
+    credit: number;
+    discount: number;
+    paid: number;
+    days: number;
+    transfer: number;
+}
+
+const periodLabels: Record<string, string> = {
+    monthly: '月付',
+    quarterly: '季付',
+    half_yearly: '半年付',
+    yearly: '年付',
+    onetime: '流量包',
+};
+
+const resetPolicyLabels: Record<string, string> = {
+    purchase: '购买时重置流量',
+    monthly: '每月重置流量',
+};
+
 // 格式化流量
 function formatTraffic(gb: number): string {
     if (gb >= 1024) return `${(gb / 1024).toFixed(1)} TB`;
     return `${gb} GB`;
 }
 
+// 计费周期选择
+function PeriodSelector({ prices, value, onChange }: { prices: PlanPrice[]; value: string; onChange: (period: string) => void }) {
+    return (
+        <div className="grid grid-cols-3 gap-2">
+            {prices.map((item) => (
+                <button
+                    key={item.period}
+                    type="button"
+                    onClick={() => onChange(item.period)}
+                    className={`py-2 px-2 rounded-lg border text-sm transition ${value === item.period
+                        ? 'border-primary bg-primary/5 text-primary'
+                        : 'border-slate-200 text-slate-600 hover:border-primary/50'
+                        }`}
+                >
+                    <div className="font-medium">{periodLabels[item.period] || item.period}</div>
+                    <div className="text-xs">¥{item.price}</div>
+                </button>
+            ))}
+        </div>
+    );
+}
+
 // 套餐购买页面
 export default function UserPlansPage() {
     const [selectedPlan, setSelectedPlan] = useState<Plan | null>(null);
+    const [period, setPeriod] = useState('');
     const [showConfirmModal, setShowConfirmModal] = useState(false);
 
     // Coupon state
@@ -47,10 +106,39 @@ export default function UserPlansPage() {
     const [couponError, setCouponError] = useState('');
     const [appliedCoupon, setAppliedCoupon] = useState<{ code: string; discount: number; final_amount: number } | null>(null);
 
+    // 套餐变更
+    const [upgradePlan, setUpgradePlan] = useState<Plan | null>(null);
+    const [upgradePeriod, setUpgradePeriod] = useState('');
+
     const queryClient = useQueryClient();
     const toast = useToast();
     const navigate = useNavigate();
 
+    // 套餐变更报价
+    const { data: quoteData, isLoading: loadingQuote, error: quoteError } = useQuery<{ data: UpgradeQuote }>({
+        queryKey: ['upgrade-quote', upgradePlan?.id, upgradePeriod],
+        queryFn: () => api.get('/user/orders/upgrade/quote', {
+            params: { plan_id: upgradePlan?.id, period: upgradePeriod }
+        }).then(res => res.data),
+        enabled: !!upgradePlan && !!upgradePeriod,
+        retry: false,
+    });
+    const quote = quoteData?.data;
+
+    // 创建套餐变更订单
+    const upgradeMutation = useMutation({
+        mutationFn: (data: { plan_id: number; period: string }) => api.post('/user/orders/upgrade', data),
+        onSuccess: () => {
+            queryClient.invalidateQueries({ queryKey: ['user-orders'] });
+            setUpgradePlan(null);
+            toast.success('套餐变更订单已创建，请前往订单页面支付。');
+            navigate('/dashboard/orders');
+        },
+        onError: (error: Error & { response?: { data?: { message?: string } } }) => {
+            toast.error(error.response?.data?.message || '套餐变更失败');
+        },
+    });
+
     // 获取套餐列表
     const { data: plansData, isLoading: loadingPlans } = useQuery<{ data: Plan[] }>({
         queryKey: ['public-plans'],
@@ -65,7 +153,7 @@ export default function UserPlansPage() {
 
     // 验证优惠券
     const verifyCouponMutation = useMutation({
-        mutationFn: (data: { code: string; plan_id: number; amount: number }) =>
+        mutationFn: (data: { code: string; plan_id: number; period: string }) =>
             api.post('/user/coupons/verify', data).then(res => res.data),
         onSuccess: (res) => {
             if (res.code === 200) {
@@ -92,7 +180,7 @@ export default function UserPlansPage() {
 
     // 创建订单
     const createOrderMutation = useMutation({
-        mutationFn: (data: { plan_id: number; coupon_code?: string }) =>
+        mutationFn: (data: { plan_id: number; period: string; coupon_code?: string }) =>
             api.post('/user/orders', data),
         onSuccess: () => {
             queryClient.invalidateQueries({ queryKey: ['user-orders'] });
@@ -113,6 +201,7 @@ export default function UserPlansPage() {
     // 打开确认弹窗
     const handleSelectPlan = (plan: Plan) => {
         setSelectedPlan(plan);
+        setPeriod(plan.prices?.[0]?.period || '');
         // Reset coupon
         setCouponCode('');
         setCouponError('');
@@ -125,21 +214,38 @@ export default function UserPlansPage() {
         verifyCouponMutation.mutate({
             code: couponCode,
             plan_id: selectedPlan.id,
-            amount: selectedPlan.price
+            period
         });
     }
 
+    // 切换计费周期后优惠券需重新验证
+    const handleChangePeriod = (value: string) => {
+        setPeriod(value);
+        setAppliedCoupon(null);
+        setCouponError('');
+    };
+
+    // 打开套餐变更弹窗，流量包不能用于变更
+    const handleUpgrade = (plan: Plan) => {
+        setUpgradePlan(plan);
+        setUpgradePeriod(plan.prices?.find(item => item.period !== 'onetime')?.period || '');
+    };
+
     // 确认购买
     const handleConfirmPurchase = () => {
         if (!selectedPlan) return;
         createOrderMutation.mutate({
             plan_id: selectedPlan.id,
+            period,
             coupon_code: appliedCoupon?.code
         });
     };
 
+    const selectedPrice = selectedPlan?.prices?.find(item => item.period === period);
+    const upgradePrices = upgradePlan?.prices?.filter(item => item.period !== 'onetime') || [];
+
     // Calculate final price needed from balance
-    const finalPrice = appliedCoupon ? appliedCoupon.final_amount : (selectedPlan?.price || 0);
+    const finalPrice = appliedCoupon ? appliedCoupon.final_amount : (selectedPrice?.price || 0);
 
     // 判断余额是否足够
     const isBalanceEnough = balance >= finalPrice;
@@ -216,7 +322,10 @@ export default function UserPlansPage() {
                                     {/* 价格 */}
                                     <div className="mb-6">
                                         <span className="text-4xl font-bold text-slate-900">¥{plan.price}</span>
-                                        <span className="text-slate-500 ml-1">/{plan.duration}天</span>
+                                        <span className="text-slate-500 ml-1">/{plan.duration > 0 ? `${plan.duration}天` : '流量包'}</span>
+                                        {(plan.prices?.length || 0) > 1 && (
+                                            <span className="text-slate-400 text-sm ml-1">起</span>
+                                        )}
                                     </div>
 
                                     {/* 套餐特性 */}
@@ -256,6 +365,15 @@ export default function UserPlansPage() {
                                         立即购买
                                         <ArrowRight className="w-4 h-4" />
                                     </button>
+                                    {plan.prices?.some(item => item.period !== 'onetime') && (
+                                        <button
+                                            onClick={() => handleUpgrade(plan)}
+                                            className="w-full flex items-center justify-center gap-1 mt-2 py-2 text-sm text-slate-500 hover:text-primary transition"
+                                        >
+                                            <RefreshCw className="w-3.5 h-3.5" />
+                                            从当前套餐变更
+                                        </button>
+                                    )}
                                 </div>
                             </div>
                         );
@@ -272,6 +390,12 @@ export default function UserPlansPage() {
                         </div>
 
                         <div className="p-6 space-y-4">
+                            {/* 计费周期 */}
+                            <div>
+                                <label className="block text-sm text-slate-500 mb-2">计费周期</label>
+                                <PeriodSelector prices={selectedPlan.prices || []} value={period} onChange={handleChangePeriod} />
+                            </div>
+
                             {/* 套餐信息 */}
                             <div className="bg-slate-50 border border-slate-100 rounded-lg p-4">
                                 <div className="flex items-center justify-between mb-2">
@@ -280,15 +404,20 @@ export default function UserPlansPage() {
                                 </div>
                                 <div className="flex items-center justify-between mb-2">
                                     <span className="text-slate-500">有效期</span>
-                                    <span className="text-slate-900">{selectedPlan.duration} 天</span>
+                                    <span className="text-slate-900">
+                                        {selectedPrice && selectedPrice.duration > 0 ? `${selectedPrice.duration} 天` : '不延长有效期'}
+                                    </span>
                                 </div>
                                 <div className="flex items-center justify-between mb-2">
                                     <span className="text-slate-500">流量额度</span>
-                                    <span className="text-slate-900">{formatTraffic(selectedPlan.transfer)}</span>
+                                    <span className="text-slate-900">
+                                        {formatTraffic(selectedPlan.transfer)}
+                                        {selectedPrice && resetPolicyLabels[selectedPrice.reset_policy] && ` · ${resetPolicyLabels[selectedPrice.reset_policy]}`}
+                                    </span>
                                 </div>
                                 <div className="flex items-center justify-between pt-2 border-t border-slate-200">
                                     <span className="text-slate-500">套餐价格</span>
-                                    <span className="text-xl font-bold text-primary">¥{selectedPlan.price}</span>
+                                    <span className="text-xl font-bold text-primary">¥{selectedPrice?.price ?? '-'}</span>
                                 </div>
                             </div>
 
@@ -372,7 +501,7 @@ export default function UserPlansPage() {
                             {isBalanceEnough ? (
                                 <button
                                     onClick={handleConfirmPurchase}
-                                    disabled={createOrderMutation.isPending}
+                                    disabled={!selectedPrice || createOrderMutation.isPending}
                                     className="flex-1 py-2.5 bg-primary hover:bg-primary/90 text-white rounded-lg transition disabled:opacity-50"
                                 >
                                     {createOrderMutation.isPending ? (
@@ -393,6 +522,88 @@ export default function UserPlansPage() {
                     </div>
                 </div>
             )}
+
+            {/* 套餐变更弹窗 */}
+            {upgradePlan && (
+                <div className="fixed inset-0 bg-black/50 flex items-center justify-center z-50 p-4">
+                    <div className="bg-white border border-slate-200 rounded-xl w-full max-w-md shadow-xl">
+                        <div className="p-6 border-b border-slate-100">
+                            <h3 className="text-lg font-semibold text-slate-900">变更为 {upgradePlan.name}</h3>
+                        </div>
+
+                        <div className="p-6 space-y-4">
+                            <PeriodSelector prices={upgradePrices} value={upgradePeriod} onChange={setUpgradePeriod} />
+                            {loadingQuote ? (
+                                <div className="text-center py-6 text-slate-500">
+                                    <Loader2 className="w-6 h-6 mx-auto animate-spin" />
+                                </div>
+                            ) : quoteError || !quote ? (
+                                <p className="text-sm text-red-500">
+                                    {(quoteError as Error & { response?: { data?: { message?: string } } })?.response?.data?.message || '无法计算变更价格'}
+                                </p>
+                            ) : (
+                                <div className="bg-slate-50 border border-slate-100 rounded-lg p-4 space-y-2 text-sm">
+                                    <div className="flex items-center justify-between">
+                                        <span className="text-slate-500">当前套餐</span>
+                                        <span className="text-slate-900">{quote.current_plan.name}</span>
+                                    </div>
+                                    <div className="flex items-center justify-between">
+                                        <span className="text-slate-500">剩余</span>
+                                        <span className="text-slate-900">
+                                            {quote.remaining_days.toFixed(1)} 天 / {(quote.remaining_transfer / 1024 ** 3).toFixed(2)} GB
+                                        </span>
+                                    </div>
+                                    <div className="flex items-center justify-between">
+                                        <span className="text-slate-500">剩余价值</span>
+                                        <span className="text-slate-900">¥{quote.remaining_value.toFixed(2)}</span>
+                                    </div>
+                                    <div className="flex items-center justify-between">
+                                        <span className="text-slate-500">新套餐价格</span>
+                                        <span className="text-slate-900">¥{quote.amount.toFixed(2)}</span>
+                                    </div>
+                                    <div className="flex items-center justify-between">
+                                        <span className="text-slate-500">抵扣</span>
+                                        <span className="text-green-600">-¥{quote.credit.toFixed(2)}</span>
+                                    </div>
+                                    <div className="flex items-center justify-between">
+                                        <span className="text-slate-500">变更后</span>
+                                        <span className="text-slate-900">
+                                            {quote.days} 天 / {formatTraffic(Math.round(quote.transfer / 1024 ** 3))}
+                                        </span>
+                                    </div>
+                                    <div className="flex items-center justify-between pt-2 border-t border-slate-200">
+                                        <span className="text-slate-500">应付金额</span>
+                                        <span className="text-xl font-bold text-primary">¥{quote.paid.toFixed(2)}</span>
+                                    </div>
+                                    <p className="text-xs text-slate-400 pt-1">
+                                        支付后立即替换当前套餐，有效期从支付时重新计算
+                                    </p>
+                                </div>
+                            )}
+                        </div>
+
+                        <div className="p-6 border-t border-slate-100 flex gap-3">
+                            <button
+                                onClick={() => setUpgradePlan(null)}
+                                className="flex-1 py-2.5 bg-slate-100 hover:bg-slate-200 text-slate-600 rounded-lg transition"
+                            >
+                                取消
+                            </button>
+                            <button
+                                onClick={() => upgradeMutation.mutate({ plan_id: upgradePlan.id, period: upgradePeriod })}
+                                disabled={!quote || upgradeMutation.isPending}
+                                className="flex-1 py-2.5 bg-primary hover:bg-primary/90 text-white rounded-lg transition disabled:opacity-50"
+                            >
+                                {upgradeMutation.isPending ? (
+                                    <Loader2 className="w-4 h-4 mx-auto animate-spin" />
+                                ) : (
+                                    '确认变更'
+                                )}
+                            </button>
+                        </div>
+                    </div>
+                </div>
+            )}
         </div>
     );
 }
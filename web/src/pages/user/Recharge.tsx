@@ -1,11 +1,44 @@
 import { useState } from 'react';
+import { useQuery } from '@tanstack/react-query';
 import { motion } from 'framer-motion';
-import { CreditCard, Wallet, ArrowRight } from 'lucide-react';
+import { CreditCard, Wallet, ArrowRight, History } from 'lucide-react';
+import api from '../../lib/api';
+
+interface BalanceLog {
+    id: number;
+    account: string;
+    type: string;
+    amount: number;
+    balance_after: number;
+    memo: string;
+    created_at: string;
+}
+
+const typeLabels: Record<string, string> = {
+    recharge: '在线充值',
+    recharge_refund: '充值退款',
+    purchase: '余额购买',
+    refund: '订单退款',
+    admin_charge: '管理员充值',
+    admin_adjust: '管理员调整',
+    commission: '邀请返利',
+};
 
 export default function UserRechargePage() {
     const [amount, setAmount] = useState('');
     const [customAmount, setCustomAmount] = useState('');
     const [loading, setLoading] = useState(false);
+    const [logPage, setLogPage] = useState(1);
+
+    // 资金明细
+    const { data: logsData } = useQuery<{ data: { list: BalanceLog[]; total: number } }>({
+        queryKey: ['balance-logs', logPage],
+        queryFn: () => api.get('/user/balance/logs', {
+            params: { page: logPage, page_size: 10 }
+        }).then(res => res.data),
+    });
+    const logs = logsData?.data?.list || [];
+    const logPages = Math.ceil((logsData?.data?.total || 0) / 10);
 
     // 预设金额选项
     const presetAmounts = [10, 20, 50, 100, 200, 500];
@@ -196,6 +229,58 @@ export default function UserRechargePage() {
                     </div>
                 </div>
             </motion.div>
+
+            {/* 资金明细 */}
+            <div className="mt-8 bg-white dark:bg-gray-800 rounded-2xl shadow-lg overflow-hidden">
+                <div className="flex items-center gap-2 p-6 border-b border-gray-200 dark:border-gray-700">
+                    <History className="w-5 h-5 text-gray-500" />
+                    <h2 className="text-lg font-bold text-gray-900 dark:text-white">资金明细</h2>
+                </div>
+                {logs.length === 0 ? (
+                    <p className="p-6 text-center text-gray-500">暂无记录</p>
+                ) : (
+                    <ul className="divide-y divide-gray-100 dark:divide-gray-700">
+                        {logs.map((log) => (
+                            <li key={log.id} className="flex items-center justify-between px-6 py-4">
+                                <div>
+                                    <p className="text-sm font-medium text-gray-900 dark:text-white">
+                                        {typeLabels[log.type] || log.type}
+                                        {log.account === 'commission' && <span className="ml-2 text-xs text-gray-400">佣金</span>}
+                                    </p>
+                                    <p className="text-xs text-gray-500">
+                                        {new Date(log.created_at).toLocaleString('zh-CN')} {log.memo}
+                                    </p>
+                                </div>
+                                <div className="text-right">
+                                    <p className={`text-sm font-semibold ${log.amount >= 0 ? 'text-green-600' : 'text-red-600'}`}>
+                                        {log.amount >= 0 ? '+' : ''}{log.amount.toFixed(2)}
+                                    </p>
+                                    <p className="text-xs text-gray-400">余 ¥{log.balance_after.toFixed(2)}</p>
+                                </div>
+                            </li>
+                        ))}
+                    </ul>
+                )}
+                {logPages > 1 && (
+                    <div className="flex items-center justify-end gap-2 px-6 py-4 border-t border-gray-200 dark:border-gray-700">
+                        <button
+                            onClick={() => setLogPage(p => Math.max(1, p - 1))}
+                            disabled={logPage === 1}
+                            className="px-3 py-1.5 text-sm rounded-lg bg-gray-100 dark:bg-gray-700 disabled:opacity-50"
+                        >
+                            上一页
+                        </button>
+                        <span className="text-sm text-gray-500">{logPage} / {logPages}</span>
+                        <button
+                            onClick={() => setLogPage(p => Math.min(logPages, p + 1))}
+                            disabled={logPage === logPages}
+                            className="px-3 py-1.5 text-sm rounded-lg bg-gray-100 dark:bg-gray-700 disabled:opacity-50"
+                        >
+                            下一页
+                        </button>
+                    </div>
+                )}
+            </div>
         </div>
     );
 }
@@ -10,7 +10,8 @@ import {
     Check,
     Eye,
     EyeOff,
-    AlertTriangle
+    AlertTriangle,
+    CalendarClock
 } from 'lucide-react';
 import api from '../../lib/api';
 
@@ -21,6 +22,23 @@ interface UserProfile {
     created_at: string;
 }
 
+interface AutoRenewStatus {
+    enabled: boolean;
+    plan: { id: number; name: string } | null;
+    period: string;
+    amount: number;
+    renew_at: string | null;
+    retry_at: string | null;
+    failures: number;
+}
+
+const periodLabels: Record<string, string> = {
+    monthly: '月付',
+    quarterly: '季付',
+    half_yearly: '半年付',
+    yearly: '年付',
+};
+
 // 用户设置页面
 export default function UserSettingsPage() {
     const [showPassword, setShowPassword] = useState(false);
@@ -30,6 +48,7 @@ export default function UserSettingsPage() {
     const [saving, setSaving] = useState(false);
     const [passwordError, setPasswordError] = useState('');
     const [passwordSuccess, setPasswordSuccess] = useState(false);
+    const [autoRenewError, setAutoRenewError] = useState('');
 
     const queryClient = useQueryClient();
 
@@ -39,6 +58,24 @@ export default function UserSettingsPage() {
         queryFn: () => api.get('/user/profile').then(res => res.data),
     });
 
+    // 获取自动续费设置
+    const { data: autoRenewData } = useQuery<{ data: AutoRenewStatus }>({
+        queryKey: ['user-auto-renew'],
+        queryFn: () => api.get('/user/auto-renew').then(res => res.data),
+    });
+
+    // 开启或关闭自动续费
+    const autoRenewMutation = useMutation({
+        mutationFn: (enabled: boolean) => api.put('/user/auto-renew', { enabled }),
+        onSuccess: () => {
+            setAutoRenewError('');
+            queryClient.invalidateQueries({ queryKey: ['user-auto-renew'] });
+        },
+        onError: (error: Error & { response?: { data?: { message?: string } } }) => {
+            setAutoRenewError(error.response?.data?.message || '设置失败');
+        },
+    });
+
     // 修改密码
     const changePasswordMutation = useMutation({
         mutationFn: (data: { old_password: string; new_password: string }) =>
@@ -58,6 +95,7 @@ export default function UserSettingsPage() {
 
 
     const profile = profileData?.data;
+    const autoRenew = autoRenewData?.data;
 
 
 
@@ -157,6 +195,51 @@ export default function UserSettingsPage() {
                 </div>
             </div>
 
+            {/* 自动续费 */}
+            <div className="bg-white border border-slate-200 rounded-xl overflow-hidden shadow-sm">
+                <div className="px-6 py-4 border-b border-slate-200">
+                    <div className="flex items-center gap-3">
+                        <CalendarClock className="w-5 h-5 text-primary" />
+                        <h2 className="text-lg font-semibold text-slate-900">自动续费</h2>
+                    </div>
+                </div>
+
+                <div className="p-6 space-y-3">
+                    <div className="flex items-center justify-between">
+                        <div>
+                            <p className="text-slate-900 font-medium">到期前从余额自动续费当前套餐</p>
+                            <p className="text-sm text-slate-500 mt-1">
+                                {autoRenew?.plan
+                                    ? `${autoRenew.plan.name} · ${periodLabels[autoRenew.period] || autoRenew.period} · ¥${autoRenew.amount.toFixed(2)}`
+                                    : '当前没有可续费的套餐'}
+                            </p>
+                        </div>
+                        <button
+                            type="button"
+                            onClick={() => autoRenewMutation.mutate(!autoRenew?.enabled)}
+                            disabled={!autoRenew || autoRenewMutation.isPending || (!autoRenew.enabled && !autoRenew.plan)}
+                            className={`relative w-12 h-6 rounded-full transition disabled:opacity-50 ${autoRenew?.enabled ? 'bg-primary' : 'bg-slate-300'
+                                }`}
+                        >
+                            <div className={`absolute top-1 w-4 h-4 bg-white rounded-full transition ${autoRenew?.enabled ? 'left-7' : 'left-1'
+                                }`} />
+                        </button>
+                    </div>
+                    {autoRenew?.enabled && autoRenew.renew_at && (
+                        <p className="text-sm text-slate-500">
+                            计划于 {new Date(autoRenew.renew_at).toLocaleDateString('zh-CN')} 起自动续费，请保持余额充足
+                        </p>
+                    )}
+                    {autoRenew?.enabled && autoRenew.retry_at && (
+                        <p className="text-sm text-red-500">
+                            续费未成功，已失败 {autoRenew.failures} 次，将于 {new Date(autoRenew.retry_at).toLocaleDateString('zh-CN')} 重试
+                        </p>
+                    )}
+                    {autoRenewError && (
+                        <p className="text-sm text-red-500">{autoRenewError}</p>
+                    )}
+                </div>
+            </div>
 
             {/* 修改密码 */}
             <div className="bg-white border border-slate-200 rounded-xl overflow-hidden shadow-sm">